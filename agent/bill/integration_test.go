@@ -0,0 +1,109 @@
+// +build !noagentbilltest
+
+package billing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/job"
+	"github.com/privatix/dappctrl/proc"
+	"github.com/privatix/dappctrl/proc/worker"
+)
+
+// newTestQueue starts a job queue processing jobs with worker handlers.
+func newTestQueue(t *testing.T) *job.Queue {
+	w, err := worker.NewWorker(db, nil, nil, nil, nil,
+		common.Address{}, common.Address{}, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := job.NewQueue(conf.Job, logger, db, proc.HandlersMap(w))
+	w.SetQueue(queue)
+
+	go queue.Process()
+
+	return queue
+}
+
+func waitServiceStatus(t *testing.T, ch *data.Channel, status string) {
+	for i := 0; i < 100; i++ {
+		if err := db.Reload(ch); err != nil {
+			t.Fatal(err)
+		}
+		if ch.ServiceStatus == status {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("service status is %s, wanted: %s", ch.ServiceStatus, status)
+}
+
+func processRound(t *testing.T) {
+	if err := mon.processRound(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func activeJobs(t *testing.T, ch *data.Channel) int {
+	jobs, err := db.SelectAllFrom(data.JobTable,
+		"WHERE related_id = $1 AND status = $2", ch.ID, data.JobActive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(jobs)
+}
+
+// Source conditions:
+// There is an active channel with 3 billing intervals consumed, but not
+// paid. Max billing lag is 1 unit.
+//
+// Expected result:
+// Service is suspended by the first round. It is unsuspended after
+// consumed intervals are paid.
+func TestSuspendUnsuspend(t *testing.T) {
+	fixture := newFixture(t)
+	defer fixture.clean()
+
+	offering := data.NewTestOffering(fixture.agent.EthAddr,
+		fixture.product.ID, fixture.template.ID)
+	offering.MaxBillingUnitLag = 1
+	offering.MaxSuspendTime = 3600
+
+	channel := data.NewTestChannel(fixture.agent.EthAddr,
+		fixture.client.EthAddr, offering.ID, 0, 1000000,
+		data.ChannelActive)
+	channel.ServiceStatus = data.ServiceActive
+
+	session := data.NewTestSession(channel.ID)
+	session.SecondsConsumed = 3 * uint64(offering.BillingInterval)
+	session.LastUsageTime = time.Now()
+
+	fixture.addTestObjects([]reform.Record{offering, channel, session})
+	defer db.DeleteFrom(data.JobTable, "WHERE related_id = $1",
+		channel.ID)
+
+	queue := newTestQueue(t)
+	defer queue.Close()
+
+	processRound(t)
+	waitServiceStatus(t, channel, data.ServiceSuspended)
+
+	// Still not paid.
+	processRound(t)
+	if n := activeJobs(t, channel); n != 0 {
+		t.Fatalf("unexpected jobs for unpaid channel: %d", n)
+	}
+
+	channel.ReceiptBalance = offering.SetupPrice.Add(
+		offering.UnitPrice.Mul(data.NewAmount(session.SecondsConsumed)))
+	data.SaveToTestDB(t, db, channel)
+
+	processRound(t)
+	waitServiceStatus(t, channel, data.ServiceActive)
+}
@@ -1,13 +1,16 @@
 package billing
 
 import (
+	"sync"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
 	"gopkg.in/reform.v1"
 
 	"github.com/privatix/dappctrl/data"
 	"github.com/privatix/dappctrl/proc"
+	"github.com/privatix/dappctrl/proc/bill"
 	"github.com/privatix/dappctrl/util"
 )
 
@@ -17,13 +20,29 @@ const (
 
 // Billing monitor specific errors.
 var (
-	ErrInput = errors.New("one or more input parameters is wrong")
+	ErrInput          = errors.New("one or more input parameters is wrong")
+	ErrAlreadyRunning = errors.New("already running")
+	ErrMonitorClosed  = errors.New("monitor closed")
 )
 
+// Config is a billing monitor configuration.
+type Config struct {
+	Enabled  bool
+	Interval uint // In milliseconds.
+}
+
+// NewConfig creates a new billing monitor configuration.
+func NewConfig() *Config {
+	return &Config{
+		Enabled:  true,
+		Interval: 5000,
+	}
+}
+
 // Monitor provides logic for checking channels for various cases,
 // in which service(s) must be suspended/terminated/or unsuspended (continued).
-// All conditions are checked on the DB level,
-// so it is safe to call monitors methods from separate goroutines.
+// Amounts due, lags and quotas are calculated by the shared billing
+// calculator, so agent and client agree on them.
 type Monitor struct {
 	db     *reform.DB
 	logger *util.Logger
@@ -31,6 +50,10 @@ type Monitor struct {
 
 	// Interval between next round checks.
 	interval time.Duration
+
+	mtx    sync.Mutex // To guard the exit channels.
+	exit   chan struct{}
+	exited chan struct{}
 }
 
 // NewMonitor creates new instance of billing monitor.
@@ -41,20 +64,54 @@ func NewMonitor(interval time.Duration, db *reform.DB,
 		return nil, ErrInput
 	}
 
-	return &Monitor{db, logger, pc, interval}, nil
+	return &Monitor{db: db, logger: logger, pr: pc, interval: interval}, nil
 }
 
-// Run begins monitoring of channels.
-// In case of error - doesn't restarts automatically.
+// Run begins monitoring of channels. This function does not return until
+// Close() is called. Errors of checking rounds are logged and the checks
+// are retried in the next round.
 func (m *Monitor) Run() error {
+	m.mtx.Lock()
+	if m.exit != nil {
+		m.mtx.Unlock()
+		return ErrAlreadyRunning
+	}
+	m.exit = make(chan struct{}, 1)
+	m.exited = make(chan struct{}, 1)
+	m.mtx.Unlock()
+
 	m.logger.Info("Billing monitor started")
 
+L:
 	for {
 		if err := m.processRound(); err != nil {
-			return err
+			m.logger.Error("billing round failed: %v", err)
 		}
 
-		time.Sleep(m.interval)
+		select {
+		case <-m.exit:
+			break L
+		case <-time.After(m.interval):
+		}
+	}
+
+	m.exited <- struct{}{}
+
+	m.mtx.Lock()
+	m.exit = nil
+	m.mtx.Unlock()
+
+	return ErrMonitorClosed
+}
+
+// Close causes currently running Run() function to exit.
+func (m *Monitor) Close() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if m.exit != nil {
+		m.exit <- struct{}{}
+		<-m.exited
 	}
 }
 
@@ -62,117 +119,38 @@ func (m *Monitor) Run() error {
 // for not using more units, than provided by quota and not exceeding
 // over total deposit.
 func (m *Monitor) VerifySecondsBasedChannels() error {
-	// Selects all channels, which
-	// 1. used tokens >= deposit tokens
-	// 2. total consumed seconds >= max offer units (seconds in this case)
-	// Only checks channels, which corresponding offers are using seconds
-	// as billing basis.
-	query := `
-              SELECT channels.id::text
-		FROM channels
-                     LEFT JOIN sessions ses
-		     ON channels.id = ses.channel
-
-                     LEFT JOIN offerings offer
-                     ON channels.offering = offer.id
-
-                     LEFT JOIN accounts acc
-                     ON channels.agent = acc.eth_addr
-               WHERE channels.service_status IN ('pending', 'active')
-                 AND channels.channel_status NOT IN ('pending')
-                 AND offer.unit_type = 'seconds'
-                 AND acc.in_use
-               GROUP BY channels.id, offer.setup_price,
-                     offer.unit_price, offer.max_unit
-              HAVING offer.setup_price + COALESCE(SUM(ses.seconds_consumed), 0) * offer.unit_price >= channels.total_deposit
-                  OR COALESCE(SUM(ses.seconds_consumed), 0) >= offer.max_unit;`
-
-	return m.processEachChannel(query, m.terminateService)
+	return m.processEachUsage(data.UnitSeconds,
+		[]string{data.ServicePending, data.ServiceActive},
+		func(u *bill.Usage) bool { return u.Remaining() == 0 },
+		m.terminateService)
 }
 
 // VerifyUnitsBasedChannels checks all active units based channels
 // for not using more units, than provided by quota
 // and not exceeding over total deposit.
 func (m *Monitor) VerifyUnitsBasedChannels() error {
-	query := `
-              SELECT channels.id::text
-		FROM channels
-                     LEFT JOIN sessions ses
-                     ON channels.id = ses.channel
-
-                     LEFT JOIN offerings offer
-                     ON channels.offering = offer.id
-
-                     LEFT JOIN accounts acc
-                     ON channels.agent = acc.eth_addr
-               WHERE channels.service_status IN ('pending', 'active')
-                 AND channels.channel_status NOT IN ('pending')
-                 AND offer.unit_type = 'units'
-                 AND acc.in_use
-               GROUP BY channels.id, offer.setup_price,
-                     offer.unit_price, offer.max_unit
-              HAVING offer.setup_price + coalesce(sum(ses.units_used), 0) * offer.unit_price >= channels.total_deposit
-                  OR COALESCE(SUM(ses.units_used), 0) >= offer.max_unit;`
-
-	return m.processEachChannel(query, m.terminateService)
+	return m.processEachUsage(data.UnitScalar,
+		[]string{data.ServicePending, data.ServiceActive},
+		func(u *bill.Usage) bool { return u.Remaining() == 0 },
+		m.terminateService)
 }
 
 // VerifyBillingLags checks all active channels for billing lags,
 // and schedules suspending of those, who are suffering from billing lags.
 func (m *Monitor) VerifyBillingLags() error {
-	// Checking billing lags.
-	// All channels, that are not suspended and are not terminated,
-	// but are suffering from the billing lags - must be suspended.
-	query := `
-              SELECT channels.id :: text
-		FROM channels
-                     LEFT JOIN sessions ses
-                     ON channels.id = ses.channel
-
-                     LEFT JOIN offerings offer
-                     ON channels.offering = offer.id
-
-                     LEFT JOIN accounts acc
-                     ON channels.agent = acc.eth_addr
-               WHERE channels.service_status IN ('pending', 'active')
-                     AND channels.channel_status NOT IN ('pending')
-                     AND acc.in_use
-               GROUP BY channels.id, offer.billing_interval,
-                     offer.setup_price, offer.unit_price,
-                     offer.max_billing_unit_lag
-              HAVING COALESCE(SUM(ses.units_used), 0) / offer.billing_interval - (channels.receipt_balance - offer.setup_price ) / offer.unit_price > offer.max_billing_unit_lag
-                  OR COALESCE(SUM(ses.seconds_consumed), 0) / offer.billing_interval - (channels.receipt_balance - offer.setup_price) / offer.unit_price > offer.max_billing_unit_lag;`
-
-	return m.processEachChannel(query, m.suspendService)
+	return m.processEachUsage("",
+		[]string{data.ServicePending, data.ServiceActive},
+		func(u *bill.Usage) bool { return u.Lagging() },
+		m.suspendService)
 }
 
 // VerifySuspendedChannelsAndTryToUnsuspend scans all supsended channels,
 // and checks if all conditions are met to unsuspend them.
 // Is so - schedules task for appropriate channel unsuspending.
 func (m *Monitor) VerifySuspendedChannelsAndTryToUnsuspend() error {
-	// All channels, that are suspended,
-	// but now seems to be payed - must be unsuspended.
-	query := `
-              SELECT channels.id :: text
-		FROM channels
-                     LEFT JOIN sessions ses
-                     ON channels.id = ses.channel
-
-                     LEFT JOIN offerings offer
-                     ON channels.offering = offer.id
-
-                     LEFT JOIN accounts acc
-                     ON channels.agent = acc.eth_addr
-               WHERE channels.service_status IN ('suspended')
-                 AND channels.channel_status NOT IN ('pending')
-                 AND acc.in_use
-               GROUP BY channels.id, offer.billing_interval,
-                     offer.setup_price, offer.unit_price,
-                     offer.max_billing_unit_lag
-              HAVING COALESCE(SUM(ses.units_used), 0) / offer.billing_interval - (channels.receipt_balance - offer.setup_price) / offer.unit_price <= offer.max_billing_unit_lag
-                  OR COALESCE(SUM(ses.seconds_consumed), 0) / offer.billing_interval - (channels.receipt_balance - offer.setup_price) / offer.unit_price <= offer.max_billing_unit_lag;`
-
-	return m.processEachChannel(query, m.unsuspendService)
+	return m.processEachUsage("", []string{data.ServiceSuspended},
+		func(u *bill.Usage) bool { return !u.Lagging() },
+		m.unsuspendService)
 }
 
 // VerifyChannelsForInactivity scans all channels, that are not terminated,
@@ -221,6 +199,7 @@ func (m *Monitor) processRound() error {
 	return m.callChecksAndReportErrorIfAny(
 		m.VerifySecondsBasedChannels,
 		m.VerifyUnitsBasedChannels,
+		m.VerifyBillingLags,
 		m.VerifyChannelsForInactivity,
 		m.VerifySuspendedChannelsAndTryToUnsuspend,
 		m.VerifySuspendedChannelsAndTryToTerminate)
@@ -228,16 +207,27 @@ func (m *Monitor) processRound() error {
 
 func (m *Monitor) suspendService(uuid string) error {
 	_, err := m.pr.SuspendChannel(uuid, jobCreator)
-	return err
+	return m.skipScheduled(uuid, err)
 }
 
 func (m *Monitor) terminateService(uuid string) error {
 	_, err := m.pr.TerminateChannel(uuid, jobCreator)
-	return err
+	return m.skipScheduled(uuid, err)
 }
 
 func (m *Monitor) unsuspendService(uuid string) error {
 	_, err := m.pr.ActivateChannel(uuid, jobCreator)
+	return m.skipScheduled(uuid, err)
+}
+
+// skipScheduled ignores errors about jobs already scheduled for a channel.
+// The channel is checked again on the next round.
+func (m *Monitor) skipScheduled(uuid string, err error) error {
+	if err == proc.ErrActiveJobsExist || err == proc.ErrSameJobExists {
+		m.logger.Debug("billing: jobs already scheduled for chan %s",
+			uuid)
+		return nil
+	}
 	return err
 }
 
@@ -272,3 +262,84 @@ func (m *Monitor) processEachChannel(query string,
 
 	return nil
 }
+
+// processEachUsage calculates usages of channels with given service statuses
+// and, if given, offering unit type. Channels which usages pass the check
+// are processed.
+func (m *Monitor) processEachUsage(unitType string, statuses []string,
+	check func(*bill.Usage) bool, processor func(string) error) error {
+	query := `
+              SELECT channels.id::text, channels.offering::text,
+                     channels.total_deposit, channels.receipt_balance,
+                     COALESCE(SUM(ses.units_used), 0),
+                     COALESCE(SUM(ses.seconds_consumed), 0)
+		FROM channels
+                     LEFT JOIN sessions ses
+                     ON channels.id = ses.channel
+
+                     LEFT JOIN offerings offer
+                     ON channels.offering = offer.id
+
+                     LEFT JOIN accounts acc
+                     ON channels.agent = acc.eth_addr
+               WHERE channels.service_status::text = ANY($1::text[])
+                 AND channels.channel_status NOT IN ('pending')
+                 AND ($2::text = '' OR offer.unit_type::text = $2)
+                 AND acc.in_use
+               GROUP BY channels.id;`
+
+	type channelUsage struct {
+		channel, offering string
+		units, seconds    uint64
+		usage             bill.Usage
+	}
+
+	rows, err := m.db.Query(query, pq.Array(statuses), unitType)
+	if err != nil {
+		return err
+	}
+
+	var usages []*channelUsage
+	for rows.Next() {
+		u := new(channelUsage)
+		if err := rows.Scan(&u.channel, &u.offering, &u.usage.Deposit,
+			&u.usage.Paid, &u.units, &u.seconds); err != nil {
+			rows.Close()
+			return err
+		}
+		usages = append(usages, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	offerings := make(map[string]*data.Offering)
+	for _, u := range usages {
+		offer, ok := offerings[u.offering]
+		if !ok {
+			offer = new(data.Offering)
+			if err := m.db.FindByPrimaryKeyTo(
+				offer, u.offering); err != nil {
+				return err
+			}
+			offerings[u.offering] = offer
+		}
+
+		u.usage.Offering = offer
+		u.usage.Consumed = u.units
+		if offer.UnitType == data.UnitSeconds {
+			u.usage.Consumed = u.seconds
+		}
+
+		if !check(&u.usage) {
+			continue
+		}
+
+		if err := processor(u.channel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -271,20 +271,44 @@ func TestNewMonitor(t *testing.T) {
 	}
 }
 
-func TestMonitorRun(t *testing.T) {
-	defer func() {
-		if r := recover(); r == nil {
-			t.Fatal(errTestResult)
-		}
+func TestMonitorRoundErrors(t *testing.T) {
+	// Every round fails on a closed connection.
+	closed := data.NewTestDB(conf.DB, logger)
+	data.CloseDB(closed)
+
+	mon := newTestMonitor(10*time.Millisecond, closed, logger, pr)
+
+	ret := make(chan error)
+	go func() {
+		ret <- mon.Run()
 	}()
 
-	mon, err := NewMonitor(time.Second, &reform.DB{}, logger, pr)
-	if err != nil {
-		panic(err)
+	select {
+	case err := <-ret:
+		t.Fatalf("monitor stopped on round error: %v", err)
+	case <-time.After(100 * time.Millisecond):
 	}
 
-	if err := mon.Run(); err == nil {
-		t.Fatal(errTestResult)
+	mon.Close()
+	if err := <-ret; err != ErrMonitorClosed {
+		t.Fatalf("unexpected monitor result: %v", err)
+	}
+}
+
+func TestMonitorClose(t *testing.T) {
+	mon := newTestMonitor(10*time.Millisecond, db, logger, pr)
+
+	ret := make(chan error)
+	go func() {
+		ret <- mon.Run()
+	}()
+
+	// Let the monitor start.
+	time.Sleep(100 * time.Millisecond)
+
+	mon.Close()
+	if err := <-ret; err != ErrMonitorClosed {
+		t.Fatalf("unexpected monitor result: %v", err)
 	}
 }
 
@@ -48,7 +48,7 @@ func genSecondsBasedChannelsUnitLimitExceeded(t *testing.T) *testFixture {
 
 	offering.MaxUnit = &conf.BillingTest.Offer.MaxUnit
 
-	offering.UnitPrice = conf.BillingTest.Offer.UnitPrice
+	offering.UnitPrice = data.NewAmount(conf.BillingTest.Offer.UnitPrice)
 
 	channel1 := data.NewTestChannel(fixture.agent.EthAddr,
 		fixture.client.EthAddr, offering.ID, 0,
@@ -90,7 +90,7 @@ func genSecondsBasedChannelsUnitLimitExceeded(t *testing.T) *testFixture {
 // Channel 1 is selected for terminating.
 // Channel 2 is not affected.
 //
-// Description: this test checks first rule in HAVING block.
+// Description: this test checks the total deposit limit.
 func TestSecondsBasedChannelsLowTotalDeposit(t *testing.T) {
 	fixture := genSecondsBasedChannelsLowTotalDeposit(t)
 	defer fixture.clean()
@@ -110,7 +110,7 @@ func TestSecondsBasedChannelsLowTotalDeposit(t *testing.T) {
 // Channel 1 is selected for terminating.
 // Channel 2 is not affected.
 //
-// Description: this test checks second rule in HAVING block.
+// Description: this test checks the max units limit.
 func TestSecondsBasedChannelsUnitLimitExceeded(t *testing.T) {
 	fixture := genSecondsBasedChannelsUnitLimitExceeded(t)
 	defer fixture.clean()
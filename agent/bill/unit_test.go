@@ -50,7 +50,7 @@ func genUnitsBasedChannelsUnitLimitExceeded(t *testing.T) *testFixture {
 
 	offering.MaxUnit = &conf.BillingTest.Offer.MaxUnit
 
-	offering.UnitPrice = conf.BillingTest.Offer.UnitPrice
+	offering.UnitPrice = data.NewAmount(conf.BillingTest.Offer.UnitPrice)
 
 	offering.UnitType = data.UnitScalar
 
@@ -94,7 +94,7 @@ func genUnitsBasedChannelsUnitLimitExceeded(t *testing.T) *testFixture {
 // Channel 1 is selected for terminating.
 // Channel 2 is not affected.
 //
-// Description: this test checks first rule in HAVING block.
+// Description: this test checks the total deposit limit.
 func TestUnitsBasedChannelsLowTotalDeposit(t *testing.T) {
 	fixture := genUnitsBasedChannelsLowTotalDeposit(t)
 	defer fixture.clean()
@@ -114,7 +114,7 @@ func TestUnitsBasedChannelsLowTotalDeposit(t *testing.T) {
 // Channel 1 is selected for terminating.
 // Channel 2 is not affected.
 //
-// Description: this test checks second rule in HAVING block.
+// Description: this test checks the max units limit.
 func TestUnitsBasedChannelsUnitLimitExceeded(t *testing.T) {
 	fixture := genUnitsBasedChannelsUnitLimitExceeded(t)
 	defer fixture.clean()
@@ -0,0 +1,132 @@
+package balance
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/util"
+)
+
+// Balance checker errors.
+var (
+	ErrInput = errors.New("one or more input parameters is wrong")
+)
+
+// Config is a balance checker configuration.
+type Config struct {
+	CheckPause int64 // pause between check iterations, in seconds
+	MaxAge     int64 // time before account balances are refreshed
+}
+
+// NewConfig creates a default balance checker configuration.
+func NewConfig() *Config {
+	return &Config{
+		CheckPause: 60,
+		MaxAge:     300,
+	}
+}
+
+// Queue is a job queue used to add balance update jobs.
+type Queue interface {
+	Add(j *data.Job) error
+}
+
+// Checker periodically adds jobs updating ptc, psc and eth balances of
+// accounts, which were not checked for a configured time.
+type Checker struct {
+	conf   *Config
+	logger *util.Logger
+	db     *reform.DB
+	queue  Queue
+
+	cancel context.CancelFunc
+	ticker *time.Ticker
+}
+
+// NewChecker creates a new balance checker.
+func NewChecker(conf *Config, logger *util.Logger, db *reform.DB,
+	queue Queue) (*Checker, error) {
+	if logger == nil || db == nil || queue == nil ||
+		conf.CheckPause <= 0 || conf.MaxAge <= 0 {
+		return nil, ErrInput
+	}
+
+	return &Checker{
+		conf:   conf,
+		logger: logger,
+		db:     db,
+		queue:  queue,
+	}, nil
+}
+
+// Start starts the checker. It will continue adding jobs until it is
+// stopped with Stop.
+func (c *Checker) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	c.ticker = time.NewTicker(
+		time.Duration(c.conf.CheckPause) * time.Second)
+	go c.run(ctx, c.ticker.C)
+
+	c.logger.Debug("balance checker started")
+	return nil
+}
+
+// Stop makes the checker stop.
+func (c *Checker) Stop() error {
+	c.cancel()
+	c.ticker.Stop()
+
+	c.logger.Debug("balance checker stopped")
+	return nil
+}
+
+func (c *Checker) run(ctx context.Context, ticker <-chan time.Time) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker:
+			if err := c.check(); err != nil {
+				c.logger.Error("balance checker: %s", err)
+			}
+		}
+	}
+}
+
+// check adds balance update jobs for accounts with outdated balances, unless
+// such jobs are already pending.
+func (c *Checker) check() error {
+	outdated := time.Now().Add(
+		-time.Duration(c.conf.MaxAge) * time.Second)
+
+	accs, err := c.db.SelectAllFrom(data.AccountTable, `
+		WHERE (last_balance_check IS NULL OR last_balance_check < $1)
+		      AND id NOT IN (SELECT related_id FROM jobs
+		                      WHERE type = $2 AND status = $3)`,
+		outdated, data.JobAccountAddCheckBalance, data.JobActive)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range accs {
+		acc := v.(*data.Account)
+		if err := c.queue.Add(&data.Job{
+			Type:        data.JobAccountAddCheckBalance,
+			RelatedType: data.JobAccount,
+			RelatedID:   acc.ID,
+			CreatedBy:   data.JobBalanceChecker,
+			Data:        []byte("{}"),
+		}); err != nil {
+			c.logger.Error("failed to add %s job for account %s: %s",
+				data.JobAccountAddCheckBalance, acc.ID, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+// +build !nobalancetest
+
+package balance
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/util"
+)
+
+var (
+	conf struct {
+		BalanceChecker *Config
+		DB             *data.DBConfig
+		Log            *util.LogConfig
+	}
+
+	logger *util.Logger
+	db     *reform.DB
+)
+
+type mockQueue struct {
+	added []*data.Job
+}
+
+func (q *mockQueue) Add(j *data.Job) error {
+	q.added = append(q.added, j)
+	return nil
+}
+
+func TestCheck(t *testing.T) {
+	defer data.CleanTestDB(t, db)
+
+	queue := &mockQueue{}
+	checker, err := NewChecker(conf.BalanceChecker, logger, db, queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	old := now.Add(-time.Duration(conf.BalanceChecker.MaxAge+1) *
+		time.Second)
+
+	unchecked := data.NewTestAccount(data.TestPassword)
+	fresh := data.NewTestAccount(data.TestPassword)
+	fresh.LastBalanceCheck = &now
+	outdated := data.NewTestAccount(data.TestPassword)
+	outdated.LastBalanceCheck = &old
+	pending := data.NewTestAccount(data.TestPassword)
+	pending.LastBalanceCheck = &old
+	data.InsertToTestDB(t, db, unchecked, fresh, outdated, pending)
+
+	job := data.NewTestJob(data.JobAccountAddCheckBalance,
+		data.JobBalanceChecker, data.JobAccount)
+	job.RelatedID = pending.ID
+	data.InsertToTestDB(t, db, job)
+
+	if err := checker.check(); err != nil {
+		t.Fatal(err)
+	}
+
+	added := make(map[string]bool)
+	for _, v := range queue.added {
+		if v.Type != data.JobAccountAddCheckBalance ||
+			v.RelatedType != data.JobAccount {
+			t.Fatalf("unexpected job added: %+v", v)
+		}
+		added[v.RelatedID] = true
+	}
+
+	if len(added) != 2 || !added[unchecked.ID] || !added[outdated.ID] {
+		t.Fatalf("wrong accounts to update: %v", added)
+	}
+}
+
+func TestMain(m *testing.M) {
+	conf.BalanceChecker = NewConfig()
+	conf.DB = data.NewDBConfig()
+	conf.Log = util.NewLogConfig()
+	util.ReadTestConfig(&conf)
+
+	logger = util.NewTestLogger(conf.Log)
+	db = data.NewTestDB(conf.DB, logger)
+	defer data.CloseDB(db)
+
+	os.Exit(m.Run())
+}
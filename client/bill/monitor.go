@@ -5,11 +5,15 @@ import (
 	"sync"
 	"time"
 
+	"github.com/lib/pq"
 	"gopkg.in/reform.v1"
 
+	"github.com/privatix/dappctrl/client/budget"
 	"github.com/privatix/dappctrl/data"
 	"github.com/privatix/dappctrl/pay"
 	"github.com/privatix/dappctrl/proc"
+	pbill "github.com/privatix/dappctrl/proc/bill"
+	"github.com/privatix/dappctrl/signer"
 	"github.com/privatix/dappctrl/util"
 )
 
@@ -21,22 +25,36 @@ var (
 
 // Config is a billing monitor configuration.
 type Config struct {
+	Enabled        bool
 	CollectPeriod  uint // In milliseconds.
 	RequestTLS     bool
 	RequestTimeout uint // In milliseconds, must be less than CollectPeriod.
+	RetryPeriod    uint // In milliseconds, doubled after each failure.
+	MaxRetryPeriod uint // In milliseconds.
+	BatchSize      uint // Cheques to an agent per request, 0 disables batching.
 }
 
 // NewConfig creates a new billing monitor configuration.
 func NewConfig() *Config {
 	return &Config{
+		Enabled:        true,
 		CollectPeriod:  5000,
 		RequestTLS:     false,
 		RequestTimeout: 2500,
+		RetryPeriod:    5000,
+		MaxRetryPeriod: 300000,
+		BatchSize:      20,
 	}
 }
 
-type postChequeFunc func(db *reform.DB, channel, pscAddr, pass string,
-	amount uint64, tls bool, timeout uint) error
+type postChequeFunc func(db *reform.DB, channel, pscAddr string,
+	s signer.Signer, amount data.Amount, tls bool, timeout uint) error
+
+type postChequesFunc func(db *reform.DB, cheques []*data.Cheque,
+	pscAddr string, s signer.Signer, tls bool, timeout uint) ([]error, error)
+
+type queryBalanceFunc func(db *reform.DB, channel string,
+	s signer.Signer, tls bool, timeout uint) (*pay.BalanceReply, error)
 
 // Monitor is a client billing monitor.
 type Monitor struct {
@@ -45,29 +63,35 @@ type Monitor struct {
 	db     *reform.DB
 	pr     *proc.Processor
 	psc    string
-	pw     data.PWDGetter
-	post   postChequeFunc // Is overrided in unit-tests.
-	mtx    sync.Mutex     // To guard the exit channels.
+	signer signer.Signer
+	post   postChequeFunc   // Is overrided in unit-tests.
+	batch  postChequesFunc  // Is overrided in unit-tests.
+	query  queryBalanceFunc // Is overrided in unit-tests.
+	mtx    sync.Mutex       // To guard the exit channels.
 	exit   chan struct{}
 	exited chan struct{}
 }
 
 // NewMonitor creates a new client billing monitor.
 func NewMonitor(conf *Config, logger *util.Logger, db *reform.DB,
-	pr *proc.Processor, pscAddr string, pw data.PWDGetter) *Monitor {
+	pr *proc.Processor, pscAddr string, signer signer.Signer) *Monitor {
 	return &Monitor{
 		conf:   conf,
 		logger: logger,
 		db:     db,
 		pr:     pr,
 		psc:    pscAddr,
-		pw:     pw,
+		signer: signer,
 		post:   pay.PostCheque,
+		batch:  pay.PostCheques,
+		query:  pay.QueryBalance,
 	}
 }
 
-// Run processes billing for active client channels. This function does not
-// return until an error occurs or Close() is called.
+// Run processes billing for active client channels. Receipt balances are
+// resynchronized with agents on startup. This function does not return
+// until Close() is called. Errors of billing rounds are logged and the
+// processing is retried in the next round.
 func (m *Monitor) Run() error {
 	m.mtx.Lock()
 	if m.exit != nil {
@@ -79,7 +103,7 @@ func (m *Monitor) Run() error {
 	m.mtx.Unlock()
 
 	period := time.Duration(m.conf.CollectPeriod) * time.Millisecond
-	ret := ErrMonitorClosed
+	synced := false
 L:
 	for {
 		select {
@@ -90,20 +114,17 @@ L:
 
 		started := time.Now()
 
-		chans, err := m.db.SelectAllFrom(data.ChannelTable, `
-			 JOIN accounts ON eth_addr = client
-			WHERE service_status IN ('active', 'suspended')
-			  AND channel_status = 'active' AND in_use`)
-		if err != nil {
-			ret = err
-			break L
+		if !synced {
+			if err := m.resync(); err != nil {
+				m.logger.Error("failed to resync balances: %v", err)
+			} else {
+				synced = true
+			}
 		}
 
-		for _, v := range chans {
-			err := m.processChannel(v.(*data.Channel))
-			if err != nil {
-				ret = err
-				break L
+		if synced {
+			if err := m.processRound(); err != nil {
+				m.logger.Error("billing round failed: %v", err)
 			}
 		}
 
@@ -116,8 +137,27 @@ L:
 	m.exit = nil
 	m.mtx.Unlock()
 
-	logger.Info("%s", ret)
-	return ret
+	m.logger.Info("%s", ErrMonitorClosed)
+	return ErrMonitorClosed
+}
+
+// processRound processes active client channels and sends pending cheques.
+func (m *Monitor) processRound() error {
+	chans, err := m.db.SelectAllFrom(data.ChannelTable, `
+		 JOIN accounts ON eth_addr = client
+		WHERE service_status IN ('active', 'suspended')
+		  AND channel_status = 'active' AND in_use`)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range chans {
+		if err := m.processChannel(v.(*data.Channel)); err != nil {
+			return err
+		}
+	}
+
+	return m.sendCheques()
 }
 
 // Close causes currently running Run() function to exit.
@@ -131,77 +171,368 @@ func (m *Monitor) Close() {
 	}
 }
 
-func (m *Monitor) processChannel(ch *data.Channel) error {
-	if ch.ReceiptBalance == ch.TotalDeposit {
-		_, err := m.pr.TerminateChannel(ch.ID, data.JobBillingChecker)
-		if err != nil {
-			if err != proc.ErrSameJobExists {
-				return err
-			}
-			msg := "failed to trigger termination for chan %s: %s"
-			m.logger.Error(msg, ch.ID, err)
-		} else {
-			msg := "triggered termination for chan %s"
-			m.logger.Info(msg, ch.ID)
+// resync updates receipt balances of active client channels with balances
+// accepted by agents. It recovers payments, which were accepted by an agent
+// but not acknowledged locally, e.g. because of a crash.
+func (m *Monitor) resync() error {
+	chans, err := m.db.SelectAllFrom(data.ChannelTable, `
+		 JOIN accounts ON eth_addr = client
+		WHERE channel_status = 'active' AND in_use`)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range chans {
+		if err := m.resyncChannel(v.(*data.Channel)); err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
+
+func (m *Monitor) resyncChannel(ch *data.Channel) error {
+	reply, err := m.query(m.db, ch.ID, m.signer,
+		m.conf.RequestTLS, m.conf.RequestTimeout)
+	if err != nil {
+		m.logger.Error("failed to query balance for chan %s: %s",
+			ch.ID, err)
 		return nil
 	}
 
+	m.logger.Info("agent state for chan %s: balance %s, units %d,"+
+		" seconds %d", ch.ID, reply.ReceiptBalance, reply.UnitsUsed,
+		reply.SecondsConsumed)
+
+	return m.db.InTransaction(func(tx *reform.TX) error {
+		if err := tx.SelectOneTo(ch, "WHERE id = $1 FOR UPDATE",
+			ch.ID); err != nil {
+			return err
+		}
+
+		switch reply.ReceiptBalance.Cmp(ch.ReceiptBalance) {
+		case 0:
+			return nil
+		case -1:
+			msg := "agent balance for chan %s is less than receipt" +
+				" balance %s"
+			m.logger.Warn(msg, ch.ID, ch.ReceiptBalance)
+			return nil
+		}
+
+		ch.ReceiptBalance = reply.ReceiptBalance
+		if err := tx.Update(ch); err != nil {
+			return err
+		}
+
+		// Pending cheques covered by the agent balance are delivered.
+		if _, err := tx.Exec(`
+			UPDATE cheques
+			   SET status = $1, acknowledged_at = $2
+			 WHERE channel = $3 AND status = $4 AND amount <= $5`,
+			data.ChequeAcknowledged, time.Now(), ch.ID,
+			data.ChequePending, reply.ReceiptBalance); err != nil {
+			return err
+		}
+
+		m.logger.Info("resynchronized receipt balance for chan %s: %s",
+			ch.ID, ch.ReceiptBalance)
+
+		return nil
+	})
+}
+
+func (m *Monitor) processChannel(ch *data.Channel) error {
+	if ch.ReceiptBalance.Cmp(ch.TotalDeposit) == 0 {
+		return m.terminate(ch)
+	}
+
+	var offer data.Offering
+	if err := m.db.FindByPrimaryKeyTo(&offer, ch.Offering); err != nil {
+		return err
+	}
+
+	// Time-billed offerings are charged for consumed seconds.
+	column := "units_used"
+	if offer.UnitType == data.UnitSeconds {
+		column = "seconds_consumed"
+	}
+
 	var consumed uint64
 	if err := m.db.QueryRow(`
-		SELECT sum(units_used)
+		SELECT COALESCE(sum(`+column+`), 0)
 		  FROM sessions
 		 WHERE channel = $1`, ch.ID).Scan(&consumed); err != nil {
 		return err
 	}
 
-	var offer data.Offering
-	if err := m.db.FindByPrimaryKeyTo(&offer, ch.Offering); err != nil {
-		return err
+	usage := &pbill.Usage{
+		Offering: &offer,
+		Consumed: consumed,
+		Deposit:  ch.TotalDeposit,
+		Paid:     ch.ReceiptBalance,
 	}
 
-	lag := int64(consumed)/int64(offer.BillingInterval) -
-		(int64(ch.ReceiptBalance)-int64(offer.SetupPrice))/
-			int64(offer.UnitPrice)
-	if lag <= 0 {
+	amount := usage.DueAmount()
+	if amount.Cmp(ch.ReceiptBalance) <= 0 {
 		return nil
 	}
 
-	amount := consumed/offer.UnitPrice + offer.SetupPrice
-	if amount > ch.TotalDeposit {
-		amount = ch.TotalDeposit
+	err := budget.CheckPayment(m.db.Querier, ch, &offer, amount)
+	if err == budget.ErrDailyCap || err == budget.ErrChannelCap ||
+		err == budget.ErrUnitPriceCap {
+		m.logger.Warn("stopped paying for chan %s: %s", ch.ID, err)
+		return m.terminate(ch)
+	} else if err != nil {
+		return err
 	}
 
-	go m.postCheque(ch.ID, amount)
+	return m.queueCheque(ch.ID, amount)
+}
 
+func (m *Monitor) terminate(ch *data.Channel) error {
+	_, err := m.pr.TerminateChannel(ch.ID, data.JobBillingChecker)
+	if err != nil {
+		if err != proc.ErrSameJobExists &&
+			err != proc.ErrActiveJobsExist {
+			return err
+		}
+		msg := "failed to trigger termination for chan %s: %s"
+		m.logger.Error(msg, ch.ID, err)
+	} else {
+		msg := "triggered termination for chan %s"
+		m.logger.Info(msg, ch.ID)
+	}
 	return nil
 }
 
-func (m *Monitor) postCheque(ch string, amount uint64) {
-	err := m.post(m.db, ch, m.psc, m.pw.Get(), amount,
-		m.conf.RequestTLS, m.conf.RequestTimeout)
+// queueCheque makes a pending cheque for a given amount unless a channel
+// already has one. A pending cheque for a less amount is superseded, its
+// retry schedule is kept.
+func (m *Monitor) queueCheque(ch string, amount data.Amount) error {
+	return m.db.InTransaction(func(tx *reform.TX) error {
+		now := time.Now()
+		cheque := &data.Cheque{
+			ID:          util.NewUUID(),
+			Channel:     ch,
+			Amount:      amount,
+			Status:      data.ChequePending,
+			NextAttempt: now,
+			CreatedAt:   now,
+		}
+
+		var pending data.Cheque
+		err := tx.SelectOneTo(&pending,
+			"WHERE channel = $1 AND status = $2 FOR UPDATE",
+			ch, data.ChequePending)
+		if err == nil {
+			if pending.Amount.Cmp(amount) >= 0 {
+				return nil
+			}
+
+			pending.Status = data.ChequeSuperseded
+			if err := tx.Update(&pending); err != nil {
+				return err
+			}
+
+			cheque.Attempts = pending.Attempts
+			cheque.NextAttempt = pending.NextAttempt
+			cheque.LastError = pending.LastError
+		} else if err != reform.ErrNoRows {
+			return err
+		}
+
+		return tx.Insert(cheque)
+	})
+}
+
+// sendCheques sends pending cheques of active channels, which are due for
+// an attempt. Cheques to the same payment receiver are sent in batches.
+func (m *Monitor) sendCheques() error {
+	cheques, err := m.db.SelectAllFrom(data.ChequeTable, `
+		  JOIN channels ON channels.id = cheques.channel
+		 WHERE cheques.status = $1 AND cheques.next_attempt <= $2
+		   AND channels.channel_status = 'active'
+		 ORDER BY cheques.created_at`, data.ChequePending, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var chans []string
+	for _, v := range cheques {
+		chans = append(chans, v.(*data.Cheque).Channel)
+	}
+
+	receivers, err := m.paymentReceivers(chans)
+	if err != nil {
+		return err
+	}
+
+	var groups [][]*data.Cheque
+	index := make(map[string]int)
+	for _, v := range cheques {
+		cheque := v.(*data.Cheque)
+		addr, ok := receivers[cheque.Channel]
+		if i, found := index[addr]; ok && found &&
+			uint(len(groups[i])) < m.conf.BatchSize {
+			groups[i] = append(groups[i], cheque)
+			continue
+		}
+
+		// Cheques without a payment receiver fail individually.
+		if ok {
+			index[addr] = len(groups)
+		}
+		groups = append(groups, []*data.Cheque{cheque})
+	}
+
+	for _, v := range groups {
+		if err := m.sendGroup(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// paymentReceivers returns payment receiver addresses of given channels.
+func (m *Monitor) paymentReceivers(chans []string) (map[string]string, error) {
+	receivers := make(map[string]string)
+	if len(chans) == 0 {
+		return receivers, nil
+	}
+
+	rows, err := m.db.Query(`
+		SELECT channel, payment_receiver_address
+		  FROM endpoints
+		 WHERE channel::text = ANY($1::text[])
+		   AND payment_receiver_address IS NOT NULL`, pq.Array(chans))
 	if err != nil {
-		m.logger.Error("failed to post cheque for chan %s: %s", ch, err)
-		return
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ch, addr string
+		if err := rows.Scan(&ch, &addr); err != nil {
+			return nil, err
+		}
+		receivers[ch] = addr
+	}
+
+	return receivers, rows.Err()
+}
+
+// sendGroup sends cheques to the same payment receiver. Results of
+// the cheques are recorded independently.
+func (m *Monitor) sendGroup(cheques []*data.Cheque) error {
+	if len(cheques) == 1 {
+		err := m.post(m.db, cheques[0].Channel, m.psc, m.signer,
+			cheques[0].Amount, m.conf.RequestTLS, m.conf.RequestTimeout)
+		return m.chequeSent(cheques[0], err)
+	}
+
+	errs, postErr := m.batch(m.db, cheques, m.psc, m.signer,
+		m.conf.RequestTLS, m.conf.RequestTimeout)
+	for i, v := range cheques {
+		// A failed request fails all the cheques.
+		sendErr := postErr
+		if postErr == nil {
+			sendErr = errs[i]
+		}
+
+		if err := m.chequeSent(v, sendErr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// chequeSent records a result of sending a cheque to the agent. The receipt
+// balance is updated only after the agent accepts the cheque, otherwise
+// the next attempt is scheduled. Cheques rejected as stale are not retried,
+// since the agent has already accepted a greater balance.
+func (m *Monitor) chequeSent(cheque *data.Cheque, err error) error {
+	if pay.IsStaleBalance(err) {
+		m.logger.Warn("cheque for chan %s is stale: %s",
+			cheque.Channel, err)
+
+		if err := m.acknowledge(cheque); err != nil {
+			return err
+		}
+
+		var ch data.Channel
+		if err := m.db.FindByPrimaryKeyTo(&ch, cheque.Channel); err != nil {
+			return err
+		}
+		return m.resyncChannel(&ch)
 	}
 
-	res, err := m.db.Exec(`
-		UPDATE channels
-		   SET receipt_balance = $1
-		 WHERE id = $2 AND receipt_balance < $1`, amount, ch)
 	if err != nil {
-		msg := "failed to update receipt balance for chan %s: %s"
-		m.logger.Error(msg, ch, err)
-		return
+		m.logger.Error("failed to post cheque for chan %s: %s",
+			cheque.Channel, err)
+
+		msg := err.Error()
+		cheque.Attempts++
+		cheque.LastError = &msg
+		cheque.NextAttempt = time.Now().Add(m.retryDelay(cheque.Attempts))
+		return m.db.Update(cheque)
 	}
 
-	if n, err := res.RowsAffected(); err != nil {
+	return m.acknowledge(cheque)
+}
+
+// acknowledge marks a cheque as accepted by the agent and updates the receipt
+// balance of its channel.
+func (m *Monitor) acknowledge(cheque *data.Cheque) error {
+	return m.db.InTransaction(func(tx *reform.TX) error {
+		now := time.Now()
+		cheque.Status = data.ChequeAcknowledged
+		cheque.AcknowledgedAt = &now
+		if err := tx.Update(cheque); err != nil {
+			return err
+		}
+
+		res, err := tx.Exec(`
+			UPDATE channels
+			   SET receipt_balance = $1
+			 WHERE id = $2 AND receipt_balance < $1`,
+			cheque.Amount, cheque.Channel)
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
 		if n != 0 {
-			msg := "updated receipt balance for chan %s: %d"
-			m.logger.Info(msg, ch, amount)
+			msg := "updated receipt balance for chan %s: %s"
+			m.logger.Info(msg, cheque.Channel, cheque.Amount)
 		} else {
 			msg := "receipt balance isn't updated for chan %s"
-			m.logger.Warn(msg, ch)
+			m.logger.Warn(msg, cheque.Channel)
 		}
+
+		return nil
+	})
+}
+
+// retryDelay returns a delay before the next attempt to send a cheque,
+// which is doubled after each failed attempt.
+func (m *Monitor) retryDelay(attempts uint) time.Duration {
+	delay := time.Duration(m.conf.RetryPeriod) * time.Millisecond
+	max := time.Duration(m.conf.MaxRetryPeriod) * time.Millisecond
+
+	for i := uint(1); i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		return max
 	}
+
+	return delay
 }
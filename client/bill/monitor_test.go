@@ -12,14 +12,12 @@ import (
 
 	"github.com/privatix/dappctrl/data"
 	"github.com/privatix/dappctrl/job"
+	"github.com/privatix/dappctrl/pay"
 	"github.com/privatix/dappctrl/proc"
+	"github.com/privatix/dappctrl/signer"
 	"github.com/privatix/dappctrl/util"
 )
 
-type pwStore struct{}
-
-func (s *pwStore) Get() string { return "test-password" }
-
 type testConfig struct {
 	MonitorStartupDelay uint // In milliseconds.
 	ReactionDelay       uint // In milliseconds.
@@ -45,12 +43,12 @@ var (
 	logger *util.Logger
 	db     *reform.DB
 	pr     *proc.Processor
-	pws    *pwStore
+	sgn    signer.Signer
 )
 
 func newTestMonitor() (*Monitor, chan error) {
 	mon := NewMonitor(conf.ClientBilling,
-		logger, db, pr, "test-psc-address", pws)
+		logger, db, pr, "test-psc-address", sgn)
 
 	ch := make(chan error)
 	go func() { ch <- mon.Run() }()
@@ -79,12 +77,33 @@ func newFixture(t *testing.T, db *reform.DB) *data.TestFixture {
 	return fxt
 }
 
+func TestRoundErrors(t *testing.T) {
+	// Every round fails on a closed connection.
+	closed := data.NewTestDB(conf.DB, logger)
+	data.CloseDB(closed)
+
+	mon := NewMonitor(conf.ClientBilling,
+		logger, closed, pr, "test-psc-address", sgn)
+
+	ch := make(chan error)
+	go func() { ch <- mon.Run() }()
+
+	select {
+	case err := <-ch:
+		t.Fatalf("monitor stopped on round error: %v", err)
+	case <-time.After(time.Duration(
+		conf.ClientBillingTest.ReactionDelay) * time.Millisecond):
+	}
+
+	closeTestMonitor(t, mon, ch)
+}
+
 func TestTerminate(t *testing.T) {
 	fxt := newFixture(t, db)
 	defer fxt.Close()
 
-	fxt.Channel.TotalDeposit = 10
-	fxt.Channel.ReceiptBalance = 10
+	fxt.Channel.TotalDeposit = data.NewAmount(10)
+	fxt.Channel.ReceiptBalance = data.NewAmount(10)
 	data.SaveToTestDB(t, db, fxt.Channel)
 
 	mon, ch := newTestMonitor()
@@ -108,24 +127,43 @@ func TestTerminate(t *testing.T) {
 
 func expectBalance(t *testing.T, fxt *data.TestFixture, expected uint64) {
 	data.ReloadFromTestDB(t, db, fxt.Channel)
-	if fxt.Channel.ReceiptBalance != expected {
-		t.Fatalf("unexpected receipt balance: %d", expected)
+	if fxt.Channel.ReceiptBalance.Cmp(data.NewAmount(expected)) != 0 {
+		t.Fatalf("unexpected receipt balance: %s",
+			fxt.Channel.ReceiptBalance)
 	}
 }
 
 func TestPayment(t *testing.T) {
+	for _, v := range []string{data.UnitScalar, data.UnitSeconds} {
+		t.Run(v, func(t *testing.T) { testPayment(t, v) })
+	}
+}
+
+func testPayment(t *testing.T, unitType string) {
 	fxt := newFixture(t, db)
 	defer fxt.Close()
 
-	fxt.Offering.UnitPrice = 1
-	fxt.Offering.SetupPrice = 2
+	fxt.Offering.UnitType = unitType
+	fxt.Offering.UnitPrice = data.NewAmount(1)
+	fxt.Offering.SetupPrice = data.NewAmount(2)
 	fxt.Offering.BillingInterval = 2
 
-	fxt.Channel.TotalDeposit = 10
-	fxt.Channel.ReceiptBalance = 4
+	fxt.Channel.TotalDeposit = data.NewAmount(10)
+	// Setup price and 4 units are paid.
+	fxt.Channel.ReceiptBalance = data.NewAmount(6)
+
+	// Time-billed offerings are charged for seconds only.
+	newSession := func(consumed uint64) *data.Session {
+		sess := data.NewTestSession(fxt.Channel.ID)
+		if unitType == data.UnitSeconds {
+			sess.SecondsConsumed = consumed
+		} else {
+			sess.UnitsUsed = consumed
+		}
+		return sess
+	}
 
-	sess := data.NewTestSession(fxt.Channel.ID)
-	sess.UnitsUsed = 4
+	sess := newSession(4)
 
 	data.SaveToTestDB(t, db, fxt.Offering, fxt.Channel, sess)
 	defer data.DeleteFromTestDB(t, db, sess)
@@ -135,8 +173,8 @@ func TestPayment(t *testing.T) {
 
 	called := false
 	err := fmt.Errorf("some error")
-	mon.post = func(db *reform.DB, channel, pscAddr, pass string,
-		amount uint64, tls bool, timeout uint) error {
+	mon.post = func(db *reform.DB, channel, pscAddr string,
+		s signer.Signer, amount data.Amount, tls bool, timeout uint) error {
 		called = true
 		return err
 	}
@@ -146,8 +184,7 @@ func TestPayment(t *testing.T) {
 		t.Fatalf("unexpected payment triggering")
 	}
 
-	sess2 := data.NewTestSession(fxt.Channel.ID)
-	sess2.UnitsUsed = 2
+	sess2 := newSession(2)
 	data.SaveToTestDB(t, db, sess2)
 	defer data.DeleteFromTestDB(t, db, sess2)
 
@@ -155,11 +192,281 @@ func TestPayment(t *testing.T) {
 	if !called {
 		t.Fatalf("no payment triggered")
 	}
-	expectBalance(t, fxt, 4)
+	expectBalance(t, fxt, 6)
+
+	cheque := expectCheque(t, fxt, data.ChequePending, 8)
+	if cheque.Attempts == 0 || cheque.LastError == nil {
+		t.Fatalf("failed attempt isn't recorded")
+	}
 
 	err = nil
 	delay()
 	expectBalance(t, fxt, 8)
+
+	cheque = expectCheque(t, fxt, data.ChequeAcknowledged, 8)
+	if cheque.AcknowledgedAt == nil {
+		t.Fatalf("no acknowledgement time")
+	}
+}
+
+func expectCheque(t *testing.T, fxt *data.TestFixture,
+	status string, amount uint64) *data.Cheque {
+	var cheque data.Cheque
+	if err := db.SelectOneTo(&cheque, "WHERE channel = $1 AND status = $2",
+		fxt.Channel.ID, status); err != nil {
+		t.Fatalf("failed to find %s cheque: %s", status, err)
+	}
+
+	if cheque.Amount.Cmp(data.NewAmount(amount)) != 0 {
+		t.Fatalf("unexpected cheque amount: %s", cheque.Amount)
+	}
+
+	return &cheque
+}
+
+func TestSupersedeCheque(t *testing.T) {
+	fxt := newFixture(t, db)
+	defer fxt.Close()
+
+	mon := NewMonitor(conf.ClientBilling,
+		logger, db, pr, "test-psc-address", sgn)
+
+	queue := func(amount uint64) {
+		err := mon.queueCheque(fxt.Channel.ID, data.NewAmount(amount))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queue(5)
+
+	cheque := expectCheque(t, fxt, data.ChequePending, 5)
+	cheque.Attempts = 2
+	data.SaveToTestDB(t, db, cheque)
+
+	// Pending cheque is enough.
+	queue(4)
+	expectCheque(t, fxt, data.ChequePending, 5)
+
+	queue(7)
+	expectCheque(t, fxt, data.ChequeSuperseded, 5)
+	cheque = expectCheque(t, fxt, data.ChequePending, 7)
+	if cheque.Attempts != 2 {
+		t.Fatalf("retry schedule isn't kept")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	mon := &Monitor{conf: &Config{RetryPeriod: 1000, MaxRetryPeriod: 5000}}
+
+	for _, v := range []struct {
+		attempts uint
+		delay    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{100, 5 * time.Second},
+	} {
+		if delay := mon.retryDelay(v.attempts); delay != v.delay {
+			t.Errorf("attempts %d: delay %s, wanted: %s",
+				v.attempts, delay, v.delay)
+		}
+	}
+}
+
+func TestBudgetCap(t *testing.T) {
+	fxt := newFixture(t, db)
+	defer fxt.Close()
+
+	fxt.Offering.UnitType = data.UnitScalar
+	fxt.Offering.UnitPrice = data.NewAmount(1)
+	fxt.Offering.SetupPrice = data.NewAmount(2)
+	fxt.Offering.BillingInterval = 2
+
+	fxt.Channel.TotalDeposit = data.NewAmount(10)
+
+	maxSpend := data.NewAmount(5)
+	fxt.Account.MaxChannelSpend = &maxSpend
+
+	sess := data.NewTestSession(fxt.Channel.ID)
+	sess.UnitsUsed = 4
+
+	data.SaveToTestDB(t, db, fxt.Offering, fxt.Channel, fxt.Account, sess)
+	defer data.DeleteFromTestDB(t, db, sess)
+
+	mon, ch := newTestMonitor()
+	defer closeTestMonitor(t, mon, ch)
+
+	called := false
+	mon.post = func(db *reform.DB, channel, pscAddr string,
+		s signer.Signer, amount data.Amount, tls bool, timeout uint) error {
+		called = true
+		return nil
+	}
+
+	delay()
+
+	jobs, err := db.FindAllFrom(data.JobTable, "related_id", fxt.Channel.ID)
+	util.TestExpectResult(t, "Find jobs for channel", nil, err)
+
+	var recs []reform.Record
+	for _, v := range jobs {
+		recs = append(recs, v.(reform.Record))
+	}
+	defer data.DeleteFromTestDB(t, db, recs...)
+
+	if len(jobs) != 1 {
+		t.Fatalf("expected 1 job, but found %d", len(jobs))
+	}
+
+	if called {
+		t.Fatalf("unexpected payment over the cap")
+	}
+}
+
+func TestBatchCheques(t *testing.T) {
+	fxt := newFixture(t, db)
+	defer fxt.Close()
+
+	// The second channel has the same payment receiver.
+	ch2 := data.NewTestChannel(fxt.Account.EthAddr, fxt.Account.EthAddr,
+		fxt.Offering.ID, 0, 10, data.ChannelActive)
+	endp2 := data.NewTestEndpoint(ch2.ID, fxt.TemplateAccess.ID)
+	data.InsertToTestDB(t, db, ch2, endp2)
+	defer data.DeleteFromTestDB(t, db, endp2, ch2)
+
+	mon := NewMonitor(conf.ClientBilling,
+		logger, db, pr, "test-psc-address", sgn)
+
+	mon.post = func(db *reform.DB, channel, pscAddr string,
+		s signer.Signer, amount data.Amount, tls bool, timeout uint) error {
+		t.Fatal("unexpected single cheque")
+		return nil
+	}
+
+	var batches [][]*data.Cheque
+	mon.batch = func(db *reform.DB, cheques []*data.Cheque,
+		pscAddr string, s signer.Signer, tls bool,
+		timeout uint) ([]error, error) {
+		batches = append(batches, cheques)
+		errs := make([]error, len(cheques))
+		for i, v := range cheques {
+			if v.Channel == ch2.ID {
+				errs[i] = fmt.Errorf("some error")
+			}
+		}
+		return errs, nil
+	}
+
+	for _, ch := range []string{fxt.Channel.ID, ch2.ID} {
+		if err := mon.queueCheque(ch, data.NewAmount(5)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mon.sendCheques(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("cheques aren't batched: %v", batches)
+	}
+
+	// Failed cheque doesn't affect the accepted one.
+	expectBalance(t, fxt, 5)
+	expectCheque(t, fxt, data.ChequeAcknowledged, 5)
+
+	var failed data.Cheque
+	if err := db.SelectOneTo(&failed, "WHERE channel = $1 AND status = $2",
+		ch2.ID, data.ChequePending); err != nil {
+		t.Fatal(err)
+	}
+	if failed.Attempts != 1 || failed.LastError == nil {
+		t.Fatalf("failed attempt isn't recorded: %+v", failed)
+	}
+}
+
+func TestStaleCheque(t *testing.T) {
+	fxt := newFixture(t, db)
+	defer fxt.Close()
+
+	fxt.Channel.TotalDeposit = data.NewAmount(10)
+	fxt.Channel.ReceiptBalance = data.NewAmount(3)
+	data.SaveToTestDB(t, db, fxt.Channel)
+
+	mon := NewMonitor(conf.ClientBilling,
+		logger, db, pr, "test-psc-address", sgn)
+
+	// The agent has already accepted a greater balance.
+	mon.post = func(db *reform.DB, channel, pscAddr string,
+		s signer.Signer, amount data.Amount, tls bool, timeout uint) error {
+		return pay.ErrStaleBalance
+	}
+	mon.query = func(db *reform.DB, channel string, s signer.Signer,
+		tls bool, timeout uint) (*pay.BalanceReply, error) {
+		return &pay.BalanceReply{ReceiptBalance: data.NewAmount(7)}, nil
+	}
+
+	if err := mon.queueCheque(fxt.Channel.ID,
+		data.NewAmount(5)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mon.sendCheques(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectCheque(t, fxt, data.ChequeAcknowledged, 5)
+	expectBalance(t, fxt, 7)
+}
+
+func TestResync(t *testing.T) {
+	fxt := newFixture(t, db)
+	defer fxt.Close()
+
+	fxt.Channel.TotalDeposit = data.NewAmount(10)
+	fxt.Channel.ReceiptBalance = data.NewAmount(3)
+	data.SaveToTestDB(t, db, fxt.Channel)
+
+	mon := NewMonitor(conf.ClientBilling,
+		logger, db, pr, "test-psc-address", sgn)
+
+	balance := data.NewAmount(5)
+	mon.query = func(db *reform.DB, channel string, s signer.Signer,
+		tls bool, timeout uint) (*pay.BalanceReply, error) {
+		return &pay.BalanceReply{ReceiptBalance: balance}, nil
+	}
+
+	// The agent has accepted the cheque, but the client has crashed.
+	if err := mon.queueCheque(fxt.Channel.ID,
+		data.NewAmount(5)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := mon.resync(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectBalance(t, fxt, 5)
+	expectCheque(t, fxt, data.ChequeAcknowledged, 5)
+
+	// Lower agent balance doesn't decrease the receipt balance.
+	balance = data.NewAmount(4)
+	if err := mon.resync(); err != nil {
+		t.Fatal(err)
+	}
+	expectBalance(t, fxt, 5)
+
+	// Unavailable agent doesn't prevent resynchronization.
+	mon.query = func(db *reform.DB, channel string, s signer.Signer,
+		tls bool, timeout uint) (*pay.BalanceReply, error) {
+		return nil, fmt.Errorf("some error")
+	}
+	if err := mon.resync(); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestMain(m *testing.M) {
@@ -174,7 +481,8 @@ func TestMain(m *testing.M) {
 	db = data.NewTestDB(conf.DB, logger)
 	queue := job.NewQueue(conf.Job, logger, db, nil)
 	pr = proc.NewProcessor(conf.Proc, queue)
-	pws = &pwStore{}
+	pwd := data.StaticPWDStorage(data.TestPassword)
+	sgn = signer.NewDBSigner(db, &pwd, data.TestToPrivateKey)
 
 	os.Exit(m.Run())
 }
@@ -0,0 +1,171 @@
+// Package budget enforces client spending caps. Caps are set per client
+// account and per channel, nil caps are not limited.
+package budget
+
+import (
+	"errors"
+	"time"
+
+	"gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/data"
+)
+
+// Errors.
+var (
+	ErrDailyCap     = errors.New("daily spending cap is reached")
+	ErrChannelCap   = errors.New("channel spending cap is reached")
+	ErrUnitPriceCap = errors.New("unit price exceeds the cap")
+)
+
+// dailyPeriod is a period daily spending is counted for.
+const dailyPeriod = 24 * time.Hour
+
+// State is a budget state of a client channel.
+type State struct {
+	Channel         string       `json:"channel"`
+	Account         *string      `json:"account"` // Nil if not a client channel.
+	MaxDailySpend   *data.Amount `json:"maxDailySpend"`
+	MaxChannelSpend *data.Amount `json:"maxChannelSpend"` // Strictest of account and channel caps.
+	MaxUnitPrice    *data.Amount `json:"maxUnitPrice"`
+	DailySpend      data.Amount  `json:"dailySpend"` // In all channels of the account.
+	ChannelSpend    data.Amount  `json:"channelSpend"`
+}
+
+// NewState returns a budget state of a channel.
+func NewState(q *reform.Querier, ch *data.Channel) (*State, error) {
+	acc, err := clientAccount(q, ch.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &State{
+		Channel:         ch.ID,
+		MaxChannelSpend: ch.MaxSpend,
+		ChannelSpend:    ch.ReceiptBalance,
+	}
+	if acc == nil {
+		return st, nil
+	}
+
+	st.Account = &acc.ID
+	st.MaxDailySpend = acc.MaxDailySpend
+	st.MaxChannelSpend = stricter(acc.MaxChannelSpend, ch.MaxSpend)
+	st.MaxUnitPrice = acc.MaxUnitPrice
+
+	if st.DailySpend, err = DailySpend(q, ch.Client, ""); err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+// DailySpend returns an amount paid by a client for the last 24 hours.
+// Pending cheques of channels other than a given one are counted as paid.
+func DailySpend(q *reform.Querier,
+	client, except string) (data.Amount, error) {
+	var acked, pending data.Amount
+
+	// Cheques hold total amounts paid in channels.
+	if err := q.QueryRow(`
+		SELECT COALESCE(SUM(amount - prev), 0)
+		  FROM (SELECT cheques.amount, cheques.acknowledged_at,
+		               COALESCE(LAG(cheques.amount) OVER (
+		                   PARTITION BY cheques.channel
+		                   ORDER BY cheques.acknowledged_at), 0) AS prev
+		          FROM cheques
+		               JOIN channels ON channels.id = cheques.channel
+		         WHERE channels.client = $1
+		               AND cheques.status = $2) AS payments
+		 WHERE acknowledged_at >= $3`,
+		client, data.ChequeAcknowledged,
+		time.Now().Add(-dailyPeriod)).Scan(&acked); err != nil {
+		return data.Amount{}, err
+	}
+
+	if err := q.QueryRow(`
+		SELECT COALESCE(SUM(cheques.amount - channels.receipt_balance), 0)
+		  FROM cheques
+		       JOIN channels ON channels.id = cheques.channel
+		 WHERE channels.client = $1
+		       AND channels.id::text <> $2
+		       AND cheques.status = $3
+		       AND cheques.amount > channels.receipt_balance`,
+		client, except, data.ChequePending).Scan(&pending); err != nil {
+		return data.Amount{}, err
+	}
+
+	return acked.Add(pending), nil
+}
+
+// CheckPayment checks whether a client can pay a given total amount in
+// a channel.
+func CheckPayment(q *reform.Querier, ch *data.Channel,
+	offer *data.Offering, amount data.Amount) error {
+	acc, err := clientAccount(q, ch.Client)
+	if err != nil {
+		return err
+	}
+
+	if acc == nil {
+		if ch.MaxSpend != nil && amount.Cmp(*ch.MaxSpend) > 0 {
+			return ErrChannelCap
+		}
+		return nil
+	}
+
+	if err := checkCaps(acc, ch, offer, amount); err != nil {
+		return err
+	}
+
+	if acc.MaxDailySpend == nil {
+		return nil
+	}
+
+	spent, err := DailySpend(q, ch.Client, ch.ID)
+	if err != nil {
+		return err
+	}
+
+	if spent.Add(amount.Sub(ch.ReceiptBalance)).Cmp(
+		*acc.MaxDailySpend) > 0 {
+		return ErrDailyCap
+	}
+
+	return nil
+}
+
+func checkCaps(acc *data.Account, ch *data.Channel,
+	offer *data.Offering, amount data.Amount) error {
+	if acc.MaxUnitPrice != nil &&
+		offer.UnitPrice.Cmp(*acc.MaxUnitPrice) > 0 {
+		return ErrUnitPriceCap
+	}
+
+	max := stricter(acc.MaxChannelSpend, ch.MaxSpend)
+	if max != nil && amount.Cmp(*max) > 0 {
+		return ErrChannelCap
+	}
+
+	return nil
+}
+
+// clientAccount returns an account with a given address, or nil if there
+// is no such account.
+func clientAccount(q *reform.Querier, addr string) (*data.Account, error) {
+	var acc data.Account
+	if err := q.FindOneTo(&acc, "eth_addr", addr); err != nil {
+		if err == reform.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &acc, nil
+}
+
+func stricter(a, b *data.Amount) *data.Amount {
+	if a == nil || (b != nil && b.Cmp(*a) < 0) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,197 @@
+// +build !noclientbudgettest
+
+package budget
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/util"
+)
+
+var (
+	conf struct {
+		DB  *data.DBConfig
+		Log *util.LogConfig
+	}
+
+	db *reform.DB
+)
+
+func newFixture(t *testing.T) *data.TestFixture {
+	fxt := data.NewTestFixture(t, db)
+	fxt.Channel.Client = fxt.Account.EthAddr
+	data.SaveToTestDB(t, db, fxt.Channel)
+	return fxt
+}
+
+func newAmount(v uint64) *data.Amount {
+	a := data.NewAmount(v)
+	return &a
+}
+
+func newCheque(ch string, amount uint64, status string,
+	acked time.Time) *data.Cheque {
+	cheque := &data.Cheque{
+		ID:          util.NewUUID(),
+		Channel:     ch,
+		Amount:      data.NewAmount(amount),
+		Status:      status,
+		NextAttempt: acked,
+		CreatedAt:   acked,
+	}
+	if status == data.ChequeAcknowledged {
+		cheque.AcknowledgedAt = &acked
+	}
+	return cheque
+}
+
+func TestCheckPaymentCaps(t *testing.T) {
+	fxt := newFixture(t)
+	defer fxt.Close()
+
+	price, _ := fxt.Offering.UnitPrice.Uint64()
+
+	for _, v := range []struct {
+		name       string
+		maxChannel *data.Amount
+		maxSpend   *data.Amount
+		maxPrice   *data.Amount
+		amount     uint64
+		err        error
+	}{
+		{"no caps", nil, nil, nil, 100, nil},
+		{"account channel cap", newAmount(50), nil, nil, 51,
+			ErrChannelCap},
+		{"within account channel cap", newAmount(50), nil, nil, 50,
+			nil},
+		{"channel cap", newAmount(50), newAmount(30), nil, 31,
+			ErrChannelCap},
+		{"within channel cap", newAmount(50), newAmount(30), nil, 30,
+			nil},
+		{"unit price cap", nil, nil, newAmount(price - 1), 1,
+			ErrUnitPriceCap},
+		{"within unit price cap", nil, nil, newAmount(price), 1, nil},
+	} {
+		fxt.Account.MaxChannelSpend = v.maxChannel
+		fxt.Account.MaxUnitPrice = v.maxPrice
+		fxt.Channel.MaxSpend = v.maxSpend
+		data.SaveToTestDB(t, db, fxt.Account, fxt.Channel)
+
+		err := CheckPayment(db.Querier, fxt.Channel, fxt.Offering,
+			data.NewAmount(v.amount))
+		if err != v.err {
+			t.Errorf("%s: unexpected error: %v", v.name, err)
+		}
+	}
+}
+
+func TestDailySpend(t *testing.T) {
+	fxt := newFixture(t)
+	defer fxt.Close()
+
+	ch2 := data.NewTestChannel(fxt.Account.EthAddr, fxt.Account.EthAddr,
+		fxt.Offering.ID, 5, 100, data.ChannelActive)
+	data.InsertToTestDB(t, db, ch2)
+	defer data.DeleteFromTestDB(t, db, ch2)
+
+	now := time.Now()
+	fxt.Channel.ReceiptBalance = data.NewAmount(30)
+	data.SaveToTestDB(t, db, fxt.Channel)
+
+	// 20 is paid in the first channel for the last day, 7 is pending in
+	// the second one.
+	data.InsertToTestDB(t, db,
+		newCheque(fxt.Channel.ID, 10, data.ChequeAcknowledged,
+			now.Add(-25*time.Hour)),
+		newCheque(fxt.Channel.ID, 25, data.ChequeAcknowledged,
+			now.Add(-time.Hour)),
+		newCheque(fxt.Channel.ID, 30, data.ChequeAcknowledged,
+			now.Add(-time.Minute)),
+		newCheque(ch2.ID, 12, data.ChequePending, now))
+
+	for _, v := range []struct {
+		except string
+		spent  uint64
+	}{
+		{"", 27},
+		{ch2.ID, 20},
+	} {
+		spent, err := DailySpend(db.Querier, fxt.Account.EthAddr,
+			v.except)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if spent.Cmp(data.NewAmount(v.spent)) != 0 {
+			t.Fatalf("daily spend except '%s': %s, wanted: %d",
+				v.except, spent, v.spent)
+		}
+	}
+
+	fxt.Account.MaxDailySpend = newAmount(30)
+	data.SaveToTestDB(t, db, fxt.Account)
+
+	for _, v := range []struct {
+		amount uint64
+		err    error
+	}{
+		{33, nil},
+		{34, ErrDailyCap},
+	} {
+		err := CheckPayment(db.Querier, fxt.Channel, fxt.Offering,
+			data.NewAmount(v.amount))
+		if err != v.err {
+			t.Fatalf("payment of %d: unexpected error: %v",
+				v.amount, err)
+		}
+	}
+
+	st, err := NewState(db.Querier, fxt.Channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Account == nil || *st.Account != fxt.Account.ID ||
+		st.DailySpend.Cmp(data.NewAmount(27)) != 0 ||
+		st.ChannelSpend.Cmp(data.NewAmount(30)) != 0 ||
+		st.MaxDailySpend == nil ||
+		st.MaxDailySpend.Cmp(data.NewAmount(30)) != 0 {
+		t.Fatalf("wrong budget state: %+v", st)
+	}
+}
+
+func TestNotClientChannel(t *testing.T) {
+	fxt := data.NewTestFixture(t, db)
+	defer fxt.Close()
+
+	fxt.Channel.MaxSpend = newAmount(10)
+
+	st, err := NewState(db.Querier, fxt.Channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Account != nil || st.MaxChannelSpend == nil {
+		t.Fatalf("wrong budget state: %+v", st)
+	}
+
+	err = CheckPayment(db.Querier, fxt.Channel, fxt.Offering,
+		data.NewAmount(11))
+	if err != ErrChannelCap {
+		t.Fatalf("channel cap isn't enforced: %v", err)
+	}
+}
+
+func TestMain(m *testing.M) {
+	conf.DB = data.NewDBConfig()
+	conf.Log = util.NewLogConfig()
+	util.ReadTestConfig(&conf)
+
+	logger := util.NewTestLogger(conf.Log)
+	db = data.NewTestDB(conf.DB, logger)
+	defer data.CloseDB(db)
+
+	os.Exit(m.Run())
+}
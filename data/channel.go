@@ -0,0 +1,62 @@
+package data
+
+import (
+	"time"
+
+	"gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/util"
+)
+
+// InsertChannel inserts a new channel and records its initial statuses.
+func InsertChannel(tx *reform.TX, ch *Channel, cause string,
+	job *string) error {
+	if err := tx.Insert(ch); err != nil {
+		return err
+	}
+
+	return tx.Insert(&ChannelEvent{
+		ID:               util.NewUUID(),
+		Channel:          ch.ID,
+		NewChannelStatus: ch.ChannelStatus,
+		NewServiceStatus: ch.ServiceStatus,
+		Cause:            cause,
+		Job:              job,
+		CreatedAt:        time.Now(),
+	})
+}
+
+// UpdateChannelStatus sets channel and service statuses of a channel and
+// records the transition. Nothing is done if the statuses are not changed.
+func UpdateChannelStatus(tx *reform.TX, ch *Channel, channelStatus,
+	serviceStatus, cause string, job *string) error {
+	if ch.ChannelStatus == channelStatus &&
+		ch.ServiceStatus == serviceStatus {
+		return nil
+	}
+
+	oldChannelStatus, oldServiceStatus := ch.ChannelStatus, ch.ServiceStatus
+	now := time.Now()
+
+	if ch.ServiceStatus != serviceStatus {
+		ch.ServiceChangedTime = &now
+	}
+	ch.ChannelStatus = channelStatus
+	ch.ServiceStatus = serviceStatus
+
+	if err := tx.Update(ch); err != nil {
+		return err
+	}
+
+	return tx.Insert(&ChannelEvent{
+		ID:               util.NewUUID(),
+		Channel:          ch.ID,
+		OldChannelStatus: &oldChannelStatus,
+		NewChannelStatus: channelStatus,
+		OldServiceStatus: &oldServiceStatus,
+		NewServiceStatus: serviceStatus,
+		Cause:            cause,
+		Job:              job,
+		CreatedAt:        now,
+	})
+}
@@ -0,0 +1,15 @@
+-- Adds transaction receipts and statuses of failed and dropped transactions.
+
+-- Enum values can not be added inside a transaction block.
+ALTER TYPE tx_status ADD VALUE 'failed' AFTER 'uncle';
+ALTER TYPE tx_status ADD VALUE 'dropped' AFTER 'failed';
+
+BEGIN;
+
+ALTER TABLE eth_txs
+    ADD COLUMN block_number bigint
+        CONSTRAINT positive_block_number CHECK (eth_txs.block_number > 0),
+    ADD COLUMN gas_used bigint,
+    ADD COLUMN checked timestamp with time zone;
+
+COMMIT;
@@ -0,0 +1,12 @@
+-- Adds replacements of sent transactions.
+
+-- Enum values can not be added inside a transaction block.
+ALTER TYPE tx_status ADD VALUE 'replaced' AFTER 'dropped';
+ALTER TYPE related_type ADD VALUE 'transaction' AFTER 'account';
+
+BEGIN;
+
+ALTER TABLE eth_txs
+    ADD COLUMN replaced_by uuid REFERENCES eth_txs(id);
+
+COMMIT;
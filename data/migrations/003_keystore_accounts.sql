@@ -0,0 +1,7 @@
+-- Allows accounts which keys are kept in a signer keystore.
+
+BEGIN;
+
+ALTER TABLE accounts ALTER COLUMN private_key DROP NOT NULL;
+
+COMMIT;
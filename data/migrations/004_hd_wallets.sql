@@ -0,0 +1,21 @@
+-- Adds hd wallets accounts are derived from.
+
+BEGIN;
+
+CREATE TABLE hd_wallets (
+    id uuid PRIMARY KEY,
+    fingerprint eth_addr NOT NULL
+        CONSTRAINT unique_hd_wallet_fingerprint UNIQUE,
+    base_path text NOT NULL,
+    created_at timestamp with time zone NOT NULL
+);
+
+ALTER TABLE accounts
+    ADD COLUMN hd_wallet uuid REFERENCES hd_wallets(id),
+    ADD COLUMN hd_index bigint
+        CONSTRAINT positive_hd_index CHECK (accounts.hd_index >= 0),
+    ADD CONSTRAINT unique_hd_index UNIQUE (hd_wallet, hd_index),
+    ADD CONSTRAINT hd_index_with_wallet
+        CHECK ((hd_wallet IS NULL) = (hd_index IS NULL));
+
+COMMIT;
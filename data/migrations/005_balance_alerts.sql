@@ -0,0 +1,16 @@
+-- Adds account balance alert thresholds and the balance checker job creator.
+
+-- Enum values can not be added inside a transaction block.
+ALTER TYPE job_creator ADD VALUE 'balance_checker' AFTER 'billing_checker';
+
+BEGIN;
+
+ALTER TABLE accounts
+    ADD COLUMN min_eth_balance bigint
+        CONSTRAINT positive_min_eth_balance CHECK (accounts.min_eth_balance >= 0),
+    ADD COLUMN min_ptc_balance bigint
+        CONSTRAINT positive_min_ptc_balance CHECK (accounts.min_ptc_balance >= 0),
+    ADD COLUMN min_psc_balance bigint
+        CONSTRAINT positive_min_psc_balance CHECK (accounts.min_psc_balance >= 0);
+
+COMMIT;
@@ -0,0 +1,13 @@
+-- Adds audit of private key exports.
+
+BEGIN;
+
+CREATE TABLE key_exports (
+    id uuid PRIMARY KEY,
+    account uuid NOT NULL,
+    eth_addr eth_addr NOT NULL,
+    remote_addr text NOT NULL,
+    exported_at timestamp with time zone NOT NULL
+);
+
+COMMIT;
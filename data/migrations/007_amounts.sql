@@ -0,0 +1,44 @@
+-- Converts balance, price and payment columns to arbitrary-precision amounts.
+
+BEGIN;
+
+CREATE DOMAIN amount AS numeric(78)
+    CONSTRAINT positive_amount CHECK (VALUE >= 0);
+
+-- Converts a big-endian unsigned integer to numeric.
+CREATE FUNCTION pg_temp.bytea_to_numeric(b bytea) RETURNS numeric AS $$
+DECLARE
+    r numeric := 0;
+BEGIN
+    FOR i IN 0 .. length(b) - 1 LOOP
+        r := r * 256 + get_byte(b, i);
+    END LOOP;
+    RETURN r;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE accounts
+    DROP CONSTRAINT positive_ptc_balance,
+    DROP CONSTRAINT positive_psc_balance,
+    DROP CONSTRAINT positive_min_eth_balance,
+    DROP CONSTRAINT positive_min_ptc_balance,
+    DROP CONSTRAINT positive_min_psc_balance,
+    ALTER COLUMN ptc_balance TYPE amount,
+    ALTER COLUMN psc_balance TYPE amount,
+    ALTER COLUMN eth_balance TYPE amount USING
+        pg_temp.bytea_to_numeric(decode(trim(eth_balance), 'base64')),
+    ALTER COLUMN min_eth_balance TYPE amount,
+    ALTER COLUMN min_ptc_balance TYPE amount,
+    ALTER COLUMN min_psc_balance TYPE amount;
+
+ALTER TABLE offerings
+    ALTER COLUMN setup_price TYPE amount,
+    ALTER COLUMN unit_price TYPE amount;
+
+ALTER TABLE channels
+    DROP CONSTRAINT positive_total_deposit,
+    DROP CONSTRAINT positive_receipt_balance,
+    ALTER COLUMN total_deposit TYPE amount,
+    ALTER COLUMN receipt_balance TYPE amount;
+
+COMMIT;
@@ -0,0 +1,17 @@
+-- Adds channel status transitions history.
+
+BEGIN;
+
+CREATE TABLE channel_events (
+    id uuid PRIMARY KEY,
+    channel uuid NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    old_channel_status chan_status,
+    new_channel_status chan_status NOT NULL,
+    old_service_status svc_status,
+    new_service_status svc_status NOT NULL,
+    cause job_creator NOT NULL,
+    job uuid,
+    created_at timestamp with time zone NOT NULL
+);
+
+COMMIT;
@@ -0,0 +1,26 @@
+-- Adds client payment cheques outbox.
+
+BEGIN;
+
+CREATE TYPE cheque_status AS ENUM (
+    'pending',
+    'acknowledged',
+    'superseded'
+);
+
+CREATE TABLE cheques (
+    id uuid PRIMARY KEY,
+    channel uuid NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    amount amount NOT NULL,
+    status cheque_status NOT NULL,
+    attempts int NOT NULL,
+    next_attempt timestamp with time zone NOT NULL,
+    last_error text,
+    created_at timestamp with time zone NOT NULL,
+    acknowledged_at timestamp with time zone
+);
+
+CREATE UNIQUE INDEX cheques_pending_channel ON cheques(channel)
+    WHERE status = 'pending';
+
+COMMIT;
@@ -0,0 +1,13 @@
+-- Adds client spending caps.
+
+BEGIN;
+
+ALTER TABLE accounts
+    ADD COLUMN max_daily_spend amount,
+    ADD COLUMN max_channel_spend amount,
+    ADD COLUMN max_unit_price amount;
+
+ALTER TABLE channels
+    ADD COLUMN max_spend amount;
+
+COMMIT;
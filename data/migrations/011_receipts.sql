@@ -0,0 +1,16 @@
+-- Adds history of balance proofs accepted from clients.
+
+BEGIN;
+
+CREATE TABLE receipts (
+    id uuid PRIMARY KEY,
+    channel uuid NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    balance amount NOT NULL,
+    signature text NOT NULL,
+    client_ip text NOT NULL,
+    received_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX receipts_channel_received_at ON receipts(channel, received_at);
+
+COMMIT;
@@ -0,0 +1,11 @@
+-- Adds agent closing signatures requested by clients through the payment
+-- server.
+
+-- Enum values can not be added inside a transaction block.
+ALTER TYPE job_creator ADD VALUE 'pay_server';
+
+BEGIN;
+
+ALTER TABLE channels ADD COLUMN closing_signature text;
+
+COMMIT;
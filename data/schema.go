@@ -12,14 +12,41 @@ type Account struct {
 	ID               string     `json:"id" reform:"id,pk"`
 	EthAddr          string     `json:"ethAddr" reform:"eth_addr"`
 	PublicKey        string     `json:"-" reform:"public_key"`
-	PrivateKey       string     `json:"-" reform:"private_key"`
+	PrivateKey       *string    `json:"-" reform:"private_key"`
 	IsDefault        bool       `json:"isDefault" reform:"is_default"`
 	InUse            bool       `json:"inUse" reform:"in_use"`
 	Name             string     `json:"name" reform:"name"`
-	PTCBalance       uint64     `json:"ptcBalance" reform:"ptc_balance"`
-	PSCBalance       uint64     `json:"psc_balance" reform:"psc_balance"`
-	EthBalance       B64BigInt  `json:"ethBalance" reform:"eth_balance"`
+	PTCBalance       Amount     `json:"ptcBalance" reform:"ptc_balance"`
+	PSCBalance       Amount     `json:"psc_balance" reform:"psc_balance"`
+	EthBalance       Amount     `json:"ethBalance" reform:"eth_balance"`
 	LastBalanceCheck *time.Time `json:"lastBalanceCheck" reform:"last_balance_check"`
+	MinEthBalance    *Amount    `json:"minEthBalance" reform:"min_eth_balance"`
+	MinPTCBalance    *Amount    `json:"minPtcBalance" reform:"min_ptc_balance"`
+	MinPSCBalance    *Amount    `json:"minPscBalance" reform:"min_psc_balance"`
+	MaxDailySpend    *Amount    `json:"maxDailySpend" reform:"max_daily_spend"`
+	MaxChannelSpend  *Amount    `json:"maxChannelSpend" reform:"max_channel_spend"`
+	MaxUnitPrice     *Amount    `json:"maxUnitPrice" reform:"max_unit_price"`
+	HDWallet         *string    `json:"hdWallet" reform:"hd_wallet"`
+	HDIndex          *uint32    `json:"hdIndex" reform:"hd_index"`
+}
+
+// HDWallet is a BIP-39 seed accounts are derived from.
+//reform:hd_wallets
+type HDWallet struct {
+	ID          string    `json:"id" reform:"id,pk"`
+	Fingerprint string    `json:"fingerprint" reform:"fingerprint"`
+	BasePath    string    `json:"basePath" reform:"base_path"`
+	CreatedAt   time.Time `json:"createdAt" reform:"created_at"`
+}
+
+// KeyExport is an audit record of an account private key export.
+//reform:key_exports
+type KeyExport struct {
+	ID         string    `json:"id" reform:"id,pk"`
+	Account    string    `json:"account" reform:"account"`
+	EthAddr    string    `json:"ethAddr" reform:"eth_addr"`
+	RemoteAddr string    `json:"remoteAddr" reform:"remote_addr"`
+	ExportedAt time.Time `json:"exportedAt" reform:"exported_at"`
 }
 
 // User is party in distributed trade.
@@ -121,8 +148,8 @@ type Offering struct {
 	UnitName           string  `json:"unitName" reform:"unit_name" validate:"required"` // Like megabytes, minutes, etc.
 	UnitType           string  `json:"unitType" reform:"unit_type" validate:"required"`
 	BillingType        string  `json:"billingType" reform:"billing_type" validate:"required"`
-	SetupPrice         uint64  `json:"setupPrice" reform:"setup_price"` // Setup fee.
-	UnitPrice          uint64  `json:"unitPrice" reform:"unit_price"`
+	SetupPrice         Amount  `json:"setupPrice" reform:"setup_price"` // Setup fee.
+	UnitPrice          Amount  `json:"unitPrice" reform:"unit_price"`
 	MinUnits           uint64  `json:"minUnits" reform:"min_units" validate:"required"`
 	MaxUnit            *uint64 `json:"maxUnit" reform:"max_unit"`
 	BillingInterval    uint    `json:"billingInterval" reform:"billing_interval" validate:"required"` // Every unit number to be paid.
@@ -164,12 +191,62 @@ type Channel struct {
 	ChannelStatus      string     `json:"channelStatus" reform:"channel_status"` // Status related to blockchain.
 	ServiceStatus      string     `json:"serviceStatus" reform:"service_status"`
 	ServiceChangedTime *time.Time `json:"serviceChangedTime" reform:"service_changed_time"`
-	TotalDeposit       uint64     `json:"totalDeposit" reform:"total_deposit"`
+	TotalDeposit       Amount     `json:"totalDeposit" reform:"total_deposit"`
 	Salt               uint64     `json:"-" reform:"salt"`
 	Username           *string    `json:"-" reform:"username"`
 	Password           string     `json:"-" reform:"password"`
-	ReceiptBalance     uint64     `json:"-" reform:"receipt_balance"`   // Last payment.
+	ReceiptBalance     Amount     `json:"-" reform:"receipt_balance"`   // Last payment.
 	ReceiptSignature   *string    `json:"-" reform:"receipt_signature"` // Last payment's signature.
+	MaxSpend           *Amount    `json:"maxSpend" reform:"max_spend"`  // Client spending cap.
+	ClosingSignature   *string    `json:"-" reform:"closing_signature"` // Agent's closing signature for the receipt balance.
+}
+
+// ChannelEvent is a channel status transition. Old statuses are nil for
+// a new channel.
+//reform:channel_events
+type ChannelEvent struct {
+	ID               string    `json:"id" reform:"id,pk"`
+	Channel          string    `json:"channel" reform:"channel"`
+	OldChannelStatus *string   `json:"oldChannelStatus" reform:"old_channel_status"`
+	NewChannelStatus string    `json:"newChannelStatus" reform:"new_channel_status"`
+	OldServiceStatus *string   `json:"oldServiceStatus" reform:"old_service_status"`
+	NewServiceStatus string    `json:"newServiceStatus" reform:"new_service_status"`
+	Cause            string    `json:"cause" reform:"cause"`
+	Job              *string   `json:"job" reform:"job"`
+	CreatedAt        time.Time `json:"createdAt" reform:"created_at"`
+}
+
+// Receipt is a balance proof accepted from a client.
+//reform:receipts
+type Receipt struct {
+	ID         string    `json:"id" reform:"id,pk"`
+	Channel    string    `json:"channel" reform:"channel"`
+	Balance    Amount    `json:"balance" reform:"balance"`
+	Signature  string    `json:"signature" reform:"signature"`
+	ClientIP   string    `json:"clientIP" reform:"client_ip"`
+	ReceivedAt time.Time `json:"receivedAt" reform:"received_at"`
+}
+
+// Cheque statuses.
+const (
+	ChequePending      = "pending"
+	ChequeAcknowledged = "acknowledged"
+	ChequeSuperseded   = "superseded"
+)
+
+// Cheque is a payment cheque of a client channel. A channel has at most one
+// pending cheque.
+//reform:cheques
+type Cheque struct {
+	ID             string     `json:"id" reform:"id,pk"`
+	Channel        string     `json:"channel" reform:"channel"`
+	Amount         Amount     `json:"amount" reform:"amount"`
+	Status         string     `json:"status" reform:"status"`
+	Attempts       uint       `json:"attempts" reform:"attempts"`
+	NextAttempt    time.Time  `json:"nextAttempt" reform:"next_attempt"`
+	LastError      *string    `json:"lastError" reform:"last_error"`
+	CreatedAt      time.Time  `json:"createdAt" reform:"created_at"`
+	AcknowledgedAt *time.Time `json:"acknowledgedAt" reform:"acknowledged_at"`
 }
 
 // Session is a client session.
@@ -211,6 +288,13 @@ type Setting struct {
 	Name        string  `json:"name" reform:"name"`
 }
 
+// Setting keys.
+const (
+	// SettingNetworkFee is the current network fee of the service
+	// contract, it is updated from the blockchain only.
+	SettingNetworkFee = "psc.network.fee"
+)
+
 // Endpoint messages is info about service access.
 //reform:endpoints
 type Endpoint struct {
@@ -238,8 +322,10 @@ type EndpointUI struct {
 const (
 	JobUser           = "user"
 	JobBillingChecker = "billing_checker"
+	JobBalanceChecker = "balance_checker"
 	JobBCMonitor      = "bc_monitor"
 	JobTask           = "task"
+	JobPayServer      = "pay_server"
 )
 
 // Job statuses.
@@ -252,18 +338,22 @@ const (
 
 // Job related object types.
 const (
-	JobOfferring = "offering"
-	JobChannel   = "channel"
-	JobEndpoint  = "endpoint"
-	JobAccount   = "account"
+	JobOfferring   = "offering"
+	JobChannel     = "channel"
+	JobEndpoint    = "endpoint"
+	JobAccount     = "account"
+	JobTransaction = "transaction"
 )
 
 // Transaction statuses.
 const (
-	TxUnsent = "unsent"
-	TxSent   = "sent"
-	TxMined  = "mined"
-	TxUncle  = "uncle"
+	TxUnsent   = "unsent"
+	TxSent     = "sent"
+	TxMined    = "mined"
+	TxUncle    = "uncle"
+	TxFailed   = "failed"
+	TxDropped  = "dropped"
+	TxReplaced = "replaced"
 )
 
 // Job types.
@@ -276,6 +366,7 @@ const (
 	JobClientAfterUncooperativeCloseRequest = "clientAfterUncooperativeCloseRequest"
 	JobClientPreUncooperativeClose          = "clientPreUncooperativeClose"
 	JobClientAfterUncooperativeClose        = "clientAfterUncooperativeClose"
+	JobClientPreCooperativeClose            = "clientPreCooperativeClose"
 	JobClientAfterCooperativeClose          = "clientAfterCooperativeClose"
 	JobClientPreServiceTerminate            = "clientPreServiceTerminate"
 	JobClientAfterServiceTerminate          = "clientAfterServiceTerminate"
@@ -303,12 +394,33 @@ const (
 	JobPreAccountReturnBalance              = "preAccountReturnBalance"
 	JobAfterAccountReturnBalance            = "afterAccountReturnBalance"
 	JobAccountAddCheckBalance               = "addCheckBalance"
+	JobPreAccountWithdrawETH                = "preAccountWithdrawETH"
+	JobPreAccountWithdrawPTC                = "preAccountWithdrawPTC"
+	JobPreAccountSetNetworkFee              = "preAccountSetNetworkFee"
+	JobAccountUpdateNetworkFee              = "accountUpdateNetworkFee"
+	JobSpeedUpTransaction                   = "speedUpTransaction"
+	JobCancelTransaction                    = "cancelTransaction"
 )
 
 // JobBalanceData is a data required for transfer jobs.
 type JobBalanceData struct {
 	GasPrice uint64
-	Amount   uint
+	Amount   Amount
+}
+
+// JobWithdrawData is a data required for jobs withdrawing funds from
+// an account to an external address. To is a base64 encoded address.
+type JobWithdrawData struct {
+	GasPrice uint64
+	Amount   Amount
+	To       string
+}
+
+// JobNetworkFeeData is a data required for jobs setting a network fee of
+// the service contract.
+type JobNetworkFeeData struct {
+	GasPrice   uint64
+	NetworkFee uint32
 }
 
 // JobPublishData is a data required for blockchain publish jobs.
@@ -316,6 +428,17 @@ type JobPublishData struct {
 	GasPrice uint64
 }
 
+// JobCloseData is a data required for client jobs closing channels.
+type JobCloseData struct {
+	GasPrice uint64
+}
+
+// JobReplaceTxData is a data required for jobs replacing sent transactions.
+// Zero gas price means the minimal price accepted for a replacement.
+type JobReplaceTxData struct {
+	GasPrice uint64
+}
+
 // Job is a task within persistent queue.
 //reform:jobs
 type Job struct {
@@ -334,20 +457,24 @@ type Job struct {
 // EthTx is an ethereum transaction
 //reform:eth_txs
 type EthTx struct {
-	ID          string    `reform:"id,pk" json:"id"`
-	Hash        string    `reform:"hash" json:"hash"`
-	Method      string    `reform:"method" json:"method"`
-	Status      string    `reform:"status" json:"status"`
-	JobID       *string   `reform:"job" json:"jobID"`
-	Issued      time.Time `reform:"issued" json:"issued"`
-	AddrFrom    string    `reform:"addr_from" json:"addrFrom"`
-	AddrTo      string    `reform:"addr_to" json:"addrTo"`
-	Nonce       *string   `reform:"nonce" json:"nonce"`
-	GasPrice    uint64    `reform:"gas_price" json:"gasPrice"`
-	Gas         uint64    `reform:"gas" json:"gas"`
-	TxRaw       []byte    `reform:"tx_raw" json:"txRaw"`
-	RelatedType string    `reform:"related_type" json:"relatedType"`
-	RelatedID   string    `reform:"related_id" json:"relatedID"`
+	ID          string     `reform:"id,pk" json:"id"`
+	Hash        string     `reform:"hash" json:"hash"`
+	Method      string     `reform:"method" json:"method"`
+	Status      string     `reform:"status" json:"status"`
+	JobID       *string    `reform:"job" json:"jobID"`
+	Issued      time.Time  `reform:"issued" json:"issued"`
+	AddrFrom    string     `reform:"addr_from" json:"addrFrom"`
+	AddrTo      string     `reform:"addr_to" json:"addrTo"`
+	Nonce       *string    `reform:"nonce" json:"nonce"`
+	GasPrice    uint64     `reform:"gas_price" json:"gasPrice"`
+	Gas         uint64     `reform:"gas" json:"gas"`
+	TxRaw       []byte     `reform:"tx_raw" json:"txRaw"`
+	RelatedType string     `reform:"related_type" json:"relatedType"`
+	RelatedID   string     `reform:"related_id" json:"relatedID"`
+	BlockNumber *uint64    `reform:"block_number" json:"blockNumber"`
+	GasUsed     *uint64    `reform:"gas_used" json:"gasUsed"`
+	Checked     *time.Time `reform:"checked" json:"checked"`
+	ReplacedBy  *string    `reform:"replaced_by" json:"replacedBy"`
 }
 
 // EthLog is an ethereum log entry.
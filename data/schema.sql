@@ -27,6 +27,10 @@ CREATE DOMAIN bcrypt_hash AS char(80);
 -- Etehereum address
 CREATE DOMAIN eth_addr AS char(28);
 
+-- Token or ether (in WEI) amount up to uint256.
+CREATE DOMAIN amount AS numeric(78)
+    CONSTRAINT positive_amount CHECK (VALUE >= 0);
+
 -- Service operational status.
 CREATE TYPE svc_status AS ENUM (
     'pending', -- Service is still not fully setup and cannot be used. E.g. waiting for authentication message/endpoint message.
@@ -67,15 +71,20 @@ CREATE TYPE tx_status AS ENUM (
     'unsent', -- saved in DB, but not sent
     'sent', -- sent w/o error to eth node
     'mined', -- tx mined
-    'uncle' -- tx is went to uncle block
+    'uncle', -- tx is went to uncle block
+    'failed', -- tx mined, but reverted
+    'dropped', -- tx disappeared from eth node w/o being mined
+    'replaced' -- tx replaced by another one with the same nonce
 );
 
 -- Job creator.
 CREATE TYPE job_creator AS ENUM (
     'user', -- by user through UI
     'billing_checker', -- by billing checker procedure
+    'balance_checker', -- by account balance checker
     'bc_monitor', -- by blockchain monitor
-    'task' -- by another task
+    'task', -- by another task
+    'pay_server' -- by payment server on a client request
 );
 
 -- Job status.
@@ -86,12 +95,20 @@ CREATE TYPE job_status AS ENUM (
     'canceled' -- canceled
 );
 
+-- Cheque statuses.
+CREATE TYPE cheque_status AS ENUM (
+    'pending', -- to be sent to agent
+    'acknowledged', -- accepted by agent
+    'superseded' -- replaced by a cheque for a greater amount
+);
+
 -- Job related object types.
 CREATE TYPE related_type AS ENUM (
     'offering', -- service offering
     'channel', -- state channel
     'endpoint', -- service endpoint
-    'account' -- for transfer and approve jobs
+    'account', -- for transfer and approve jobs
+    'transaction' -- for jobs replacing sent transactions
 );
 
 CREATE TABLE settings (
@@ -102,26 +119,59 @@ CREATE TABLE settings (
       CONSTRAINT unique_setting_name UNIQUE
 );
 
+-- HD wallets are BIP-39 seeds accounts can be derived from.
+-- Mnemonics are not stored, accounts are restored from them using
+-- stored derivation paths.
+CREATE TABLE hd_wallets (
+    id uuid PRIMARY KEY,
+    fingerprint eth_addr NOT NULL -- address of master key
+        CONSTRAINT unique_hd_wallet_fingerprint UNIQUE,
+    base_path text NOT NULL, -- BIP-44 derivation path without address index
+    created_at timestamp with time zone NOT NULL
+);
+
 -- Accounts are ethereum accounts.
 -- Accounts used to perform Client and/or Agent operations.
 CREATE TABLE accounts (
     id uuid PRIMARY KEY,
     eth_addr eth_addr NOT NULL, -- ethereum address
     public_key text NOT NULL,
-    private_key text NOT NULL,
+    private_key text, -- null for keys kept in a signer keystore
     is_default boolean NOT NULL DEFAULT FALSE, -- default account
     in_use boolean NOT NULL DEFAULT TRUE, -- this account is in use or not
     name varchar(30) NOT NULL -- display name
         CONSTRAINT unique_account_name UNIQUE,
 
-    ptc_balance bigint NOT NULL -- PTC balance
-        CONSTRAINT positive_ptc_balance CHECK (accounts.ptc_balance >= 0),
+    ptc_balance amount NOT NULL, -- PTC balance
+    psc_balance amount NOT NULL, -- PSC balance
+    eth_balance amount NOT NULL, -- ethereum balance in WEI
+    last_balance_check timestamp with time zone, -- time when balance was checked
+
+    -- Balance alert thresholds, nulls mean default ones.
+    min_eth_balance amount, -- in WEI
+    min_ptc_balance amount,
+    min_psc_balance amount,
 
-    psc_balance bigint NOT NULL -- PSC balance
-        CONSTRAINT positive_psc_balance CHECK (accounts.psc_balance >= 0),
+    -- Client spending caps, nulls mean no caps.
+    max_daily_spend amount, -- paid in all channels for the last 24 hours
+    max_channel_spend amount, -- paid in a channel
+    max_unit_price amount, -- unit price of offerings to pay for
 
-    eth_balance char(32) NOT NULL, -- ethereum balance up to 99999 ETH in WEI. Ethereum's uint192 in base64 (RFC-4648).
-    last_balance_check timestamp with time zone -- time when balance was checked
+    hd_wallet uuid REFERENCES hd_wallets(id), -- wallet of derived account
+    hd_index bigint -- address index in derivation path
+        CONSTRAINT positive_hd_index CHECK (accounts.hd_index >= 0),
+
+    CONSTRAINT unique_hd_index UNIQUE (hd_wallet, hd_index),
+    CONSTRAINT hd_index_with_wallet CHECK ((hd_wallet IS NULL) = (hd_index IS NULL))
+);
+
+-- Audit of private key exports. Records are kept after accounts are deleted.
+CREATE TABLE key_exports (
+    id uuid PRIMARY KEY,
+    account uuid NOT NULL, -- exported account
+    eth_addr eth_addr NOT NULL, -- address of exported account
+    remote_addr text NOT NULL, -- address of requesting party
+    exported_at timestamp with time zone NOT NULL
 );
 
 -- Users are external party in distributed trade.
@@ -176,8 +226,8 @@ CREATE TABLE offerings (
     unit_name varchar(10) NOT NULL, -- like megabytes, minutes, etc
     unit_type unit_type NOT NULL, -- type of unit. Time or material.
     billing_type bill_type NOT NULL, -- prepaid/postpaid
-    setup_price bigint NOT NULL, -- setup fee
-    unit_price bigint NOT NULL,
+    setup_price amount NOT NULL, -- setup fee
+    unit_price amount NOT NULL,
     min_units bigint NOT NULL -- used to calculate min required deposit
         CONSTRAINT positive_min_units CHECK (offerings.min_units >= 0),
 
@@ -215,16 +265,18 @@ CREATE TABLE channels (
     channel_status chan_status NOT NULL, -- status related to blockchain
     service_status svc_status NOT NULL, -- operational status of service
     service_changed_time timestamp with time zone, -- timestamp, when service status changed. Used in aging scenarios. Specifically in suspend -> terminating scenario.
-    total_deposit bigint NOT NULL -- total deposit after all top-ups
-        CONSTRAINT positive_total_deposit CHECK (channels.total_deposit >= 0),
+    total_deposit amount NOT NULL, -- total deposit after all top-ups
 
     salt bigint, -- password salt
     username varchar(100), -- optional username, that can identify service instead of state channel id
     password bcrypt_hash,
-    receipt_balance bigint NOT NULL -- last payment amount received
-        CONSTRAINT positive_receipt_balance CHECK (channels.receipt_balance >= 0),
+    receipt_balance amount NOT NULL, -- last payment amount received
 
-    receipt_signature text -- signature corresponding to last payment
+    receipt_signature text, -- signature corresponding to last payment
+
+    max_spend amount, -- client spending cap of the channel, null means no cap
+
+    closing_signature text -- agent closing signature for receipt_balance, no payments are accepted after it
 );
 
 -- Client sessions.
@@ -283,6 +335,48 @@ CREATE TABLE jobs (
     data json -- information required for standalone jobs like token transfers
 );
 
+-- Channel status transitions. Records are never updated.
+CREATE TABLE channel_events (
+    id uuid PRIMARY KEY,
+    channel uuid NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    old_channel_status chan_status, -- null for a new channel
+    new_channel_status chan_status NOT NULL,
+    old_service_status svc_status, -- null for a new channel
+    new_service_status svc_status NOT NULL,
+    cause job_creator NOT NULL, -- who caused the transition
+    job uuid, -- job which made the transition, kept after the job is deleted
+    created_at timestamp with time zone NOT NULL
+);
+
+-- Balance proofs accepted from clients. Records are never updated.
+CREATE TABLE receipts (
+    id uuid PRIMARY KEY,
+    channel uuid NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    balance amount NOT NULL, -- total amount paid by the client
+    signature text NOT NULL, -- client signature of the balance proof
+    client_ip text NOT NULL, -- address the balance proof is received from
+    received_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX receipts_channel_received_at ON receipts(channel, received_at);
+
+-- Payment cheques of client channels.
+CREATE TABLE cheques (
+    id uuid PRIMARY KEY,
+    channel uuid NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+    amount amount NOT NULL, -- total amount paid by the cheque
+    status cheque_status NOT NULL,
+    attempts int NOT NULL, -- number of failed attempts to send
+    next_attempt timestamp with time zone NOT NULL, -- not to be sent before
+    last_error text, -- error of the last failed attempt
+    created_at timestamp with time zone NOT NULL,
+    acknowledged_at timestamp with time zone
+);
+
+-- Only one cheque of a channel is in flight.
+CREATE UNIQUE INDEX cheques_pending_channel ON cheques(channel)
+    WHERE status = 'pending';
+
 -- Ethereum transactions.
 CREATE TABLE eth_txs (
     id uuid PRIMARY KEY,
@@ -303,7 +397,13 @@ CREATE TABLE eth_txs (
 
     tx_raw jsonb, -- raw tx as was sent
     related_type related_type NOT NULL, -- name of object that relid point on (offering, channel, endpoint, etc.)
-    related_id uuid NOT NULL -- related object (offering, channel, endpoint, etc.)
+    related_id uuid NOT NULL, -- related object (offering, channel, endpoint, etc.)
+
+    block_number bigint
+        CONSTRAINT positive_block_number CHECK (eth_txs.block_number > 0), -- block in which tx was mined
+    gas_used bigint, -- gas used by tx according to its receipt
+    checked timestamp with time zone, -- last time tx status was checked
+    replaced_by uuid REFERENCES eth_txs(id) -- tx sent with the same nonce to replace this one
 );
 
 -- Ethereum events.
@@ -8,7 +8,6 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
-	"math/big"
 	"math/rand"
 	"strings"
 	"testing"
@@ -110,13 +109,11 @@ func NewTestAccount(auth string) *Account {
 		ID:         util.NewUUID(),
 		EthAddr:    addr,
 		PublicKey:  pub,
-		PrivateKey: pkEcnrypted,
+		PrivateKey: &pkEcnrypted,
 		IsDefault:  true,
 		InUse:      true,
 		Name:       util.NewUUID()[:30],
-		PTCBalance: 0,
-		PSCBalance: 0,
-		EthBalance: B64BigInt(FromBytes(big.NewInt(1).Bytes())),
+		EthBalance: NewAmount(1),
 	}
 }
 
@@ -129,13 +126,11 @@ func NewEthTestAccount(auth string, acc *truffle.TestAccount) *Account {
 		ID:         util.NewUUID(),
 		EthAddr:    addr,
 		PublicKey:  pub,
-		PrivateKey: pkEcnrypted,
+		PrivateKey: &pkEcnrypted,
 		IsDefault:  true,
 		InUse:      true,
 		Name:       util.NewUUID()[:30],
-		PTCBalance: 0,
-		PSCBalance: 0,
-		EthBalance: B64BigInt(FromBytes(big.NewInt(1).Bytes())),
+		EthBalance: NewAmount(1),
 	}
 }
 
@@ -187,8 +182,8 @@ func NewTestOffering(agent, product, tpl string) *Offering {
 		BillingType:        BillingPostpaid,
 		BillingInterval:    100,
 		AdditionalParams:   []byte("{}"),
-		SetupPrice:         11,
-		UnitPrice:          22,
+		SetupPrice:         NewAmount(11),
+		UnitPrice:          NewAmount(22),
 	}
 	return offering
 }
@@ -205,8 +200,8 @@ func NewTestChannel(agent, client, offering string,
 		Block:            uint32(rand.Int31()),
 		ChannelStatus:    status,
 		ServiceStatus:    ServicePending,
-		TotalDeposit:     deposit,
-		ReceiptBalance:   balance,
+		TotalDeposit:     NewAmount(deposit),
+		ReceiptBalance:   NewAmount(balance),
 		ReceiptSignature: &receiptSigFake,
 		Salt:             TestSalt,
 		Password:         TestPasswordHash,
@@ -266,6 +261,23 @@ func NewTestEthLog() *EthLog {
 	}
 }
 
+// NewTestEthTx returns a default test eth transaction.
+func NewTestEthTx(relType, relID string) *EthTx {
+	hash := make([]byte, common.HashLength)
+	rand.Read(hash)
+	return &EthTx{
+		ID:          util.NewUUID(),
+		Hash:        FromBytes(hash),
+		Status:      TxSent,
+		Issued:      time.Now(),
+		GasPrice:    1,
+		Gas:         1,
+		TxRaw:       []byte("{}"),
+		RelatedType: relType,
+		RelatedID:   relID,
+	}
+}
+
 // BeginTestTX begins a test transaction.
 func BeginTestTX(t *testing.T, db *reform.DB) *reform.TX {
 	tx, err := db.Begin()
@@ -350,9 +362,10 @@ func ReloadFromTestDB(t *testing.T, db *reform.DB, recs ...reform.Record) {
 func CleanTestDB(t *testing.T, db *reform.DB) {
 	tx := BeginTestTX(t, db)
 	for _, v := range []reform.View{EthTxTable, EthLogTable, JobTable,
-		EndpointTable, SessionTable, ChannelTable, OfferingTable,
-		UserTable, AccountTable, ProductTable, TemplateTable,
-		ContractTable, SettingTable} {
+		EndpointTable, SessionTable, ChannelEventTable, ChequeTable,
+		ReceiptTable, ChannelTable, OfferingTable, UserTable,
+		AccountTable, HDWalletTable, KeyExportTable, ProductTable,
+		TemplateTable, ContractTable, SettingTable} {
 		if _, err := tx.DeleteFrom(v, ""); err != nil {
 			RollbackTestTX(t, tx)
 			t.Fatalf("failed to clean DB: %s", err)
@@ -5,7 +5,7 @@ BEGIN TRANSACTION;
 INSERT INTO accounts (id, eth_addr, public_key, private_key, name, ptc_balance,
     psc_balance, eth_balance)
 VALUES ('e8b17880-8ee5-4fc1-afb2-e6900655d8d5', '', '', '', 'Test channel',
-    0, 0, '');
+    0, 0, 0);
 
 INSERT INTO offerings (id, is_local, tpl, product, hash, status, offer_status,
     block_number_updated, agent, raw_msg, service_name, country, supply,
@@ -5,22 +5,140 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
 )
 
-// B64BigInt is a base64 of big.Int that implements json.Marshaler.
-type B64BigInt string
+// Amount is an arbitrary-precision non-negative amount of tokens or wei.
+// Amounts are stored as numeric columns and are marshaled to JSON as numbers.
+// Operations do not modify amounts, so they are safe to copy.
+type Amount struct {
+	i big.Int
+}
+
+// NewAmount creates an amount from uint64.
+func NewAmount(v uint64) Amount {
+	var a Amount
+	a.i.SetUint64(v)
+	return a
+}
+
+// NewAmountFromBig creates an amount from big.Int.
+func NewAmountFromBig(v *big.Int) Amount {
+	var a Amount
+	a.i.Set(v)
+	return a
+}
+
+// ParseAmount parses a decimal amount.
+func ParseAmount(s string) (Amount, error) {
+	var a Amount
+	if _, ok := a.i.SetString(s, 10); !ok || a.i.Sign() < 0 {
+		return Amount{}, fmt.Errorf("invalid amount: %s", s)
+	}
+	return a, nil
+}
+
+// Big returns a copy of the amount as big.Int.
+func (a Amount) Big() *big.Int {
+	return new(big.Int).Set(&a.i)
+}
+
+// Uint64 returns the amount as uint64 and whether it fits into it.
+func (a Amount) Uint64() (uint64, bool) {
+	return a.i.Uint64(), a.i.IsUint64()
+}
+
+// IsZero tells whether the amount is zero.
+func (a Amount) IsZero() bool {
+	return a.i.Sign() == 0
+}
+
+// Cmp compares amounts, it returns -1, 0 or +1 like big.Int.Cmp.
+func (a Amount) Cmp(b Amount) int {
+	return a.i.Cmp(&b.i)
+}
+
+// Add returns a sum of amounts.
+func (a Amount) Add(b Amount) Amount {
+	var r Amount
+	r.i.Add(&a.i, &b.i)
+	return r
+}
+
+// Sub returns a difference of amounts, which is never negative.
+func (a Amount) Sub(b Amount) Amount {
+	var r Amount
+	if a.i.Cmp(&b.i) > 0 {
+		r.i.Sub(&a.i, &b.i)
+	}
+	return r
+}
+
+// Mul returns a product of amounts.
+func (a Amount) Mul(b Amount) Amount {
+	var r Amount
+	r.i.Mul(&a.i, &b.i)
+	return r
+}
+
+// Div returns a quotient of amounts rounded down. Division by zero returns
+// zero.
+func (a Amount) Div(b Amount) Amount {
+	var r Amount
+	if b.i.Sign() != 0 {
+		r.i.Quo(&a.i, &b.i)
+	}
+	return r
+}
+
+// String returns a decimal representation of the amount.
+func (a Amount) String() string {
+	return a.i.String()
+}
+
+// Value serializes the amount.
+func (a Amount) Value() (driver.Value, error) {
+	return a.i.String(), nil
+}
+
+// Scan deserializes the amount.
+func (a *Amount) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		a.i.SetInt64(v)
+		return nil
+	default:
+		return fmt.Errorf("unexpected amount type %T", src)
+	}
+
+	parsed, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// MarshalJSON marshals the amount as a JSON number.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.i.String()), nil
+}
 
-// MarshalJSON marshals itself.
-func (i B64BigInt) MarshalJSON() ([]byte, error) {
-	buf, err := ToBytes(string(i))
+// UnmarshalJSON unmarshals the amount from a JSON number or string.
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	parsed, err := ParseAmount(strings.Trim(string(b), `"`))
 	if err != nil {
-		return nil, fmt.Errorf("could not decode base64: %v", err)
+		return err
 	}
-	v := big.NewInt(0)
-	v.SetBytes(buf)
-	return []byte(v.String()), nil
+	*a = parsed
+	return nil
 }
 
 // LogTopics is a database/sql compatible type for ethereum log topics.
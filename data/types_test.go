@@ -0,0 +1,97 @@
+package data_test
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/privatix/dappctrl/data"
+)
+
+// 2^64 + 1, does not fit into uint64.
+const hugeAmount = "18446744073709551617"
+
+func TestAmountJSON(t *testing.T) {
+	huge, err := data.ParseAmount(hugeAmount)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := json.Marshal(huge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != hugeAmount {
+		t.Fatalf("wrong marshaled amount: %s", buf)
+	}
+
+	for _, v := range []string{hugeAmount, `"` + hugeAmount + `"`} {
+		var a data.Amount
+		if err := json.Unmarshal([]byte(v), &a); err != nil {
+			t.Fatal(err)
+		}
+		if a.Cmp(huge) != 0 {
+			t.Fatalf("wrong unmarshaled amount: %s", a)
+		}
+	}
+
+	for _, v := range []string{"-1", "1.5", `"abc"`} {
+		var a data.Amount
+		if err := json.Unmarshal([]byte(v), &a); err == nil {
+			t.Fatalf("invalid amount %s accepted", v)
+		}
+	}
+}
+
+func TestAmountSQL(t *testing.T) {
+	huge, _ := data.ParseAmount(hugeAmount)
+
+	val, err := huge.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []interface{}{[]byte(val.(string)), val} {
+		var a data.Amount
+		if err := a.Scan(v); err != nil {
+			t.Fatal(err)
+		}
+		if a.Cmp(huge) != 0 {
+			t.Fatalf("wrong scanned amount: %s", a)
+		}
+	}
+
+	var a data.Amount
+	if err := a.Scan(int64(7)); err != nil || a.Cmp(data.NewAmount(7)) != 0 {
+		t.Fatalf("failed to scan int64: %v", err)
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	max := data.NewAmount(^uint64(0))
+	one := data.NewAmount(1)
+
+	sum := max.Add(one)
+	if _, ok := sum.Uint64(); ok {
+		t.Fatal("overflowed sum fits into uint64")
+	}
+	expected := new(big.Int).Lsh(big.NewInt(1), 64)
+	if sum.Big().Cmp(expected) != 0 {
+		t.Fatalf("wrong sum: %s", sum)
+	}
+
+	if sum.Sub(one).Cmp(max) != 0 {
+		t.Fatalf("wrong difference: %s", sum.Sub(one))
+	}
+	if !one.Sub(sum).IsZero() {
+		t.Fatal("negative difference is not clamped to zero")
+	}
+
+	prod := max.Mul(data.NewAmount(2))
+	if prod.Div(data.NewAmount(2)).Cmp(max) != 0 {
+		t.Fatalf("wrong product or quotient: %s", prod)
+	}
+	if !prod.Div(data.Amount{}).IsZero() {
+		t.Fatal("division by zero is not zero")
+	}
+}
@@ -109,3 +109,55 @@ func (e *EthereumClient) GetBlockNumber() (*BlockNumberAPIResponse, error) {
 	response := &BlockNumberAPIResponse{}
 	return response, e.fetch("eth_blockNumber", "", response)
 }
+
+// TransactionReceipt is a receipt of a mined transaction.
+// All numeric values are hex-encoded.
+type TransactionReceipt struct {
+	BlockHash       string `json:"blockHash"`
+	BlockNumber     string `json:"blockNumber"`
+	GasUsed         string `json:"gasUsed"`
+	Status          string `json:"status"`
+	TransactionHash string `json:"transactionHash"`
+}
+
+// TransactionReceiptAPIResponse implements wrapper for ethereum JSON RPC API
+// response. Result is nil if transaction is pending or unknown.
+type TransactionReceiptAPIResponse struct {
+	apiResponse
+	Result *TransactionReceipt `json:"result"`
+}
+
+// GetTransactionReceipt returns the receipt of a transaction by its hash.
+// For the details, please, refer to:
+// https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_gettransactionreceipt
+func (e *EthereumClient) GetTransactionReceipt(
+	hash string) (*TransactionReceiptAPIResponse, error) {
+	response := &TransactionReceiptAPIResponse{}
+	return response, e.fetch("eth_getTransactionReceipt",
+		fmt.Sprintf(`"%s"`, hash), response)
+}
+
+// Transaction is a transaction known to the node.
+// BlockNumber is empty for pending transactions.
+type Transaction struct {
+	BlockNumber string `json:"blockNumber"`
+	Hash        string `json:"hash"`
+	Nonce       string `json:"nonce"`
+}
+
+// TransactionAPIResponse implements wrapper for ethereum JSON RPC API
+// response. Result is nil if transaction is unknown.
+type TransactionAPIResponse struct {
+	apiResponse
+	Result *Transaction `json:"result"`
+}
+
+// GetTransactionByHash returns a transaction by its hash.
+// For the details, please, refer to:
+// https://github.com/ethereum/wiki/wiki/JSON-RPC#eth_gettransactionbyhash
+func (e *EthereumClient) GetTransactionByHash(
+	hash string) (*TransactionAPIResponse, error) {
+	response := &TransactionAPIResponse{}
+	return response, e.fetch("eth_getTransactionByHash",
+		fmt.Sprintf(`"%s"`, hash), response)
+}
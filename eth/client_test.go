@@ -3,6 +3,7 @@
 package eth
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -16,3 +17,23 @@ func TestBlockNumberFetching(t *testing.T) {
 		t.Fatal("Unexpected response received")
 	}
 }
+
+func TestUnknownTransactionFetching(t *testing.T) {
+	hash := "0x" + strings.Repeat("00", 32)
+
+	receipt, err := getClient().GetTransactionReceipt(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Result != nil {
+		t.Fatal("unexpected receipt for unknown transaction")
+	}
+
+	tx, err := getClient().GetTransactionByHash(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Result != nil {
+		t.Fatal("unexpected unknown transaction found")
+	}
+}
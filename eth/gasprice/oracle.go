@@ -0,0 +1,136 @@
+package gasprice
+
+import (
+	"context"
+	"math"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Gas price recommendation methods.
+const (
+	MethodNode       = "node"       // Ask eth node for a price.
+	MethodPercentile = "percentile" // Take prices of recent transactions.
+)
+
+// Config is a gas price oracle configuration.
+type Config struct {
+	Method     string // Recommendation method.
+	Blocks     uint   // Number of recent blocks for percentile method.
+	Percentile uint   // Percentile of recent transaction prices.
+	Min        uint64 // Minimal price in wei, 0 means no limit.
+	Max        uint64 // Maximal price in wei, 0 means no limit.
+	Timeout    uint   // In seconds.
+}
+
+// NewConfig creates a default gas price oracle configuration.
+func NewConfig() *Config {
+	return &Config{
+		Method:     MethodNode,
+		Blocks:     20,
+		Percentile: 60,
+		Min:        1000000000,
+		Max:        100000000000,
+		Timeout:    10,
+	}
+}
+
+// Client is an ethereum client used by the oracle.
+type Client interface {
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+}
+
+// Oracle recommends gas prices for transactions.
+type Oracle struct {
+	conf   *Config
+	client Client
+}
+
+// NewOracle creates a new gas price oracle.
+func NewOracle(conf *Config, client Client) *Oracle {
+	return &Oracle{conf: conf, client: client}
+}
+
+// GasPrice returns a recommended gas price in wei.
+func (o *Oracle) GasPrice() (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(),
+		time.Duration(o.conf.Timeout)*time.Second)
+	defer cancel()
+
+	var price *big.Int
+	var err error
+	if o.conf.Method == MethodPercentile {
+		price, err = o.percentile(ctx)
+	} else {
+		price, err = o.client.SuggestGasPrice(ctx)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return o.limit(price), nil
+}
+
+// percentile returns a configured percentile of gas prices of transactions
+// in recent blocks. If there are no transactions, the node is asked.
+func (o *Oracle) percentile(ctx context.Context) (*big.Int, error) {
+	block, err := o.client.BlockByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var prices []*big.Int
+	for i := uint(0); ; i++ {
+		for _, tx := range block.Transactions() {
+			prices = append(prices, tx.GasPrice())
+		}
+
+		if i+1 >= o.conf.Blocks || block.NumberU64() == 0 {
+			break
+		}
+
+		block, err = o.client.BlockByNumber(ctx,
+			new(big.Int).SetUint64(block.NumberU64()-1))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(prices) == 0 {
+		return o.client.SuggestGasPrice(ctx)
+	}
+
+	sort.Slice(prices, func(i, j int) bool {
+		return prices[i].Cmp(prices[j]) < 0
+	})
+
+	percentile := o.conf.Percentile
+	if percentile > 100 {
+		percentile = 100
+	}
+
+	return prices[(len(prices)-1)*int(percentile)/100], nil
+}
+
+func (o *Oracle) limit(price *big.Int) uint64 {
+	if !price.IsUint64() {
+		if o.conf.Max != 0 {
+			return o.conf.Max
+		}
+		return math.MaxUint64
+	}
+
+	if o.conf.Max != 0 && price.Uint64() > o.conf.Max {
+		return o.conf.Max
+	}
+
+	if price.Uint64() < o.conf.Min {
+		return o.conf.Min
+	}
+
+	return price.Uint64()
+}
@@ -0,0 +1,119 @@
+// +build !nogaspricetest
+
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/privatix/dappctrl/util"
+)
+
+type testClient struct {
+	suggested int64
+	blocks    [][]int64 // Gas prices of transactions per block.
+}
+
+func (c *testClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(c.suggested), nil
+}
+
+func (c *testClient) BlockByNumber(ctx context.Context,
+	number *big.Int) (*types.Block, error) {
+	num := uint64(len(c.blocks) - 1)
+	if number != nil {
+		num = number.Uint64()
+	}
+	if num >= uint64(len(c.blocks)) {
+		return nil, errors.New("block not found")
+	}
+
+	var txs []*types.Transaction
+	for i, price := range c.blocks[num] {
+		txs = append(txs, types.NewTransaction(uint64(i),
+			common.Address{}, big.NewInt(0), 21000,
+			big.NewInt(price), nil))
+	}
+
+	header := &types.Header{Number: new(big.Int).SetUint64(num)}
+	return types.NewBlock(header, txs, nil, nil), nil
+}
+
+func TestGasPrice(t *testing.T) {
+	client := &testClient{
+		suggested: 50,
+		blocks: [][]int64{
+			{1000},
+			{10, 20, 30},
+			{40, 50},
+			{},
+		},
+	}
+
+	cases := []struct {
+		method     string
+		blocks     uint
+		percentile uint
+		min, max   uint64
+		expected   uint64
+	}{
+		{MethodNode, 0, 0, 0, 0, 50},
+		{MethodNode, 0, 0, 60, 0, 60},
+		{MethodNode, 0, 0, 0, 40, 40},
+		{MethodPercentile, 1, 50, 0, 0, 50},  // no txs, asks node
+		{MethodPercentile, 3, 0, 0, 0, 10},   // 10 20 30 40 50
+		{MethodPercentile, 3, 50, 0, 0, 30},  // 10 20 30 40 50
+		{MethodPercentile, 3, 100, 0, 0, 50}, // 10 20 30 40 50
+		{MethodPercentile, 10, 100, 0, 0, 1000},
+		{MethodPercentile, 10, 100, 0, 100, 100},
+		{MethodPercentile, 3, 0, 15, 0, 15},
+	}
+
+	for _, c := range cases {
+		oracle := NewOracle(&Config{
+			Method:     c.method,
+			Blocks:     c.blocks,
+			Percentile: c.percentile,
+			Min:        c.min,
+			Max:        c.max,
+			Timeout:    1,
+		}, client)
+
+		price, err := oracle.GasPrice()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if price != c.expected {
+			t.Fatalf("wrong gas price for %+v: %d", c, price)
+		}
+	}
+}
+
+func TestLimitOverflow(t *testing.T) {
+	huge := new(big.Int).Lsh(big.NewInt(1), 64)
+
+	oracle := NewOracle(&Config{}, nil)
+	if price := oracle.limit(huge); price != math.MaxUint64 {
+		t.Fatalf("unsaturated gas price: %d", price)
+	}
+
+	oracle = NewOracle(&Config{Max: 100}, nil)
+	if price := oracle.limit(huge); price != 100 {
+		t.Fatalf("unlimited gas price: %d", price)
+	}
+}
+
+func TestMain(m *testing.M) {
+	// Ignore config when all tests run.
+	util.ReadTestConfig(&struct{}{})
+
+	os.Exit(m.Run())
+}
@@ -0,0 +1,93 @@
+package hdwallet
+
+import (
+	"crypto/ecdsa"
+	"errors"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// Mnemonic entropy size in bits, corresponds to 24 words.
+const entropyBits = 256
+
+// Errors.
+var (
+	ErrInvalidMnemonic = errors.New("invalid mnemonic")
+)
+
+// BasePath is a BIP-44 derivation path of ethereum accounts without an
+// address index.
+var BasePath = accounts.DefaultBaseDerivationPath
+
+// NewMnemonic generates a new BIP-39 mnemonic.
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(entropyBits)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// Wallet is a hierarchical deterministic wallet.
+type Wallet struct {
+	master *hdkeychain.ExtendedKey
+}
+
+// NewWallet creates a wallet from a BIP-39 mnemonic and an optional
+// passphrase.
+func NewWallet(mnemonic, passphrase string) (*Wallet, error) {
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil, ErrInvalidMnemonic
+	}
+
+	seed := bip39.NewSeed(mnemonic, passphrase)
+
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Wallet{master: master}, nil
+}
+
+// Fingerprint returns an address of the master key, which identifies the
+// wallet without revealing any of derived keys.
+func (w *Wallet) Fingerprint() (common.Address, error) {
+	pub, err := w.master.ECPubKey()
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pub.ToECDSA()), nil
+}
+
+// Derive returns a private key for a given derivation path.
+func (w *Wallet) Derive(path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	key := w.master
+	for _, n := range path {
+		var err error
+		if key, err = key.Child(n); err != nil {
+			return nil, err
+		}
+	}
+
+	priv, err := key.ECPrivKey()
+	if err != nil {
+		return nil, err
+	}
+
+	return priv.ToECDSA(), nil
+}
+
+// AccountPath returns a derivation path of an account with a given index.
+func AccountPath(base accounts.DerivationPath,
+	index uint32) accounts.DerivationPath {
+	path := make(accounts.DerivationPath, len(base)+1)
+	copy(path, base)
+	path[len(base)] = index
+	return path
+}
@@ -0,0 +1,89 @@
+// +build !nohdwallettest
+
+package hdwallet
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/privatix/dappctrl/util"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon " +
+	"abandon abandon abandon abandon abandon about"
+
+func TestDerive(t *testing.T) {
+	w, err := NewWallet(testMnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Well-known addresses of the test mnemonic.
+	expected := []string{
+		"0x9858EfFD232B4033E47d90003D41EC34EcaEda94",
+		"0x6Fac4D18c912343BF86fa7049364Dd4E424Ab9C0",
+	}
+
+	for i, addr := range expected {
+		key, err := w.Derive(AccountPath(BasePath, uint32(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if crypto.PubkeyToAddress(key.PublicKey) !=
+			common.HexToAddress(addr) {
+			t.Fatalf("wrong key derived for index %d", i)
+		}
+	}
+
+	if AccountPath(BasePath, 1).String() != "m/44'/60'/0'/0/1" {
+		t.Fatal("wrong account path")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	w1, _ := NewWallet(testMnemonic, "")
+	w2, _ := NewWallet(testMnemonic, "passphrase")
+
+	f1, err := w1.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := w2.Fingerprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f1 == f2 {
+		t.Fatal("same fingerprint for different seeds")
+	}
+}
+
+func TestNewMnemonic(t *testing.T) {
+	mnemonic, err := NewMnemonic()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(strings.Fields(mnemonic)) != 24 {
+		t.Fatal("wrong mnemonic length")
+	}
+
+	if _, err := NewWallet(mnemonic, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWallet("foo bar", ""); err != ErrInvalidMnemonic {
+		t.Fatal("invalid mnemonic accepted")
+	}
+}
+
+func TestMain(m *testing.M) {
+	// Ignore config when all tests run.
+	util.ReadTestConfig(&struct{}{})
+
+	os.Exit(m.Run())
+}
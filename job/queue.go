@@ -129,6 +129,53 @@ func (q *Queue) Add(j *data.Job) error {
 	return q.db.Insert(j)
 }
 
+// Reschedule makes an already processed job active again, so that it is
+// retried after the type-specific retry period. If the job has exhausted its
+// try limit, it is marked as failed instead. Active and canceled jobs are
+// left as is.
+func (q *Queue) Reschedule(id string) error {
+	tx, err := q.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var job data.Job
+	if err := tx.SelectOneTo(&job,
+		"WHERE id = $1 FOR UPDATE", id); err != nil {
+		return err
+	}
+
+	// Active jobs are already scheduled, repeated requests must not
+	// exhaust the try limit.
+	if job.Status == data.JobCanceled || job.Status == data.JobActive {
+		return tx.Commit()
+	}
+
+	tconf := q.typeConfig(&job)
+
+	if tconf.TryLimit != 0 {
+		job.TryCount++
+	}
+
+	if job.TryCount >= tconf.TryLimit && tconf.TryLimit != 0 {
+		job.Status = data.JobFailed
+		q.logger.Error("job %s(%s) is failed", job.ID, job.Type)
+	} else {
+		job.Status = data.JobActive
+		job.NotBefore = time.Now().Add(
+			time.Duration(tconf.TryPeriod) * time.Millisecond)
+		q.logger.Warn("retry for job %s(%s) rescheduled to %s",
+			job.ID, job.Type, job.NotBefore.Format(time.RFC3339))
+	}
+
+	if err := tx.Save(&job); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
 // Close causes currently running Process() function to exit.
 func (q *Queue) Close() {
 	q.mtx.Lock()
@@ -160,6 +160,38 @@ func TestFailure(t *testing.T) {
 	}
 }
 
+func TestReschedule(t *testing.T) {
+	data.CleanTestTable(t, db, data.JobTable)
+
+	queue := NewQueue(conf.Job, logger, db, nil)
+
+	job := createJob()
+	add(t, queue, job, nil)
+	defer db.Delete(job)
+
+	for i := uint8(1); i <= conf.Job.TryLimit; i++ {
+		job.Status = data.JobDone
+		util.TestExpectResult(t, "Save", nil, db.Save(job))
+
+		// Repeated requests for an active job don't count as tries.
+		for j := 0; j < 2; j++ {
+			util.TestExpectResult(t, "Reschedule", nil,
+				queue.Reschedule(job.ID))
+		}
+		util.TestExpectResult(t, "FindByPrimaryKeyTo", nil,
+			db.FindByPrimaryKeyTo(job, job.ID))
+
+		expected := data.JobActive
+		if i == conf.Job.TryLimit {
+			expected = data.JobFailed
+		}
+		if job.Status != expected || job.TryCount != i {
+			t.Fatalf("unexpected job status %s and try count %d",
+				job.Status, job.TryCount)
+		}
+	}
+}
+
 func TestStress(t *testing.T) {
 	data.CleanTestTable(t, db, data.JobTable)
 
@@ -3,12 +3,18 @@ package main
 import (
 	"flag"
 	"log"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 
+	agentbill "github.com/privatix/dappctrl/agent/bill"
+	"github.com/privatix/dappctrl/balance"
+	clientbill "github.com/privatix/dappctrl/client/bill"
 	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/eth"
 	"github.com/privatix/dappctrl/eth/contract"
+	"github.com/privatix/dappctrl/eth/gasprice"
 	"github.com/privatix/dappctrl/execsrv"
 	"github.com/privatix/dappctrl/job"
 	"github.com/privatix/dappctrl/monitor"
@@ -16,7 +22,9 @@ import (
 	"github.com/privatix/dappctrl/proc"
 	"github.com/privatix/dappctrl/proc/worker"
 	"github.com/privatix/dappctrl/sesssrv"
+	"github.com/privatix/dappctrl/signer"
 	"github.com/privatix/dappctrl/somc"
+	"github.com/privatix/dappctrl/txtrack"
 	"github.com/privatix/dappctrl/uisrv"
 	"github.com/privatix/dappctrl/util"
 )
@@ -30,31 +38,44 @@ type ethConfig struct {
 }
 
 type config struct {
-	AgentServer   *uisrv.Config
-	BlockMonitor  *monitor.Config
-	Eth           *ethConfig
-	DB            *data.DBConfig
-	Gas           *worker.GasConf
-	Job           *job.Config
-	Log           *util.LogConfig
-	PayServer     *pay.Config
-	PayAddress    string
-	Proc          *proc.Config
-	SessionServer *sesssrv.Config
-	SOMC          *somc.Config
-	StaticPasword string
+	AgentBilling   *agentbill.Config
+	AgentServer    *uisrv.Config
+	BalanceChecker *balance.Config
+	BlockMonitor   *monitor.Config
+	ClientBilling  *clientbill.Config
+	Eth            *ethConfig
+	DB             *data.DBConfig
+	Gas            *worker.GasConf
+	GasPrice       *gasprice.Config
+	Job            *job.Config
+	Log            *util.LogConfig
+	PayServer      *pay.Config
+	PayAddress     string
+	Proc           *proc.Config
+	SessionServer  *sesssrv.Config
+	Signer         *signer.Config
+	SOMC           *somc.Config
+	StaticPasword  string
+	TxTracker      *txtrack.Config
 }
 
 func newConfig() *config {
 	return &config{
-		BlockMonitor:  monitor.NewConfig(),
-		DB:            data.NewDBConfig(),
-		AgentServer:   uisrv.NewConfig(),
-		Job:           job.NewConfig(),
-		Log:           util.NewLogConfig(),
-		Proc:          proc.NewConfig(),
-		SessionServer: sesssrv.NewConfig(),
-		SOMC:          somc.NewConfig(),
+		AgentBilling:   agentbill.NewConfig(),
+		BalanceChecker: balance.NewConfig(),
+		BlockMonitor:   monitor.NewConfig(),
+		ClientBilling:  clientbill.NewConfig(),
+		DB:             data.NewDBConfig(),
+		GasPrice:       gasprice.NewConfig(),
+		AgentServer:    uisrv.NewConfig(),
+		Job:            job.NewConfig(),
+		Log:            util.NewLogConfig(),
+		PayServer:      pay.NewConfig(),
+		Proc:           proc.NewConfig(),
+		SessionServer:  sesssrv.NewConfig(),
+		Signer:         signer.NewConfig(),
+		SOMC:           somc.NewConfig(),
+		TxTracker:      txtrack.NewConfig(),
 	}
 }
 
@@ -108,12 +129,6 @@ func main() {
 		logger.Fatal("failed to create psc intance: %v", err)
 	}
 
-	paySrv := pay.NewServer(conf.PayServer, logger, db)
-	go func() {
-		logger.Fatal("failed to start pay server: %s",
-			paySrv.ListenAndServe())
-	}()
-
 	sess := sesssrv.NewServer(conf.SessionServer, logger, db)
 	go func() {
 		logger.Fatal("failed to start session server: %s",
@@ -134,17 +149,27 @@ func main() {
 
 	pwdStorage := getPWDStorage(conf)
 
+	gasOracle := gasprice.NewOracle(conf.GasPrice, gethConn)
+
+	sgn, err := signer.NewSigner(conf.Signer, db, pwdStorage)
+	if err != nil {
+		logger.Fatal("failed to create signer: %v", err)
+	}
+
 	worker, err := worker.NewWorker(db, somcConn,
-		worker.NewEthBackend(psc, ptc, gethConn), conf.Gas,
-		pscAddr, conf.PayAddress, pwdStorage, data.ToPrivateKey)
+		worker.NewEthBackend(psc, ptc, gethConn), conf.Gas, gasOracle,
+		pscAddr, ptcAddr, conf.PayAddress, sgn)
 	if err != nil {
 		panic(err)
 	}
 
 	queue := job.NewQueue(conf.Job, logger, db, proc.HandlersMap(worker))
 	worker.SetQueue(queue)
+	worker.SetPayClient(conf.ClientBilling.RequestTLS,
+		conf.ClientBilling.RequestTimeout)
 
-	uiSrv := uisrv.NewServer(conf.AgentServer, logger, db, queue, pwdStorage)
+	uiSrv := uisrv.NewServer(conf.AgentServer, logger, db, queue,
+		pwdStorage, gasOracle, sgn)
 
 	go func() {
 		logger.Fatal("failed to run agent server: %s\n",
@@ -165,5 +190,74 @@ func main() {
 	}
 	defer mon.Stop()
 
+	tracker, err := txtrack.NewTracker(conf.TxTracker, logger, db, queue,
+		eth.NewEthereumClient(conf.Eth.GethURL))
+	if err != nil {
+		logger.Fatal("failed to initialize"+
+			" the transaction tracker: %v", err)
+	}
+
+	if err := tracker.Start(); err != nil {
+		logger.Fatal("failed to start"+
+			" the transaction tracker: %v", err)
+	}
+	defer tracker.Stop()
+
+	balanceChecker, err := balance.NewChecker(conf.BalanceChecker, logger,
+		db, queue)
+	if err != nil {
+		logger.Fatal("failed to initialize"+
+			" the balance checker: %v", err)
+	}
+
+	if err := balanceChecker.Start(); err != nil {
+		logger.Fatal("failed to start"+
+			" the balance checker: %v", err)
+	}
+	defer balanceChecker.Stop()
+
+	pr := proc.NewProcessor(conf.Proc, queue)
+
+	term := pay.NewPendingTerminator(pr,
+		proc.ErrSameJobExists, proc.ErrActiveJobsExist)
+	paySrv := pay.NewServer(conf.PayServer, logger, db, term, pscAddr, sgn)
+	go func() {
+		logger.Fatal("failed to start pay server: %s",
+			paySrv.ListenAndServe())
+	}()
+
+	if conf.AgentBilling.Enabled {
+		agentBilling, err := agentbill.NewMonitor(time.Duration(
+			conf.AgentBilling.Interval)*time.Millisecond,
+			db, logger, pr)
+		if err != nil {
+			logger.Fatal("failed to initialize"+
+				" the agent billing monitor: %v", err)
+		}
+
+		go func() {
+			err := agentBilling.Run()
+			if err != agentbill.ErrMonitorClosed {
+				logger.Fatal("failed to run"+
+					" the agent billing monitor: %v", err)
+			}
+		}()
+		defer agentBilling.Close()
+	}
+
+	if conf.ClientBilling.Enabled {
+		clientBilling := clientbill.NewMonitor(conf.ClientBilling,
+			logger, db, pr, conf.Eth.Contract.PSCAddrHex, sgn)
+
+		go func() {
+			err := clientBilling.Run()
+			if err != clientbill.ErrMonitorClosed {
+				logger.Fatal("failed to run"+
+					" the client billing monitor: %v", err)
+			}
+		}()
+		defer clientBilling.Close()
+	}
+
 	logger.Fatal("failed to process job queue: %s", queue.Process())
 }
@@ -5,22 +5,26 @@ import (
 	"crypto/rand"
 	"fmt"
 
+	"github.com/ethereum/go-ethereum/common"
 	ethcrypto "github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/crypto/ecies"
+
+	"github.com/privatix/dappctrl/signer"
 )
 
 const sigLen = 64
 
 // AgentSeal encrypts message using client's public key and packs with
 // agent signature.
-func AgentSeal(msg, clientPub []byte, agentKey *ecdsa.PrivateKey) ([]byte, error) {
+func AgentSeal(msg, clientPub []byte, s signer.Signer,
+	agent common.Address) ([]byte, error) {
 	pub := ecies.ImportECDSAPublic(ethcrypto.ToECDSAPub(clientPub))
 	msgEncrypted, err := ecies.Encrypt(rand.Reader, pub, msg, nil, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	return PackWithSignature(msgEncrypted, agentKey)
+	return PackWithSignature(msgEncrypted, s, agent)
 }
 
 // ClientOpen decrypts message using client's key and verifies using agent's key.
@@ -43,9 +47,10 @@ func ClientOpen(c, agentPub []byte, clientPrv *ecdsa.PrivateKey) ([]byte, error)
 	return opened, nil
 }
 
-// PackWithSignature packs message with signature.
-func PackWithSignature(msg []byte, key *ecdsa.PrivateKey) ([]byte, error) {
-	sig, err := signature(key, msg)
+// PackWithSignature packs message with signature of a given account.
+func PackWithSignature(msg []byte, s signer.Signer,
+	addr common.Address) ([]byte, error) {
+	sig, err := signature(s, addr, msg)
 	if err != nil {
 		return nil, err
 	}
@@ -54,9 +59,10 @@ func PackWithSignature(msg []byte, key *ecdsa.PrivateKey) ([]byte, error) {
 }
 
 // signature computes and returns signature.
-func signature(key *ecdsa.PrivateKey, msg []byte) ([]byte, error) {
+func signature(s signer.Signer,
+	addr common.Address, msg []byte) ([]byte, error) {
 	hash := ethcrypto.Keccak256(msg)
-	sig, err := ethcrypto.Sign(hash, key)
+	sig, err := s.SignHash(addr, hash)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign: %v", err)
 	}
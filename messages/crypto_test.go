@@ -7,6 +7,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/common"
 	ethcrypto "github.com/ethereum/go-ethereum/crypto"
 
 	"github.com/privatix/dappctrl/messages"
@@ -15,6 +16,15 @@ import (
 
 var testPassword = "test-password"
 
+type testSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s *testSigner) SignHash(
+	addr common.Address, hash []byte) ([]byte, error) {
+	return ethcrypto.Sign(hash, s.key)
+}
+
 func TestMain(m *testing.M) {
 	// Ignore config when all tests run.
 	util.ReadTestConfig(&struct{}{})
@@ -29,7 +39,8 @@ func TestSealOpen(t *testing.T) {
 	agentKey, _ := ecdsa.GenerateKey(ethcrypto.S256(), rand.Reader)
 
 	sealed, err := messages.AgentSeal(msg,
-		ethcrypto.FromECDSAPub(&clientKey.PublicKey), agentKey)
+		ethcrypto.FromECDSAPub(&clientKey.PublicKey),
+		&testSigner{agentKey}, ethcrypto.PubkeyToAddress(agentKey.PublicKey))
 	if err != nil {
 		t.Fatal("failed to encrypt: ", err)
 	}
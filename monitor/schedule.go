@@ -363,7 +363,8 @@ func (m *Monitor) scheduleTokenApprove(el *data.EthLog, jobType string) {
 		return
 	}
 	balanceData := &data.JobBalanceData{
-		Amount: uint(big.NewInt(0).SetBytes(amountBytes).Uint64()),
+		Amount: data.NewAmountFromBig(
+			new(big.Int).SetBytes(amountBytes)),
 	}
 	dataEncoded, err := json.Marshal(balanceData)
 	if err != nil {
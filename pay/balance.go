@@ -0,0 +1,152 @@
+package pay
+
+import (
+	"encoding/binary"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/privatix/dappctrl/data"
+)
+
+// maxNonceSkew is a maximum difference between a balance query nonce and
+// the server time.
+const maxNonceSkew = 5 * time.Minute
+
+// Balance query parameters.
+const (
+	paramAgentAddress = "agentAddress"
+	paramOpenBlockNum = "openBlockNum"
+	paramOfferingHash = "offeringHash"
+	paramNonce        = "nonce"
+	paramSignature    = "sig"
+)
+
+// BalanceReply is a channel state accepted by an agent.
+type BalanceReply struct {
+	ReceiptBalance  data.Amount `json:"receiptBalance"`
+	UnitsUsed       uint64      `json:"unitsUsed"`
+	SecondsConsumed uint64      `json:"secondsConsumed"`
+}
+
+// balanceQuery is a balance query received from a client.
+type balanceQuery struct {
+	AgentAddress    string
+	OpenBlockNumber uint32
+	OfferingHash    string
+	Nonce           int64 // Unix time of the query.
+	Signature       string
+}
+
+// balanceQueryHash returns a hash a client signs to query a channel state.
+func balanceQueryHash(agentAddr common.Address, block uint32,
+	offeringHash common.Hash, nonce int64) []byte {
+	blockBytes := data.Uint32ToBytes(block)
+	var nonceBytes [8]byte
+	binary.BigEndian.PutUint64(nonceBytes[:], uint64(nonce))
+	return crypto.Keccak256(
+		[]byte("Privatix: balance query signature"),
+		agentAddr.Bytes(),
+		blockBytes[:],
+		offeringHash.Bytes(),
+		nonceBytes[:],
+	)
+}
+
+// handleBalance replies with a channel state to a client, which proves
+// the channel ownership.
+func (s *Server) handleBalance(w http.ResponseWriter, r *http.Request) {
+	query, ok := s.parseBalanceQuery(w, r)
+	if !ok {
+		return
+	}
+
+	ch, status, err := s.findChannel(query.OfferingHash,
+		query.AgentAddress, query.OpenBlockNumber)
+	if err == nil {
+		status, err = s.validateBalanceQuery(ch, query)
+	}
+	if err != nil {
+		s.replyErr(w, status, err)
+		return
+	}
+
+	reply := &BalanceReply{ReceiptBalance: ch.ReceiptBalance}
+	if err := s.db.QueryRow(`
+		SELECT COALESCE(SUM(units_used), 0),
+		       COALESCE(SUM(seconds_consumed), 0)
+		  FROM sessions
+		 WHERE channel = $1`, ch.ID).Scan(
+		&reply.UnitsUsed, &reply.SecondsConsumed); err != nil {
+		s.logger.Warn("failed to sum channel usage: %v", err)
+		s.replyErr(w, http.StatusInternalServerError, errUnexpected)
+		return
+	}
+
+	s.reply(w, reply)
+}
+
+func (s *Server) parseBalanceQuery(w http.ResponseWriter,
+	r *http.Request) (*balanceQuery, bool) {
+	params := r.URL.Query()
+
+	block, err := strconv.ParseUint(params.Get(paramOpenBlockNum), 10, 32)
+	if err != nil {
+		s.replyErr(w, http.StatusBadRequest, errInvalidPayload)
+		return nil, false
+	}
+
+	nonce, err := strconv.ParseInt(params.Get(paramNonce), 10, 64)
+	if err != nil {
+		s.replyErr(w, http.StatusBadRequest, errInvalidPayload)
+		return nil, false
+	}
+
+	return &balanceQuery{
+		AgentAddress:    params.Get(paramAgentAddress),
+		OpenBlockNumber: uint32(block),
+		OfferingHash:    params.Get(paramOfferingHash),
+		Nonce:           nonce,
+		Signature:       params.Get(paramSignature),
+	}, true
+}
+
+func (s *Server) validateBalanceQuery(ch *data.Channel,
+	query *balanceQuery) (int, *serverError) {
+	if status, err := s.limitChannel(ch); err != nil {
+		return status, err
+	}
+	if status, err := s.validateNonce(query.Nonce); err != nil {
+		return status, err
+	}
+	return s.verifyQuerySignature(ch, query)
+}
+
+func (s *Server) validateNonce(nonce int64) (int, *serverError) {
+	skew := time.Since(time.Unix(nonce, 0))
+	if skew > maxNonceSkew || skew < -maxNonceSkew {
+		return http.StatusBadRequest, errInvalidNonce
+	}
+	return 0, nil
+}
+
+func (s *Server) verifyQuerySignature(ch *data.Channel,
+	query *balanceQuery) (int, *serverError) {
+	agentAddr, err := data.ToAddress(ch.Agent)
+	if err != nil {
+		return http.StatusInternalServerError, errUnexpected
+	}
+
+	offeringHash, err := data.ToHash(query.OfferingHash)
+	if err != nil {
+		return http.StatusBadRequest, errInvalidPayload
+	}
+
+	hash := balanceQueryHash(agentAddr, query.OpenBlockNumber,
+		offeringHash, query.Nonce)
+
+	return s.verifyClientSignature(ch, hash, query.Signature)
+}
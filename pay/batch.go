@@ -0,0 +1,49 @@
+package pay
+
+import (
+	"net/http"
+)
+
+// batchPayload is a set of balance proofs received from a client.
+type batchPayload struct {
+	Payments []payload `json:"payments"`
+}
+
+// batchResult is a result of a balance proof processing.
+type batchResult struct {
+	Status int          `json:"status"`
+	Error  *serverError `json:"error,omitempty"`
+}
+
+// batchReply holds results of balance proofs in the same order.
+type batchReply struct {
+	Results []*batchResult `json:"results"`
+}
+
+// handlePayBatch handles several balance proofs in one request. Proofs are
+// processed independently, failed ones do not affect others.
+func (s *Server) handlePayBatch(w http.ResponseWriter, r *http.Request) {
+	max := s.conf.MaxBodySize
+	if s.conf.MaxBatchSize != 0 {
+		max *= int64(s.conf.MaxBatchSize)
+	}
+
+	pld := &batchPayload{}
+	if !s.parseBody(w, r, pld, max) {
+		return
+	}
+
+	if s.conf.MaxBatchSize > 0 &&
+		len(pld.Payments) > int(s.conf.MaxBatchSize) {
+		s.replyErr(w, http.StatusRequestEntityTooLarge, errPayloadTooLarge)
+		return
+	}
+
+	reply := &batchReply{Results: make([]*batchResult, len(pld.Payments))}
+	for i := range pld.Payments {
+		status, err := s.processPayment(r, &pld.Payments[i])
+		reply.Results[i] = &batchResult{Status: status, Error: err}
+	}
+
+	s.reply(w, reply)
+}
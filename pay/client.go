@@ -4,8 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"math/big"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -14,10 +15,11 @@ import (
 
 	"github.com/privatix/dappctrl/data"
 	"github.com/privatix/dappctrl/eth"
+	"github.com/privatix/dappctrl/signer"
 )
 
-func newPayload(db *reform.DB,
-	channel, pscAddr, pass string, amount uint64) (*payload, error) {
+func newPayload(db *reform.DB, channel, pscAddr string,
+	s signer.Signer, amount data.Amount) (*payload, error) {
 	var ch data.Channel
 	if err := db.FindByPrimaryKeyTo(&ch, channel); err != nil {
 		return nil, err
@@ -28,11 +30,6 @@ func newPayload(db *reform.DB,
 		return nil, err
 	}
 
-	var client data.Account
-	if err := db.FindByPrimaryKeyTo(&client, ch.Client); err != nil {
-		return nil, err
-	}
-
 	pld := &payload{
 		AgentAddress:    ch.Agent,
 		OpenBlockNumber: ch.Block,
@@ -46,20 +43,20 @@ func newPayload(db *reform.DB,
 		return nil, err
 	}
 
-	offerHash, err := data.ToHash(offer.Hash)
+	clientAddr, err := data.ToAddress(ch.Client)
 	if err != nil {
 		return nil, err
 	}
 
-	hash := eth.BalanceProofHash(common.HexToAddress(pscAddr),
-		agentAddr, ch.Block, offerHash, big.NewInt(int64(amount)))
-
-	key, err := data.ToPrivateKey(client.PrivateKey, pass)
+	offerHash, err := data.ToHash(offer.Hash)
 	if err != nil {
 		return nil, err
 	}
 
-	sig, err := crypto.Sign(hash, key)
+	hash := eth.BalanceProofHash(common.HexToAddress(pscAddr),
+		agentAddr, ch.Block, offerHash, amount.Big())
+
+	sig, err := s.SignHash(clientAddr, hash)
 	if err != nil {
 		return nil, err
 	}
@@ -69,56 +66,279 @@ func newPayload(db *reform.DB,
 	return pld, nil
 }
 
-func postPayload(db *reform.DB, channel string,
-	pld *payload, tls bool, timeout uint) error {
-	body, err := json.Marshal(pld)
-	if err != nil {
-		return err
-	}
-
+// serverURL returns a payment server URL of a channel for a given path.
+func serverURL(db *reform.DB, channel, path string, tls bool) (string, error) {
 	var endp data.Endpoint
 	if err := db.FindOneTo(&endp, "channel", channel); err != nil {
-		return err
+		return "", err
 	}
 
 	if endp.PaymentReceiverAddress == nil {
-		return fmt.Errorf("no payment addr found for chan %s", channel)
+		return "", fmt.Errorf("no payment addr found for chan %s", channel)
 	}
 
-	url := *endp.PaymentReceiverAddress + payPath
+	addr := *endp.PaymentReceiverAddress + path
 	if tls {
-		url = "https://" + url
-	} else {
-		url = "http://" + url
+		return "https://" + addr, nil
+	}
+	return "http://" + addr, nil
+}
+
+// replyError returns an error from an unsuccessful server reply.
+func replyError(resp *http.Response) error {
+	var reply serverError
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return err
+	}
+	return &reply
+}
+
+// postJSON posts a value to a payment server of a channel and decodes
+// a reply to a given value unless it is nil.
+func postJSON(db *reform.DB, channel, path string, v interface{},
+	tls bool, timeout uint, reply interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	addr, err := serverURL(db, channel, path, tls)
+	if err != nil {
+		return err
 	}
 
 	client := http.Client{
 		Timeout: time.Duration(timeout) * time.Millisecond,
 	}
 
-	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	resp, err := client.Post(addr, "application/json", bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		var err serverError
-		if err := json.NewDecoder(resp.Body).Decode(&err); err != nil {
-			return err
-		}
-		return fmt.Errorf("%s (%d)", err.Message, err.Code)
+		return replyError(resp)
 	}
 
-	return nil
+	if reply == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(reply)
+}
+
+func postPayload(db *reform.DB, channel string,
+	pld *payload, tls bool, timeout uint) error {
+	return postJSON(db, channel, payPath, pld, tls, timeout, nil)
 }
 
 // PostCheque sends a payment cheque to a payment server.
-func PostCheque(db *reform.DB, channel, pscAddr, pass string,
-	amount uint64, tls bool, timeout uint) error {
-	pld, err := newPayload(db, channel, pscAddr, pass, amount)
+func PostCheque(db *reform.DB, channel, pscAddr string, s signer.Signer,
+	amount data.Amount, tls bool, timeout uint) error {
+	pld, err := newPayload(db, channel, pscAddr, s, amount)
 	if err != nil {
 		return err
 	}
 	return postPayload(db, channel, pld, tls, timeout)
 }
+
+// PostCheques sends several payment cheques to a payment server in one
+// request. Channels of the cheques must have the same payment receiver.
+// Returned errors correspond to the cheques, nil for accepted ones.
+func PostCheques(db *reform.DB, cheques []*data.Cheque, pscAddr string,
+	s signer.Signer, tls bool, timeout uint) ([]error, error) {
+	if len(cheques) == 0 {
+		return nil, nil
+	}
+
+	pld := &batchPayload{}
+	for _, v := range cheques {
+		p, err := newPayload(db, v.Channel, pscAddr, s, v.Amount)
+		if err != nil {
+			return nil, err
+		}
+		pld.Payments = append(pld.Payments, *p)
+	}
+
+	var reply batchReply
+	if err := postJSON(db, cheques[0].Channel, batchPath, pld, tls,
+		timeout, &reply); err != nil {
+		return nil, err
+	}
+
+	if len(reply.Results) != len(cheques) {
+		return nil, fmt.Errorf("unexpected number of batch results: %d",
+			len(reply.Results))
+	}
+
+	errs := make([]error, len(cheques))
+	for i, v := range reply.Results {
+		if v.Error != nil {
+			errs[i] = v.Error
+		} else if v.Status != http.StatusOK {
+			errs[i] = fmt.Errorf("unexpected status: %d", v.Status)
+		}
+	}
+
+	return errs, nil
+}
+
+// QueryBalance requests a channel state accepted by an agent.
+func QueryBalance(db *reform.DB, channel string, s signer.Signer,
+	tls bool, timeout uint) (*BalanceReply, error) {
+	var ch data.Channel
+	if err := db.FindByPrimaryKeyTo(&ch, channel); err != nil {
+		return nil, err
+	}
+
+	var offer data.Offering
+	if err := db.FindByPrimaryKeyTo(&offer, ch.Offering); err != nil {
+		return nil, err
+	}
+
+	agentAddr, err := data.ToAddress(ch.Agent)
+	if err != nil {
+		return nil, err
+	}
+
+	clientAddr, err := data.ToAddress(ch.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	offerHash, err := data.ToHash(offer.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := time.Now().Unix()
+	sig, err := s.SignHash(clientAddr,
+		balanceQueryHash(agentAddr, ch.Block, offerHash, nonce))
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := serverURL(db, channel, balancePath, tls)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set(paramAgentAddress, ch.Agent)
+	params.Set(paramOpenBlockNum, strconv.FormatUint(uint64(ch.Block), 10))
+	params.Set(paramOfferingHash, offer.Hash)
+	params.Set(paramNonce, strconv.FormatInt(nonce, 10))
+	params.Set(paramSignature, data.FromBytes(sig))
+
+	client := http.Client{
+		Timeout: time.Duration(timeout) * time.Millisecond,
+	}
+
+	resp, err := client.Get(base + "?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, replyError(resp)
+	}
+
+	var reply BalanceReply
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return nil, err
+	}
+
+	return &reply, nil
+}
+
+// CloseSignatures are signatures required for a cooperative close of
+// a channel.
+type CloseSignatures struct {
+	Balance       data.Amount
+	BalanceMsgSig []byte
+	ClosingSig    []byte
+}
+
+// RequestCloseSignatures requests an agent closing signature for the
+// receipt balance of a channel and checks that it is made by the agent.
+func RequestCloseSignatures(db *reform.DB, channel, pscAddr string,
+	s signer.Signer, tls bool, timeout uint) (*CloseSignatures, error) {
+	var ch data.Channel
+	if err := db.FindByPrimaryKeyTo(&ch, channel); err != nil {
+		return nil, err
+	}
+
+	// Balance proof is not sent, it is required for the contract only.
+	pld, err := newPayload(db, channel, pscAddr, s, ch.ReceiptBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	agentAddr, err := data.ToAddress(ch.Agent)
+	if err != nil {
+		return nil, err
+	}
+
+	clientAddr, err := data.ToAddress(ch.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	offerHash, err := data.ToHash(pld.OfferingHash)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &closeRequest{
+		AgentAddress:    ch.Agent,
+		OpenBlockNumber: ch.Block,
+		OfferingHash:    pld.OfferingHash,
+		Balance:         ch.ReceiptBalance,
+		Nonce:           time.Now().Unix(),
+	}
+
+	sig, err := s.SignHash(clientAddr, closeRequestHash(
+		common.HexToAddress(pscAddr), agentAddr, ch.Block, offerHash,
+		ch.ReceiptBalance.Big(), req.Nonce))
+	if err != nil {
+		return nil, err
+	}
+	req.Signature = data.FromBytes(sig)
+
+	var reply closeReply
+	if err := postJSON(db, channel, closePath, req, tls, timeout,
+		&reply); err != nil {
+		return nil, err
+	}
+
+	closingSig, err := data.ToBytes(reply.ClosingSig)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := eth.BalanceClosingHash(clientAddr, common.HexToAddress(pscAddr),
+		ch.Block, offerHash, ch.ReceiptBalance.Big())
+
+	pub, err := crypto.SigToPub(hash, closingSig)
+	if err != nil {
+		return nil, err
+	}
+
+	if crypto.PubkeyToAddress(*pub) != agentAddr {
+		return nil, fmt.Errorf("closing signature for chan %s is not"+
+			" made by the agent", channel)
+	}
+
+	balanceMsgSig, err := data.ToBytes(pld.BalanceMsgSig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CloseSignatures{
+		Balance:       ch.ReceiptBalance,
+		BalanceMsgSig: balanceMsgSig,
+		ClosingSig:    closingSig,
+	}, nil
+}
@@ -0,0 +1,218 @@
+package pay
+
+import (
+	"encoding/binary"
+	"math/big"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/eth"
+)
+
+// closeRequest is a request of an agent closing signature received from
+// a client.
+type closeRequest struct {
+	AgentAddress    string      `json:"agentAddress"`
+	OpenBlockNumber uint32      `json:"openBlockNum"`
+	OfferingHash    string      `json:"offeringHash"`
+	Balance         data.Amount `json:"balance"`
+	Nonce           int64       `json:"nonce"` // Unix time of the request.
+	Signature       string      `json:"sig"`
+}
+
+// closeReply is an agent closing signature for a receipt balance.
+type closeReply struct {
+	ClosingSig string `json:"closingSig"`
+}
+
+// closeRequestHash returns a hash a client signs to request a closing
+// signature. Unlike balance proofs it can't be taken from payments.
+func closeRequestHash(pscAddr, agentAddr common.Address, block uint32,
+	offeringHash common.Hash, balance *big.Int, nonce int64) []byte {
+	blockBytes := data.Uint32ToBytes(block)
+	var nonceBytes [8]byte
+	binary.BigEndian.PutUint64(nonceBytes[:], uint64(nonce))
+	return crypto.Keccak256(
+		[]byte("Privatix: close request signature"),
+		pscAddr.Bytes(),
+		agentAddr.Bytes(),
+		blockBytes[:],
+		offeringHash.Bytes(),
+		common.LeftPadBytes(balance.Bytes(), 32),
+		nonceBytes[:],
+	)
+}
+
+// handleClose replies with an agent closing signature for the latest
+// receipt balance of a channel. The client proves the channel ownership
+// with a signed close request for the receipt balance. The service is
+// terminated and no payments are accepted for the channel after that.
+func (s *Server) handleClose(w http.ResponseWriter, r *http.Request) {
+	req := &closeRequest{}
+	if !s.parsePayload(w, r, req) {
+		return
+	}
+
+	sig, status, err := s.processClose(req)
+	if err != nil {
+		s.replyErr(w, status, err)
+		return
+	}
+
+	s.reply(w, &closeReply{ClosingSig: sig})
+}
+
+// processClose validates a close request and returns an agent closing
+// signature.
+func (s *Server) processClose(req *closeRequest) (string, int, *serverError) {
+	ch, status, err := s.findChannel(req.OfferingHash, req.AgentAddress,
+		req.OpenBlockNumber)
+	if err != nil {
+		return "", status, err
+	}
+
+	if status, err := s.limitChannel(ch); err != nil {
+		return "", status, err
+	}
+
+	if status, err := s.validateChannelState(ch); err != nil {
+		return "", status, err
+	}
+
+	if status, err := s.validateNonce(req.Nonce); err != nil {
+		return "", status, err
+	}
+
+	if status, err := s.validateClosingBalance(ch,
+		req.Balance); err != nil {
+		return "", status, err
+	}
+
+	if status, err := s.verifyCloseSignature(ch, req); err != nil {
+		return "", status, err
+	}
+
+	if ch.ClosingSignature == nil {
+		if status, err := s.terminateService(ch); err != nil {
+			return "", status, err
+		}
+	}
+
+	return s.signClosing(ch, req.Balance)
+}
+
+func (s *Server) validateClosingBalance(ch *data.Channel,
+	balance data.Amount) (int, *serverError) {
+	if balance.Cmp(ch.ReceiptBalance) != 0 {
+		return http.StatusConflict, errBalanceMismatch
+	}
+	return 0, nil
+}
+
+func (s *Server) verifyCloseSignature(ch *data.Channel,
+	req *closeRequest) (int, *serverError) {
+	agentAddr, err := data.ToAddress(ch.Agent)
+	if err != nil {
+		return http.StatusInternalServerError, errUnexpected
+	}
+
+	offeringHash, err := data.ToHash(req.OfferingHash)
+	if err != nil {
+		return http.StatusBadRequest, errInvalidPayload
+	}
+
+	hash := closeRequestHash(s.pscAddr, agentAddr, req.OpenBlockNumber,
+		offeringHash, req.Balance.Big(), req.Nonce)
+
+	return s.verifyClientSignature(ch, hash, req.Signature)
+}
+
+func (s *Server) terminateService(ch *data.Channel) (int, *serverError) {
+	if ch.ServiceStatus == data.ServiceTerminated {
+		return 0, nil
+	}
+
+	if _, err := s.pr.TerminateChannel(ch.ID, data.JobPayServer); err != nil {
+		s.logger.Warn("failed to terminate service of chan %s: %v",
+			ch.ID, err)
+		return http.StatusInternalServerError, errUnexpected
+	}
+
+	s.logger.Info("triggered termination for chan %s on close request",
+		ch.ID)
+	return 0, nil
+}
+
+// signClosing makes and records an agent closing signature for a receipt
+// balance. A recorded signature is returned if there is one.
+func (s *Server) signClosing(ch *data.Channel,
+	balance data.Amount) (string, int, *serverError) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		s.logger.Warn("failed to begin transaction: %v", err)
+		return "", http.StatusInternalServerError, errUnexpected
+	}
+	defer tx.Rollback()
+
+	// Payments and close requests are serialized by the channel lock.
+	if err := tx.SelectOneTo(ch, "WHERE id = $1 FOR UPDATE",
+		ch.ID); err != nil {
+		s.logger.Warn("failed to lock channel: %v", err)
+		return "", http.StatusInternalServerError, errUnexpected
+	}
+
+	if status, err := s.validateClosingBalance(ch, balance); err != nil {
+		return "", status, err
+	}
+
+	if ch.ClosingSignature != nil {
+		return *ch.ClosingSignature, 0, nil
+	}
+
+	var offer data.Offering
+	if err := tx.FindByPrimaryKeyTo(&offer, ch.Offering); err != nil {
+		s.logger.Warn("failed to find offering: %v", err)
+		return "", http.StatusInternalServerError, errUnexpected
+	}
+
+	agentAddr, err := data.ToAddress(ch.Agent)
+	if err != nil {
+		return "", http.StatusInternalServerError, errUnexpected
+	}
+
+	clientAddr, err := data.ToAddress(ch.Client)
+	if err != nil {
+		return "", http.StatusInternalServerError, errUnexpected
+	}
+
+	offeringHash, err := data.ToHash(offer.Hash)
+	if err != nil {
+		return "", http.StatusInternalServerError, errUnexpected
+	}
+
+	hash := eth.BalanceClosingHash(clientAddr, s.pscAddr, ch.Block,
+		offeringHash, ch.ReceiptBalance.Big())
+
+	sig, err := s.signer.SignHash(agentAddr, hash)
+	if err != nil {
+		s.logger.Warn("failed to sign closing msg: %v", err)
+		return "", http.StatusInternalServerError, errUnexpected
+	}
+
+	closingSig := data.FromBytes(sig)
+	ch.ClosingSignature = &closingSig
+	if err := tx.Update(ch); err != nil {
+		s.logger.Warn("failed to update channel: %v", err)
+		return "", http.StatusInternalServerError, errUnexpected
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Warn("failed to commit transaction: %v", err)
+		return "", http.StatusInternalServerError, errUnexpected
+	}
+
+	return closingSig, 0, nil
+}
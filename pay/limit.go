@@ -0,0 +1,82 @@
+package pay
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepPeriod is a period idle buckets are removed with.
+const sweepPeriod = time.Minute
+
+// limiter is a token bucket rate limiter with a bucket per key.
+type limiter struct {
+	rate    float64 // Tokens per second, zero disables limiting.
+	burst   float64
+	mtx     sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time // Is overrided in unit-tests.
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst uint) *limiter {
+	if burst == 0 {
+		burst = 1
+	}
+	return &limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// allow takes a token from a bucket of a given key, if there is one.
+func (l *limiter) allow(key string) bool {
+	if l.rate <= 0 {
+		return true
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst,
+		b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// sweep removes buckets, which are refilled completely.
+func (l *limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepPeriod {
+		return
+	}
+	l.swept = now
+
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for k, b := range l.buckets {
+		if now.Sub(b.last) >= refill {
+			delete(l.buckets, k)
+		}
+	}
+}
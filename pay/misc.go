@@ -2,15 +2,25 @@ package pay
 
 import (
 	"encoding/json"
-	"math/big"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	reform "gopkg.in/reform.v1"
 
 	"github.com/privatix/dappctrl/data"
 	"github.com/privatix/dappctrl/eth"
+	"github.com/privatix/dappctrl/util"
 )
 
+// signatureLength is a length of a signature in [R || S || V] format.
+const signatureLength = 65
+
 // serverError is a payment server error.
 type serverError struct {
 	// Code is a status code.
@@ -19,133 +29,303 @@ type serverError struct {
 	Message string `json:"message"`
 }
 
+func (e *serverError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// IsStaleBalance tells whether an error is a rejection of a balance, which is
+// not greater than the one already accepted by an agent.
+func IsStaleBalance(err error) bool {
+	e, ok := err.(*serverError)
+	return ok && e.Code == ErrStaleBalance.Code
+}
+
+// Error catalog. Codes are stable, clients can rely on them:
+//
+//	code  HTTP status  meaning
+//	1     400          request payload is malformed
+//	2     413          request payload exceeds MaxBodySize or MaxBatchSize
+//	3     429          request rate of an IP address or a channel is exceeded
+//	4     404          channel is not found
+//	5     409          channel is not active
+//	6     409          balance is not greater than the accepted one
+//	7     400          balance exceeds the channel deposit
+//	8     400          client signature does not match
+//	9     400          balance query nonce is out of the allowed window
+//	10    409          channel is being closed, payments are not accepted
+//	11    409          balance differs from the accepted one
+//	100   500          unexpected server error
 var (
 	errInvalidPayload = &serverError{
-		Message: "",
+		Code:    1,
+		Message: "Request payload is invalid",
+	}
+	errPayloadTooLarge = &serverError{
+		Code:    2,
+		Message: "Request payload is too large",
+	}
+	errTooManyRequests = &serverError{
+		Code:    3,
+		Message: "Too many requests",
 	}
 	errNoChannel = &serverError{
+		Code:    4,
 		Message: "Channel is not found",
 	}
-	errUnexpected = &serverError{
-		Message: "An unexpected error occurred",
-	}
 	errChannelClosed = &serverError{
+		Code:    5,
 		Message: "Channel is closed",
 	}
+	// ErrStaleBalance is exported for clients to handle stale balances,
+	// see IsStaleBalance.
+	ErrStaleBalance = &serverError{
+		Code:    6,
+		Message: "Balance is not greater than the accepted one",
+	}
 	errInvalidAmount = &serverError{
-		Message: "Invalid balance amount",
+		Code:    7,
+		Message: "Balance exceeds the channel deposit",
 	}
 	errInvalidSignature = &serverError{
+		Code:    8,
 		Message: "Client signature does not match",
 	}
+	errInvalidNonce = &serverError{
+		Code:    9,
+		Message: "Query nonce is expired",
+	}
+	errChannelClosing = &serverError{
+		Code:    10,
+		Message: "Channel is being closed",
+	}
+	errBalanceMismatch = &serverError{
+		Code:    11,
+		Message: "Balance differs from the accepted one",
+	}
+	errUnexpected = &serverError{
+		Code:    100,
+		Message: "An unexpected error occurred",
+	}
 )
 
-func (s *Server) findChannel(w http.ResponseWriter,
-	offeringHash string,
-	agentAddr string,
-	block uint32) (*data.Channel, bool) {
-
+// findChannel finds a channel a request is made for.
+func (s *Server) findChannel(offeringHash string,
+	agentAddr string, block uint32) (*data.Channel, int, *serverError) {
 	ch := &data.Channel{}
 
-	tail := "INNER JOIN offerings ON offerings.hash=$1 WHERE channels.agent=$2 AND channels.block=$3"
+	tail := `INNER JOIN offerings ON offerings.id = channels.offering
+		WHERE offerings.hash = $1 AND channels.agent = $2
+		  AND channels.block = $3`
 	err := s.db.SelectOneTo(ch, tail, offeringHash, agentAddr, block)
-	if err != nil {
-		s.replyErr(w, http.StatusUnauthorized, errNoChannel)
-		return nil, false
+	if err == reform.ErrNoRows {
+		return nil, http.StatusNotFound, errNoChannel
+	} else if err != nil {
+		s.logger.Warn("failed to find channel: %v", err)
+		return nil, http.StatusInternalServerError, errUnexpected
 	}
 
-	return ch, true
+	return ch, 0, nil
 }
 
-func (s *Server) validateChannelState(w http.ResponseWriter,
-	ch *data.Channel) bool {
-	if ch.ChannelStatus != data.ChannelActive {
-		s.replyErr(w, http.StatusUnauthorized, errChannelClosed)
-		return false
+// limitChannel rejects requests for channels exceeding the request rate.
+// It bounds hammering with stale balances, which are rejected before
+// signature verification.
+func (s *Server) limitChannel(ch *data.Channel) (int, *serverError) {
+	if !s.chanLimit.allow(ch.ID) {
+		return http.StatusTooManyRequests, errTooManyRequests
 	}
-	return true
+	return 0, nil
 }
 
-func (s *Server) validateAmount(w http.ResponseWriter,
-	ch *data.Channel, pld *payload) bool {
-	if pld.Balance <= ch.ReceiptBalance || pld.Balance > ch.TotalDeposit {
-		s.replyErr(w, http.StatusBadRequest, errInvalidAmount)
-		return false
+func (s *Server) validateChannelState(ch *data.Channel) (int, *serverError) {
+	if ch.ChannelStatus != data.ChannelActive {
+		return http.StatusConflict, errChannelClosed
 	}
-	return true
+	return 0, nil
 }
 
-func (s *Server) verifySignature(w http.ResponseWriter,
-	ch *data.Channel, pld *payload) bool {
-
-	client := &data.User{}
-	if s.db.FindOneTo(client, "eth_addr", ch.Client) != nil {
-		s.replyErr(w, http.StatusInternalServerError, errUnexpected)
-		return false
+func (s *Server) validateAmount(ch *data.Channel,
+	pld *payload) (int, *serverError) {
+	// Replayed balance proofs are stale as balances only grow.
+	if pld.Balance.Cmp(ch.ReceiptBalance) <= 0 {
+		return http.StatusConflict, ErrStaleBalance
 	}
-
-	pub, err := data.ToBytes(client.PublicKey)
-	if err != nil {
-		s.replyErr(w, http.StatusInternalServerError, errUnexpected)
-		return false
-	}
-
-	sig, err := data.ToBytes(pld.BalanceMsgSig)
-	if err != nil {
-		s.replyErr(w, http.StatusInternalServerError, errUnexpected)
-		return false
+	if pld.Balance.Cmp(ch.TotalDeposit) > 0 {
+		return http.StatusBadRequest, errInvalidAmount
 	}
+	return 0, nil
+}
 
+// verifySignature checks a client balance proof, which is accepted only for
+// the contract the agent redeems balance proofs at.
+func (s *Server) verifySignature(ch *data.Channel,
+	pld *payload) (int, *serverError) {
 	pscAddr, err := data.ToAddress(pld.ContractAddress)
-	if err != nil {
-		s.replyErr(w, http.StatusInternalServerError, errUnexpected)
-		return false
+	if err != nil || pscAddr != s.pscAddr {
+		return http.StatusBadRequest, errInvalidPayload
 	}
 
+	return s.verifyBalanceProof(ch, pld, s.pscAddr)
+}
+
+// verifyBalanceProof checks a client balance proof for a given contract.
+func (s *Server) verifyBalanceProof(ch *data.Channel,
+	pld *payload, pscAddr common.Address) (int, *serverError) {
 	agentAddr, err := data.ToAddress(ch.Agent)
 	if err != nil {
-		s.replyErr(w, http.StatusInternalServerError, errUnexpected)
-		return false
+		return http.StatusInternalServerError, errUnexpected
 	}
 
 	offeringHash, err := data.ToHash(pld.OfferingHash)
 	if err != nil {
-		s.replyErr(w, http.StatusInternalServerError, errUnexpected)
-		return false
+		return http.StatusInternalServerError, errUnexpected
 	}
 
 	hash := eth.BalanceProofHash(pscAddr, agentAddr,
-		pld.OpenBlockNumber, offeringHash, big.NewInt(int64(pld.Balance)))
+		pld.OpenBlockNumber, offeringHash, pld.Balance.Big())
+
+	return s.verifyClientSignature(ch, hash, pld.BalanceMsgSig)
+}
+
+// verifyClientSignature checks that a hash is signed by a channel client.
+func (s *Server) verifyClientSignature(ch *data.Channel,
+	hash []byte, signature string) (int, *serverError) {
+	client := &data.User{}
+	if s.db.FindOneTo(client, "eth_addr", ch.Client) != nil {
+		return http.StatusInternalServerError, errUnexpected
+	}
+
+	pub, err := data.ToBytes(client.PublicKey)
+	if err != nil {
+		return http.StatusInternalServerError, errUnexpected
+	}
+
+	sig, err := data.ToBytes(signature)
+	if err != nil || len(sig) != signatureLength {
+		return http.StatusBadRequest, errInvalidSignature
+	}
 
 	if !crypto.VerifySignature(pub, hash, sig[:len(sig)-1]) {
-		s.replyErr(w, http.StatusBadRequest, errInvalidSignature)
-		return false
+		return http.StatusBadRequest, errInvalidSignature
 	}
-	return true
+	return 0, nil
 }
 
-func (s *Server) validateChannelForPayment(w http.ResponseWriter,
-	ch *data.Channel, pld *payload) bool {
-	return s.validateChannelState(w, ch) &&
-		s.validateAmount(w, ch, pld) &&
-		s.verifySignature(w, ch, pld)
+// validateNotClosing rejects payments after a closing signature is issued.
+func (s *Server) validateNotClosing(ch *data.Channel) (int, *serverError) {
+	if ch.ClosingSignature != nil {
+		return http.StatusConflict, errChannelClosing
+	}
+	return 0, nil
+}
+
+func (s *Server) validateChannelForPayment(ch *data.Channel,
+	pld *payload) (int, *serverError) {
+	if status, err := s.validateChannelState(ch); err != nil {
+		return status, err
+	}
+	if status, err := s.validateNotClosing(ch); err != nil {
+		return status, err
+	}
+	if status, err := s.validateAmount(ch, pld); err != nil {
+		return status, err
+	}
+	return s.verifySignature(ch, pld)
 }
 
-func (s *Server) updateChannelWithPayment(w http.ResponseWriter,
-	ch *data.Channel, pld *payload) bool {
+// updateChannelWithPayment saves a balance proof in a channel and records
+// it in the receipts history.
+func (s *Server) updateChannelWithPayment(r *http.Request,
+	ch *data.Channel, pld *payload) (int, *serverError) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		s.logger.Warn("failed to begin transaction: %v", err)
+		return http.StatusInternalServerError, errUnexpected
+	}
+	defer tx.Rollback()
+
+	// Concurrent payments are serialized by the channel lock.
+	if err := tx.SelectOneTo(ch, "WHERE id = $1 FOR UPDATE",
+		ch.ID); err != nil {
+		s.logger.Warn("failed to lock channel: %v", err)
+		return http.StatusInternalServerError, errUnexpected
+	}
+
+	if status, err := s.validateNotClosing(ch); err != nil {
+		return status, err
+	}
+	if status, err := s.validateAmount(ch, pld); err != nil {
+		return status, err
+	}
+
 	ch.ReceiptBalance = pld.Balance
 	ch.ReceiptSignature = &pld.BalanceMsgSig
-	if err := s.db.Update(ch); err != nil {
+	if err := tx.Update(ch); err != nil {
 		s.logger.Warn("failed to update channel: %v", err)
-		s.replyErr(w, http.StatusInternalServerError, errUnexpected)
-		return false
+		return http.StatusInternalServerError, errUnexpected
 	}
-	return true
+
+	if err := tx.Insert(&data.Receipt{
+		ID:         util.NewUUID(),
+		Channel:    ch.ID,
+		Balance:    pld.Balance,
+		Signature:  pld.BalanceMsgSig,
+		ClientIP:   clientIP(r),
+		ReceivedAt: time.Now(),
+	}); err != nil {
+		s.logger.Warn("failed to insert receipt: %v", err)
+		return http.StatusInternalServerError, errUnexpected
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.Warn("failed to commit transaction: %v", err)
+		return http.StatusInternalServerError, errUnexpected
+	}
+
+	return 0, nil
+}
+
+// clientIP returns an address a request is received from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
 func (s *Server) parsePayload(w http.ResponseWriter,
 	r *http.Request, v interface{}) bool {
-	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+	return s.parseBody(w, r, v, s.conf.MaxBodySize)
+}
+
+// parseBody decodes a request body of a given maximum size, zero size is
+// not limited.
+func (s *Server) parseBody(w http.ResponseWriter,
+	r *http.Request, v interface{}, max int64) bool {
+	body := io.Reader(r.Body)
+	if max > 0 {
+		if r.ContentLength > max {
+			s.replyErr(w, http.StatusRequestEntityTooLarge,
+				errPayloadTooLarge)
+			return false
+		}
+		body = io.LimitReader(r.Body, max+1)
+	}
+
+	buf, err := ioutil.ReadAll(body)
+	if err != nil {
+		s.logger.Warn("failed to read request body: %v", err)
+		s.replyErr(w, http.StatusBadRequest, errInvalidPayload)
+		return false
+	}
+
+	if max > 0 && int64(len(buf)) > max {
+		s.replyErr(w, http.StatusRequestEntityTooLarge, errPayloadTooLarge)
+		return false
+	}
+
+	if err := json.Unmarshal(buf, v); err != nil {
 		s.logger.Warn("failed to parse request body: %v", err)
 		s.replyErr(w, http.StatusBadRequest, errInvalidPayload)
 		return false
@@ -153,10 +333,20 @@ func (s *Server) parsePayload(w http.ResponseWriter,
 	return true
 }
 
+// reply writes a successful reply to response.
+func (s *Server) reply(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Warn("failed to marshal reply to json: %v", err)
+	}
+}
+
 // replyErr writes error to reponse.
 func (s *Server) replyErr(w http.ResponseWriter, status int, reply *serverError) {
-	w.WriteHeader(status)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
 
 	if err := json.NewEncoder(w).Encode(reply); err != nil {
 		s.logger.Warn("failed to marshal error reply to json: %v", err)
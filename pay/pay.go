@@ -2,16 +2,18 @@ package pay
 
 import (
 	"net/http"
+
+	"github.com/privatix/dappctrl/data"
 )
 
 // payload is a balance proof received from a client.
 type payload struct {
-	AgentAddress    string `json:"agentAddress"`
-	OpenBlockNumber uint32 `json:"openBlockNum"`
-	OfferingHash    string `json:"offeringHash"`
-	Balance         uint64 `json:"balance"`
-	BalanceMsgSig   string `json:"balanceMsgSig"`
-	ContractAddress string `json:"contractAddress"`
+	AgentAddress    string      `json:"agentAddress"`
+	OpenBlockNumber uint32      `json:"openBlockNum"`
+	OfferingHash    string      `json:"offeringHash"`
+	Balance         data.Amount `json:"balance"`
+	BalanceMsgSig   string      `json:"balanceMsgSig"`
+	ContractAddress string      `json:"contractAddress"`
 }
 
 // handlePay handles clients balance proof informations.
@@ -20,11 +22,35 @@ func (s *Server) handlePay(w http.ResponseWriter, r *http.Request) {
 	if !s.parsePayload(w, r, pld) {
 		return
 	}
-	ch, ok := s.findChannel(w, pld.OfferingHash, pld.AgentAddress,
-		pld.OpenBlockNumber)
-	if !ok || !s.validateChannelForPayment(w, ch, pld) ||
-		!s.updateChannelWithPayment(w, ch, pld) {
+
+	if status, err := s.processPayment(r, pld); err != nil {
+		s.replyErr(w, status, err)
 		return
 	}
 	w.WriteHeader(http.StatusOK)
 }
+
+// processPayment validates a balance proof and saves it in a channel. It
+// returns a reply status and an error for a rejected balance proof.
+func (s *Server) processPayment(r *http.Request,
+	pld *payload) (int, *serverError) {
+	ch, status, err := s.findChannel(pld.OfferingHash, pld.AgentAddress,
+		pld.OpenBlockNumber)
+	if err != nil {
+		return status, err
+	}
+
+	if status, err := s.limitChannel(ch); err != nil {
+		return status, err
+	}
+
+	if status, err := s.validateChannelForPayment(ch, pld); err != nil {
+		return status, err
+	}
+
+	if status, err := s.updateChannelWithPayment(r, ch, pld); err != nil {
+		return status, err
+	}
+
+	return http.StatusOK, nil
+}
@@ -5,11 +5,16 @@ package pay
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -17,20 +22,37 @@ import (
 
 	"github.com/privatix/dappctrl/data"
 	"github.com/privatix/dappctrl/eth"
+	"github.com/privatix/dappctrl/signer"
 	"github.com/privatix/dappctrl/util"
 )
 
 var (
-	testServer *Server
-	testDB     *reform.DB
+	testServer  *Server
+	testDB      *reform.DB
+	testPSCAddr = common.HexToAddress("0x1")
 )
 
+type testTerminator struct {
+	terminated []string
+	err        error
+}
+
+func (p *testTerminator) TerminateChannel(id,
+	jobCreator string) (string, error) {
+	if p.err != nil {
+		return "", p.err
+	}
+	p.terminated = append(p.terminated, id)
+	return util.NewUUID(), nil
+}
+
 type testFixture struct {
 	clientAcc *data.Account
 	client    *data.User
 	agent     *data.Account
 	offering  *data.Offering
 	channel   *data.Channel
+	template  *data.Template
 }
 
 func newFixture(t *testing.T) *testFixture {
@@ -57,30 +79,36 @@ func newFixture(t *testing.T) *testFixture {
 	data.InsertToTestDB(t, testDB, client, agent, product, template,
 		offering, channel)
 
-	return &testFixture{clientAcc, client, agent, offering, channel}
+	return &testFixture{clientAcc, client, agent, offering, channel,
+		template}
 }
 
-func newTestPayload(t *testing.T, amount uint64, channel *data.Channel,
+func newTestPayload(t *testing.T, amount data.Amount, channel *data.Channel,
 	offering *data.Offering, clientAcc *data.Account) *payload {
+	return newTestContractPayload(t, testPSCAddr, amount, channel,
+		offering, clientAcc)
+}
 
-	testPSCAddr := common.HexToAddress("0x1")
+func newTestContractPayload(t *testing.T, pscAddr common.Address,
+	amount data.Amount, channel *data.Channel, offering *data.Offering,
+	clientAcc *data.Account) *payload {
 
 	pld := &payload{
 		AgentAddress:    channel.Agent,
 		OpenBlockNumber: channel.Block,
 		OfferingHash:    offering.Hash,
 		Balance:         amount,
-		ContractAddress: data.FromBytes(testPSCAddr.Bytes()),
+		ContractAddress: data.FromBytes(pscAddr.Bytes()),
 	}
 
 	agentAddr := data.TestToAddress(t, channel.Agent)
 
 	offeringHash := data.TestToHash(t, pld.OfferingHash)
 
-	hash := eth.BalanceProofHash(testPSCAddr, agentAddr,
-		pld.OpenBlockNumber, offeringHash, big.NewInt(int64(pld.Balance)))
+	hash := eth.BalanceProofHash(pscAddr, agentAddr,
+		pld.OpenBlockNumber, offeringHash, pld.Balance.Big())
 
-	key, err := data.TestToPrivateKey(clientAcc.PrivateKey, data.TestPassword)
+	key, err := data.TestToPrivateKey(*clientAcc.PrivateKey, data.TestPassword)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -109,7 +137,7 @@ func TestValidPayment(t *testing.T) {
 	fixture := newFixture(t)
 
 	// 100 is a test payment amount
-	payload := newTestPayload(t, 100, fixture.channel, fixture.offering, fixture.clientAcc)
+	payload := newTestPayload(t, data.NewAmount(100), fixture.channel, fixture.offering, fixture.clientAcc)
 	w := sendTestRequest(payload)
 	if w.Code != http.StatusOK {
 		t.Errorf("expect response ok, got: %d", w.Code)
@@ -126,16 +154,66 @@ func TestValidPayment(t *testing.T) {
 		t.Error("receipt signature is not updated")
 	}
 
-	if updated.ReceiptBalance != payload.Balance {
+	if updated.ReceiptBalance.Cmp(payload.Balance) != 0 {
 		t.Error("receipt balance is not updated")
 	}
+
+	// Repeated payment is rejected and not recorded.
+	if w := sendTestRequest(payload); w.Code != http.StatusBadRequest {
+		t.Errorf("expect bad request, got: %d", w.Code)
+	}
+
+	receipts, err := testDB.FindAllFrom(data.ReceiptTable,
+		"channel", updated.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(receipts) != 1 {
+		t.Fatalf("expected 1 receipt, got: %d", len(receipts))
+	}
+
+	receipt := receipts[0].(*data.Receipt)
+	if receipt.Balance.Cmp(payload.Balance) != 0 ||
+		receipt.Signature != payload.BalanceMsgSig ||
+		receipt.ClientIP != "192.0.2.1" {
+		t.Errorf("wrong receipt: %+v", receipt)
+	}
+}
+
+func TestHugePayment(t *testing.T) {
+	defer data.CleanTestDB(t, testDB)
+	fixture := newFixture(t)
+
+	// Both deposit and balance do not fit into int64.
+	huge := new(big.Int).Lsh(big.NewInt(1), 70)
+	fixture.channel.TotalDeposit = data.NewAmountFromBig(huge)
+	data.SaveToTestDB(t, testDB, fixture.channel)
+
+	amount := data.NewAmountFromBig(new(big.Int).Rsh(huge, 1))
+	payload := newTestPayload(t, amount, fixture.channel,
+		fixture.offering, fixture.clientAcc)
+	w := sendTestRequest(payload)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect response ok, got: %d, %s", w.Code, w.Body)
+	}
+
+	updated := &data.Channel{}
+	if err := testDB.FindByPrimaryKeyTo(updated,
+		fixture.channel.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if updated.ReceiptBalance.Cmp(amount) != 0 {
+		t.Fatalf("wrong receipt balance: %s", updated.ReceiptBalance)
+	}
 }
 
 func TestInvalidPayments(t *testing.T) {
 	defer data.CleanTestDB(t, testDB)
 	fixture := newFixture(t)
 
-	validPayload := newTestPayload(t, 1, fixture.channel, fixture.offering, fixture.clientAcc)
+	validPayload := newTestPayload(t, data.NewAmount(1), fixture.channel, fixture.offering, fixture.clientAcc)
 	wrongBlock := &payload{
 		AgentAddress:    validPayload.AgentAddress,
 		OpenBlockNumber: validPayload.OpenBlockNumber + 1,
@@ -155,48 +233,598 @@ func TestInvalidPayments(t *testing.T) {
 
 	data.InsertToTestDB(t, testDB, closedChannel, validCh)
 
-	closedState := newTestPayload(t, 1, closedChannel, fixture.offering, fixture.clientAcc)
+	closedState := newTestPayload(t, data.NewAmount(1), closedChannel, fixture.offering, fixture.clientAcc)
 
-	lessBalance := newTestPayload(t, 9, validCh, fixture.offering, fixture.clientAcc)
+	lessBalance := newTestPayload(t, data.NewAmount(9), validCh, fixture.offering, fixture.clientAcc)
 
-	overcharging := newTestPayload(t, 100+1, validCh, fixture.offering, fixture.clientAcc)
+	overcharging := newTestPayload(t, data.NewAmount(100+1), validCh, fixture.offering, fixture.clientAcc)
 
 	otherUser := data.NewTestAccount(data.TestPassword)
-	otherUsersSignature := newTestPayload(t, 100, validCh, fixture.offering, otherUser)
-
-	for _, pld := range []*payload{
-		// wrong block number
-		wrongBlock,
-		// channel state is "closed_coop"
-		closedState,
-		// balance is less then last given
-		lessBalance,
-		// balance is greater then total_deposit
-		overcharging,
-		// signature doesn't correspond to channels user
-		otherUsersSignature,
+	otherUsersSignature := newTestPayload(t, data.NewAmount(100), validCh, fixture.offering, otherUser)
+
+	otherContract := newTestContractPayload(t, common.HexToAddress("0x2"),
+		data.NewAmount(100), validCh, fixture.offering, fixture.clientAcc)
+
+	otherContractSignature := *otherContract
+	otherContractSignature.ContractAddress = validPayload.ContractAddress
+
+	invalidContract := *validPayload
+	invalidContract.ContractAddress = "invalid"
+
+	for _, v := range []struct {
+		name   string
+		pld    *payload
+		status int
+		err    *serverError
+	}{
+		{"wrong block number", wrongBlock,
+			http.StatusNotFound, errNoChannel},
+		{"channel state is closed_coop", closedState,
+			http.StatusConflict, errChannelClosed},
+		{"balance is less then last given", lessBalance,
+			http.StatusConflict, ErrStaleBalance},
+		{"balance is greater then total_deposit", overcharging,
+			http.StatusBadRequest, errInvalidAmount},
+		{"signature doesn't correspond to channels user",
+			otherUsersSignature,
+			http.StatusBadRequest, errInvalidSignature},
+		{"balance proof for other contract", otherContract,
+			http.StatusBadRequest, errInvalidPayload},
+		{"signature for other contract", &otherContractSignature,
+			http.StatusBadRequest, errInvalidSignature},
+		{"malformed contract address", &invalidContract,
+			http.StatusBadRequest, errInvalidPayload},
 	} {
-		w := sendTestRequest(pld)
-		if w.Code == http.StatusOK {
-			t.Logf("response: %d, %s", w.Code, w.Body)
-			t.Logf("payload: %+v\n", pld)
-			t.Errorf("expected server to fail, got: %d", w.Code)
+		w := sendTestRequest(v.pld)
+		expectError(t, v.name, w, v.status, v.err)
+	}
+}
+
+func expectError(t *testing.T, name string, w *httptest.ResponseRecorder,
+	status int, expected *serverError) {
+	if w.Code != status {
+		t.Errorf("%s: expected status %d, got: %d, %s",
+			name, status, w.Code, w.Body)
+		return
+	}
+
+	var reply serverError
+	if err := json.NewDecoder(w.Body).Decode(&reply); err != nil {
+		t.Errorf("%s: failed to decode error: %v", name, err)
+		return
+	}
+
+	if reply != *expected {
+		t.Errorf("%s: expected error %+v, got: %+v",
+			name, *expected, reply)
+	}
+}
+
+func TestInvalidRequests(t *testing.T) {
+	defer data.CleanTestDB(t, testDB)
+	fixture := newFixture(t)
+
+	pld := newTestPayload(t, data.NewAmount(1), fixture.channel,
+		fixture.offering, fixture.clientAcc)
+	body, err := json.Marshal(pld)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(body []byte) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, payPath,
+			bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		testServer.handlePay(w, r)
+		return w
+	}
+
+	expectError(t, "malformed payload", send([]byte("{")),
+		http.StatusBadRequest, errInvalidPayload)
+
+	huge := append(body[:len(body)-1], bytes.Repeat([]byte(" "),
+		int(testServer.conf.MaxBodySize))...)
+	huge = append(huge, '}')
+	expectError(t, "too large payload", send(huge),
+		http.StatusRequestEntityTooLarge, errPayloadTooLarge)
+}
+
+func TestRateLimits(t *testing.T) {
+	defer data.CleanTestDB(t, testDB)
+	fixture := newFixture(t)
+
+	conf := NewConfig()
+	conf.IPRate = 0.01
+	conf.IPBurst = 3
+	conf.ChannelRate = 0.01
+	conf.ChannelBurst = 2
+	srv := NewServer(conf, testServer.logger, testDB, testServer.pr,
+		testPSCAddr, testServer.signer)
+
+	send := func(pld *payload) *httptest.ResponseRecorder {
+		body := &bytes.Buffer{}
+		json.NewEncoder(body).Encode(pld)
+		r := httptest.NewRequest(http.MethodPost, payPath, body)
+		w := httptest.NewRecorder()
+		srv.limitIP(srv.handlePay)(w, r)
+		return w
+	}
+
+	// Hammering with a stale balance is limited per channel.
+	stale := newTestPayload(t, data.NewAmount(0), fixture.channel,
+		fixture.offering, fixture.clientAcc)
+	for i := uint(0); i < conf.ChannelBurst; i++ {
+		expectError(t, "stale balance", send(stale),
+			http.StatusConflict, ErrStaleBalance)
+	}
+	expectError(t, "channel rate", send(stale),
+		http.StatusTooManyRequests, errTooManyRequests)
+
+	expectError(t, "ip rate", send(stale),
+		http.StatusTooManyRequests, errTooManyRequests)
+}
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	l := newLimiter(1, 2)
+	l.now = func() time.Time { return now }
+
+	for i, v := range []struct {
+		key     string
+		elapsed time.Duration
+		allowed bool
+	}{
+		{"a", 0, true},
+		{"a", 0, true},
+		{"a", 0, false},
+		{"b", 0, true},
+		{"a", 500 * time.Millisecond, false},
+		{"a", 500 * time.Millisecond, true},
+		{"a", 0, false},
+		{"a", 10 * time.Second, true},
+		{"a", 0, true},
+		{"a", 0, false},
+	} {
+		now = now.Add(v.elapsed)
+		if l.allow(v.key) != v.allowed {
+			t.Errorf("%d: allowed %v, wanted: %v",
+				i, !v.allowed, v.allowed)
 		}
 	}
+
+	now = now.Add(sweepPeriod)
+	l.allow("a")
+	if len(l.buckets) != 1 {
+		t.Errorf("idle buckets are not removed: %d", len(l.buckets))
+	}
+
+	if !newLimiter(0, 0).allow("a") {
+		t.Errorf("zero rate limiter is not disabled")
+	}
+}
+
+func newTestBalanceQuery(t *testing.T, channel *data.Channel,
+	offering *data.Offering, clientAcc *data.Account,
+	nonce int64) url.Values {
+	agentAddr := data.TestToAddress(t, channel.Agent)
+	offeringHash := data.TestToHash(t, offering.Hash)
+
+	hash := balanceQueryHash(agentAddr, channel.Block, offeringHash, nonce)
+
+	key, err := data.TestToPrivateKey(*clientAcc.PrivateKey, data.TestPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := url.Values{}
+	params.Set(paramAgentAddress, channel.Agent)
+	params.Set(paramOpenBlockNum, fmt.Sprint(channel.Block))
+	params.Set(paramOfferingHash, offering.Hash)
+	params.Set(paramNonce, fmt.Sprint(nonce))
+	params.Set(paramSignature, data.FromBytes(sig))
+	return params
+}
+
+func sendTestBalanceQuery(params url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet,
+		balancePath+"?"+params.Encode(), nil)
+	w := httptest.NewRecorder()
+	util.ValidateMethod(testServer.handleBalance, http.MethodGet)(w, r)
+	return w
+}
+
+func TestBalanceQuery(t *testing.T) {
+	defer data.CleanTestDB(t, testDB)
+	fixture := newFixture(t)
+
+	fixture.channel.ReceiptBalance = data.NewAmount(42)
+	sess := data.NewTestSession(fixture.channel.ID)
+	sess.UnitsUsed = 7
+	sess.SecondsConsumed = 11
+	data.SaveToTestDB(t, testDB, fixture.channel)
+	data.InsertToTestDB(t, testDB, sess)
+
+	now := time.Now().Unix()
+	params := newTestBalanceQuery(t, fixture.channel, fixture.offering,
+		fixture.clientAcc, now)
+	w := sendTestBalanceQuery(params)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect response ok, got: %d, %s", w.Code, w.Body)
+	}
+
+	var reply BalanceReply
+	if err := json.NewDecoder(w.Body).Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+
+	if reply.ReceiptBalance.Cmp(data.NewAmount(42)) != 0 ||
+		reply.UnitsUsed != 7 || reply.SecondsConsumed != 11 {
+		t.Fatalf("wrong balance reply: %+v", reply)
+	}
+
+	expired := newTestBalanceQuery(t, fixture.channel, fixture.offering,
+		fixture.clientAcc, now-int64(2*maxNonceSkew/time.Second))
+
+	otherUser := data.NewTestAccount(data.TestPassword)
+	otherUsersSignature := newTestBalanceQuery(t, fixture.channel,
+		fixture.offering, otherUser, now)
+
+	// Signature is made for another nonce.
+	wrongNonce := newTestBalanceQuery(t, fixture.channel,
+		fixture.offering, fixture.clientAcc, now)
+	wrongNonce.Set(paramNonce, fmt.Sprint(now+1))
+
+	wrongBlock := newTestBalanceQuery(t, fixture.channel,
+		fixture.offering, fixture.clientAcc, now)
+	wrongBlock.Set(paramOpenBlockNum, fmt.Sprint(fixture.channel.Block+1))
+
+	noSignature := newTestBalanceQuery(t, fixture.channel,
+		fixture.offering, fixture.clientAcc, now)
+	noSignature.Del(paramSignature)
+
+	for _, v := range []struct {
+		name   string
+		params url.Values
+		status int
+		err    *serverError
+	}{
+		{"expired nonce", expired,
+			http.StatusBadRequest, errInvalidNonce},
+		{"other user's signature", otherUsersSignature,
+			http.StatusBadRequest, errInvalidSignature},
+		{"wrong nonce", wrongNonce,
+			http.StatusBadRequest, errInvalidSignature},
+		{"wrong block", wrongBlock,
+			http.StatusNotFound, errNoChannel},
+		{"no signature", noSignature,
+			http.StatusBadRequest, errInvalidSignature},
+	} {
+		w := sendTestBalanceQuery(v.params)
+		expectError(t, v.name, w, v.status, v.err)
+	}
+}
+
+func newTestCloseRequest(t *testing.T, amount data.Amount,
+	channel *data.Channel, offering *data.Offering,
+	clientAcc *data.Account, nonce int64) *closeRequest {
+	req := &closeRequest{
+		AgentAddress:    channel.Agent,
+		OpenBlockNumber: channel.Block,
+		OfferingHash:    offering.Hash,
+		Balance:         amount,
+		Nonce:           nonce,
+	}
+
+	hash := closeRequestHash(testPSCAddr,
+		data.TestToAddress(t, channel.Agent), channel.Block,
+		data.TestToHash(t, offering.Hash), amount.Big(), nonce)
+
+	key, err := data.TestToPrivateKey(*clientAcc.PrivateKey, data.TestPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Signature = data.FromBytes(sig)
+	return req
+}
+
+func sendTestCloseRequest(v interface{}) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	json.NewEncoder(body).Encode(v)
+	r := httptest.NewRequest(http.MethodPost, closePath, body)
+	w := httptest.NewRecorder()
+	util.ValidateMethod(testServer.handleClose, http.MethodPost)(w, r)
+	return w
+}
+
+func TestCloseRequest(t *testing.T) {
+	defer data.CleanTestDB(t, testDB)
+	fixture := newFixture(t)
+
+	term := &testTerminator{}
+	testServer.pr = term
+
+	fixture.channel.ReceiptBalance = data.NewAmount(40)
+	data.SaveToTestDB(t, testDB, fixture.channel)
+
+	now := time.Now().Unix()
+	closeReq := func(amount uint64, acc *data.Account,
+		nonce int64) *closeRequest {
+		return newTestCloseRequest(t, data.NewAmount(amount),
+			fixture.channel, fixture.offering, acc, nonce)
+	}
+
+	// Signature is made for another nonce.
+	wrongNonce := closeReq(40, fixture.clientAcc, now)
+	wrongNonce.Nonce++
+
+	otherUser := data.NewTestAccount(data.TestPassword)
+	for _, v := range []struct {
+		name   string
+		req    interface{}
+		status int
+		err    *serverError
+	}{
+		{"balance is less then receipt",
+			closeReq(30, fixture.clientAcc, now),
+			http.StatusConflict, errBalanceMismatch},
+		{"balance is greater then receipt",
+			closeReq(50, fixture.clientAcc, now),
+			http.StatusConflict, errBalanceMismatch},
+		{"signature doesn't correspond to channels user",
+			closeReq(40, otherUser, now),
+			http.StatusBadRequest, errInvalidSignature},
+		{"expired nonce", closeReq(40, fixture.clientAcc,
+			now-int64(2*maxNonceSkew/time.Second)),
+			http.StatusBadRequest, errInvalidNonce},
+		{"wrong nonce", wrongNonce,
+			http.StatusBadRequest, errInvalidSignature},
+		// Payments can be observed, they don't prove the ownership.
+		{"replayed payment", newTestPayload(t, data.NewAmount(40),
+			fixture.channel, fixture.offering, fixture.clientAcc),
+			http.StatusBadRequest, errInvalidNonce},
+	} {
+		w := sendTestCloseRequest(v.req)
+		expectError(t, v.name, w, v.status, v.err)
+	}
+
+	if len(term.terminated) != 0 {
+		t.Fatal("service is terminated on invalid request")
+	}
+
+	req := closeReq(40, fixture.clientAcc, now)
+	w := sendTestCloseRequest(req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect response ok, got: %d, %s", w.Code, w.Body)
+	}
+
+	var reply closeReply
+	if err := json.NewDecoder(w.Body).Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+
+	hash := eth.BalanceClosingHash(
+		data.TestToAddress(t, fixture.channel.Client), testPSCAddr,
+		fixture.channel.Block, data.TestToHash(t, fixture.offering.Hash),
+		big.NewInt(40))
+	pub, err := crypto.SigToPub(hash, data.TestToBytes(t, reply.ClosingSig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crypto.PubkeyToAddress(*pub) !=
+		data.TestToAddress(t, fixture.agent.EthAddr) {
+		t.Fatal("closing signature is not made by the agent")
+	}
+
+	if len(term.terminated) != 1 ||
+		term.terminated[0] != fixture.channel.ID {
+		t.Fatalf("service is not terminated: %v", term.terminated)
+	}
+
+	data.ReloadFromTestDB(t, testDB, fixture.channel)
+	if fixture.channel.ClosingSignature == nil ||
+		*fixture.channel.ClosingSignature != reply.ClosingSig {
+		t.Fatal("closing signature is not recorded")
+	}
+
+	// Repeated request gets the recorded signature.
+	w = sendTestCloseRequest(req)
+	var reply2 closeReply
+	if err := json.NewDecoder(w.Body).Decode(&reply2); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || reply2 != reply {
+		t.Fatalf("unexpected repeated reply: %d, %+v", w.Code, reply2)
+	}
+
+	if len(term.terminated) != 1 {
+		t.Fatal("service is terminated twice")
+	}
+
+	payment := newTestPayload(t, data.NewAmount(50), fixture.channel,
+		fixture.offering, fixture.clientAcc)
+	expectError(t, "payment after close request",
+		sendTestRequest(payment), http.StatusConflict, errChannelClosing)
+}
+
+func TestCloseQueuedTermination(t *testing.T) {
+	defer data.CleanTestDB(t, testDB)
+	fixture := newFixture(t)
+
+	errQueued := errors.New("termination is queued")
+	term := &testTerminator{err: errQueued}
+
+	testServer.pr = term
+	req := newTestCloseRequest(t, data.NewAmount(0), fixture.channel,
+		fixture.offering, fixture.clientAcc, time.Now().Unix())
+	expectError(t, "termination failure", sendTestCloseRequest(req),
+		http.StatusInternalServerError, errUnexpected)
+
+	testServer.pr = NewPendingTerminator(term, errQueued)
+	w := sendTestCloseRequest(req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect response ok, got: %d, %s", w.Code, w.Body)
+	}
+
+	var reply closeReply
+	if err := json.NewDecoder(w.Body).Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+
+	data.ReloadFromTestDB(t, testDB, fixture.channel)
+	if reply.ClosingSig == "" || fixture.channel.ClosingSignature == nil ||
+		*fixture.channel.ClosingSignature != reply.ClosingSig {
+		t.Fatal("closing signature is not recorded")
+	}
+}
+
+func TestRequestCloseSignatures(t *testing.T) {
+	defer data.CleanTestDB(t, testDB)
+	fixture := newFixture(t)
+
+	testServer.pr = &testTerminator{}
+
+	srv := httptest.NewServer(http.HandlerFunc(testServer.handleClose))
+	defer srv.Close()
+
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	endp := data.NewTestEndpoint(fixture.channel.ID, fixture.template.ID)
+	endp.PaymentReceiverAddress = &addr
+
+	fixture.channel.ReceiptBalance = data.NewAmount(40)
+	data.SaveToTestDB(t, testDB, fixture.channel)
+	data.InsertToTestDB(t, testDB, fixture.clientAcc, endp)
+
+	sigs, err := RequestCloseSignatures(testDB, fixture.channel.ID,
+		testPSCAddr.Hex(), testServer.signer, false, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sigs.Balance.Cmp(data.NewAmount(40)) != 0 ||
+		len(sigs.BalanceMsgSig) == 0 || len(sigs.ClosingSig) == 0 {
+		t.Fatalf("wrong close signatures: %+v", sigs)
+	}
+
+	// Balance proof for another contract is rejected.
+	if _, err := RequestCloseSignatures(testDB, fixture.channel.ID,
+		common.HexToAddress("0x2").Hex(), testServer.signer,
+		false, 1000); err == nil {
+		t.Fatal("closing signature for another contract is accepted")
+	}
+}
+
+func sendTestBatch(srv *Server, plds []payload) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	json.NewEncoder(body).Encode(&batchPayload{Payments: plds})
+	r := httptest.NewRequest(http.MethodPost, batchPath, body)
+	w := httptest.NewRecorder()
+	util.ValidateMethod(srv.handlePayBatch, http.MethodPost)(w, r)
+	return w
+}
+
+func TestPayBatch(t *testing.T) {
+	defer data.CleanTestDB(t, testDB)
+	fixture := newFixture(t)
+
+	ch2 := data.NewTestChannel(fixture.agent.EthAddr,
+		fixture.client.EthAddr, fixture.offering.ID, 10, 100,
+		data.ChannelActive)
+	data.InsertToTestDB(t, testDB, ch2)
+
+	otherUser := data.NewTestAccount(data.TestPassword)
+	pld := func(amount uint64, ch *data.Channel,
+		acc *data.Account) payload {
+		return *newTestPayload(t, data.NewAmount(amount), ch,
+			fixture.offering, acc)
+	}
+
+	w := sendTestBatch(testServer, []payload{
+		pld(10, fixture.channel, fixture.clientAcc),
+		pld(5, ch2, fixture.clientAcc),
+		pld(20, fixture.channel, fixture.clientAcc),
+		pld(50, ch2, otherUser),
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect response ok, got: %d, %s", w.Code, w.Body)
+	}
+
+	var reply batchReply
+	if err := json.NewDecoder(w.Body).Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []batchResult{
+		{http.StatusOK, nil},
+		{http.StatusConflict, ErrStaleBalance},
+		{http.StatusOK, nil},
+		{http.StatusBadRequest, errInvalidSignature},
+	}
+	if len(reply.Results) != len(expected) {
+		t.Fatalf("wrong number of results: %d", len(reply.Results))
+	}
+	for i, v := range expected {
+		res := reply.Results[i]
+		if res.Status != v.Status || (res.Error == nil) != (v.Error == nil) ||
+			(res.Error != nil && *res.Error != *v.Error) {
+			t.Errorf("%d: expected result %+v, got: %+v", i, v, res)
+		}
+	}
+
+	data.ReloadFromTestDB(t, testDB, fixture.channel, ch2)
+	if fixture.channel.ReceiptBalance.Cmp(data.NewAmount(20)) != 0 ||
+		ch2.ReceiptBalance.Cmp(data.NewAmount(10)) != 0 {
+		t.Fatalf("wrong receipt balances: %s, %s",
+			fixture.channel.ReceiptBalance, ch2.ReceiptBalance)
+	}
+
+	conf := NewConfig()
+	conf.MaxBatchSize = 1
+	srv := NewServer(conf, testServer.logger, testDB, testServer.pr,
+		testPSCAddr, testServer.signer)
+	expectError(t, "too large batch", sendTestBatch(srv, []payload{
+		pld(30, fixture.channel, fixture.clientAcc),
+		pld(40, fixture.channel, fixture.clientAcc),
+	}), http.StatusRequestEntityTooLarge, errPayloadTooLarge)
+
+	// Batches of unlimited size are still limited by a body size.
+	conf = NewConfig()
+	conf.MaxBatchSize = 0
+	conf.MaxBodySize = 10
+	srv = NewServer(conf, testServer.logger, testDB, testServer.pr,
+		testPSCAddr, testServer.signer)
+	expectError(t, "too large body", sendTestBatch(srv, []payload{
+		pld(30, fixture.channel, fixture.clientAcc),
+	}), http.StatusRequestEntityTooLarge, errPayloadTooLarge)
 }
 
 func TestMain(m *testing.M) {
 	var conf struct {
-		DB  *data.DBConfig
-		Log *util.LogConfig
+		DB        *data.DBConfig
+		Log       *util.LogConfig
+		PayServer *Config
 	}
 	conf.DB = data.NewDBConfig()
 	conf.Log = util.NewLogConfig()
+	conf.PayServer = NewConfig()
 	util.ReadTestConfig(&conf)
 	logger := util.NewTestLogger(conf.Log)
 	testDB = data.NewTestDB(conf.DB, logger)
 	defer data.CloseDB(testDB)
-	testServer = NewServer(nil, logger, testDB)
+	pwd := data.StaticPWDStorage(data.TestPassword)
+	testServer = NewServer(conf.PayServer, logger, testDB,
+		&testTerminator{}, testPSCAddr,
+		signer.NewDBSigner(testDB, &pwd, data.TestToPrivateKey))
 
 	os.Exit(m.Run())
 }
@@ -3,8 +3,10 @@ package pay
 import (
 	"net/http"
 
+	"github.com/ethereum/go-ethereum/common"
 	reform "gopkg.in/reform.v1"
 
+	"github.com/privatix/dappctrl/signer"
 	"github.com/privatix/dappctrl/util"
 )
 
@@ -14,30 +16,108 @@ type TLSConfig struct {
 	KeyFile  string
 }
 
-// Config is a configuration for a payment server.
+// Config is a configuration for a payment server. Zero limits disable
+// corresponding checks.
 type Config struct {
-	Addr string
-	TLS  *TLSConfig
+	Addr         string
+	TLS          *TLSConfig
+	MaxBodySize  int64   // In bytes, per balance proof in batches.
+	MaxBatchSize uint    // Balance proofs in a batch.
+	IPRate       float64 // Requests per second from an IP address.
+	IPBurst      uint
+	ChannelRate  float64 // Requests per second for a channel.
+	ChannelBurst uint
+}
+
+// NewConfig creates a default payment server configuration.
+func NewConfig() *Config {
+	return &Config{
+		Addr:         "localhost:9000",
+		MaxBodySize:  4096,
+		MaxBatchSize: 50,
+		IPRate:       10,
+		IPBurst:      50,
+		ChannelRate:  2,
+		ChannelBurst: 10,
+	}
+}
+
+// Terminator terminates channel services.
+type Terminator interface {
+	TerminateChannel(id, jobCreator string) (string, error)
+}
+
+// pendingTerminator is a terminator, which doesn't fail on terminations
+// already queued or blocked by other channel jobs, as services are to be
+// terminated anyway.
+type pendingTerminator struct {
+	Terminator
+	pending []error
+}
+
+// NewPendingTerminator returns a terminator, for which given errors mean
+// a termination in progress rather than a failure.
+func NewPendingTerminator(t Terminator, pending ...error) Terminator {
+	return &pendingTerminator{t, pending}
+}
+
+func (t *pendingTerminator) TerminateChannel(id,
+	jobCreator string) (string, error) {
+	jobID, err := t.Terminator.TerminateChannel(id, jobCreator)
+	for _, v := range t.pending {
+		if err == v {
+			return "", nil
+		}
+	}
+	return jobID, err
 }
 
 // Server is a payment server.
 type Server struct {
-	conf   *Config
-	logger *util.Logger
-	db     *reform.DB
+	conf      *Config
+	logger    *util.Logger
+	db        *reform.DB
+	pr        Terminator
+	pscAddr   common.Address
+	signer    signer.Signer
+	ipLimit   *limiter
+	chanLimit *limiter
 }
 
 // NewServer creates a new payment server.
-func NewServer(conf *Config, logger *util.Logger, db *reform.DB) *Server {
-	return &Server{conf, logger, db}
+func NewServer(conf *Config, logger *util.Logger, db *reform.DB,
+	pr Terminator, pscAddr common.Address, signer signer.Signer) *Server {
+	return &Server{
+		conf:      conf,
+		logger:    logger,
+		db:        db,
+		pr:        pr,
+		pscAddr:   pscAddr,
+		signer:    signer,
+		ipLimit:   newLimiter(conf.IPRate, conf.IPBurst),
+		chanLimit: newLimiter(conf.ChannelRate, conf.ChannelBurst),
+	}
 }
 
-const payPath = "/v1/pmtChannel/pay"
+// Payment server paths.
+const (
+	payPath     = "/v1/pmtChannel/pay"
+	balancePath = "/v1/pmtChannel/balance"
+	closePath   = "/v1/pmtChannel/close"
+	batchPath   = "/v1/pmtChannel/payBatch"
+)
 
 // ListenAndServe starts to listen and serve to requests.
 func (s *Server) ListenAndServe() error {
 	mux := http.NewServeMux()
-	mux.HandleFunc(payPath, util.ValidateMethod(s.handlePay, http.MethodPost))
+	mux.HandleFunc(payPath, s.limitIP(
+		util.ValidateMethod(s.handlePay, http.MethodPost)))
+	mux.HandleFunc(balancePath, s.limitIP(
+		util.ValidateMethod(s.handleBalance, http.MethodGet)))
+	mux.HandleFunc(batchPath, s.limitIP(
+		util.ValidateMethod(s.handlePayBatch, http.MethodPost)))
+	mux.HandleFunc(closePath, s.limitIP(
+		util.ValidateMethod(s.handleClose, http.MethodPost)))
 
 	if s.conf.TLS != nil {
 		return http.ListenAndServeTLS(
@@ -46,3 +126,14 @@ func (s *Server) ListenAndServe() error {
 
 	return http.ListenAndServe(s.conf.Addr, mux)
 }
+
+// limitIP rejects requests from IP addresses exceeding the request rate.
+func (s *Server) limitIP(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.ipLimit.allow(clientIP(r)) {
+			s.replyErr(w, http.StatusTooManyRequests, errTooManyRequests)
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,159 @@
+// Package bill calculates amounts due, payment lags and remaining quotas of
+// state channels. It is shared by agent and client billing.
+package bill
+
+import (
+	"math"
+
+	"github.com/privatix/dappctrl/data"
+)
+
+// Usage is a consumption of a channel and payments for it.
+type Usage struct {
+	Offering *data.Offering
+	Consumed uint64      // In units of the offering unit type.
+	Deposit  data.Amount // Total deposit of the channel.
+	Paid     data.Amount // Receipt balance of the channel.
+}
+
+func (u *Usage) interval() uint64 {
+	if u.Offering.BillingInterval == 0 {
+		return 1
+	}
+	return uint64(u.Offering.BillingInterval)
+}
+
+func (u *Usage) maxUnit() uint64 {
+	if u.Offering.MaxUnit == nil || *u.Offering.MaxUnit == 0 {
+		return math.MaxUint64
+	}
+	return *u.Offering.MaxUnit
+}
+
+// affordableUnits returns a number of units the deposit can pay for after
+// the setup price.
+func (u *Usage) affordableUnits() uint64 {
+	if u.Deposit.Cmp(u.Offering.SetupPrice) < 0 {
+		return 0
+	}
+
+	if u.Offering.UnitPrice.IsZero() {
+		return math.MaxUint64
+	}
+
+	return saturate(u.Deposit.Sub(u.Offering.SetupPrice).Div(
+		u.Offering.UnitPrice))
+}
+
+// inTrial tells whether free units of the offering are not used up yet.
+// Nothing is due during the trial, including the setup price.
+func (u *Usage) inTrial() bool {
+	return u.Consumed < uint64(u.Offering.FreeUnits)
+}
+
+// DueUnits returns a number of units to be paid by now, free units excluded.
+// Postpaid offerings are paid for completed billing intervals, prepaid ones
+// are paid for a current interval in advance. Due units never exceed the
+// units the deposit can pay for.
+func (u *Usage) DueUnits() uint64 {
+	if u.inTrial() {
+		return 0
+	}
+
+	free := uint64(u.Offering.FreeUnits)
+	intervals := (u.Consumed - free) / u.interval()
+	if u.Offering.BillingType == data.BillingPrepaid {
+		intervals++
+	}
+
+	// Units beyond the max units of the offering are never due.
+	limit := u.maxUnit() - min(free, u.maxUnit())
+	limit = min(limit, u.affordableUnits())
+	if intervals > limit/u.interval() {
+		return limit
+	}
+
+	return intervals * u.interval()
+}
+
+// DueAmount returns an amount to be paid by now. The setup price is due
+// before any units, the amount never exceeds the deposit.
+func (u *Usage) DueAmount() data.Amount {
+	if u.inTrial() {
+		return data.Amount{}
+	}
+
+	amount := u.Offering.UnitPrice.Mul(data.NewAmount(u.DueUnits())).Add(
+		u.Offering.SetupPrice)
+	if amount.Cmp(u.Deposit) > 0 {
+		return u.Deposit
+	}
+
+	return amount
+}
+
+// PaidUnits returns a number of units covered by the paid amount after
+// the setup price.
+func (u *Usage) PaidUnits() uint64 {
+	if u.Paid.Cmp(u.Offering.SetupPrice) < 0 {
+		return 0
+	}
+
+	if u.Offering.UnitPrice.IsZero() {
+		return math.MaxUint64
+	}
+
+	return saturate(u.Paid.Sub(u.Offering.SetupPrice).Div(
+		u.Offering.UnitPrice))
+}
+
+// Lag returns a number of due units which are not paid.
+func (u *Usage) Lag() uint64 {
+	due, paid := u.DueUnits(), u.PaidUnits()
+	if due <= paid {
+		return 0
+	}
+	return due - paid
+}
+
+// Lagging tells whether the lag exceeds the max billing lag of the offering.
+func (u *Usage) Lagging() bool {
+	return u.Lag() > uint64(u.Offering.MaxBillingUnitLag)
+}
+
+// Remaining returns a number of units which still can be consumed within
+// the deposit and the max units of the offering. Free units are consumed
+// first.
+func (u *Usage) Remaining() uint64 {
+	limit := add(uint64(u.Offering.FreeUnits), u.affordableUnits())
+	limit = min(limit, u.maxUnit())
+	if u.Consumed >= limit {
+		return 0
+	}
+
+	return limit - u.Consumed
+}
+
+func min(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// add returns a sum of numbers, which is capped by the max uint64.
+func add(a, b uint64) uint64 {
+	if a > math.MaxUint64-b {
+		return math.MaxUint64
+	}
+	return a + b
+}
+
+// saturate converts an amount to a number, which is capped by the max uint64.
+func saturate(a data.Amount) uint64 {
+	v, ok := a.Uint64()
+	if !ok {
+		return math.MaxUint64
+	}
+	return v
+}
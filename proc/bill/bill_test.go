@@ -0,0 +1,174 @@
+package bill
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/util"
+)
+
+const (
+	testSetupPrice = 10
+	testUnitPrice  = 2
+	testInterval   = 10
+)
+
+func newTestUsage(billing string, free uint8, maxUnit, consumed,
+	deposit, paid uint64) *Usage {
+	offer := &data.Offering{
+		BillingType:     billing,
+		BillingInterval: testInterval,
+		SetupPrice:      data.NewAmount(testSetupPrice),
+		UnitPrice:       data.NewAmount(testUnitPrice),
+		FreeUnits:       free,
+	}
+	if maxUnit != 0 {
+		offer.MaxUnit = &maxUnit
+	}
+
+	return &Usage{
+		Offering: offer,
+		Consumed: consumed,
+		Deposit:  data.NewAmount(deposit),
+		Paid:     data.NewAmount(paid),
+	}
+}
+
+func TestDue(t *testing.T) {
+	for _, v := range []struct {
+		name     string
+		billing  string
+		free     uint8
+		maxUnit  uint64
+		consumed uint64
+		deposit  uint64
+		paid     uint64
+		units    uint64
+		amount   uint64
+		lag      uint64
+	}{
+		{"postpaid start", data.BillingPostpaid,
+			0, 0, 0, 1000, 0, 0, 10, 0},
+		{"postpaid partial interval", data.BillingPostpaid,
+			0, 0, 25, 1000, 0, 20, 50, 20},
+		{"postpaid paid", data.BillingPostpaid,
+			0, 0, 25, 1000, 50, 20, 50, 0},
+		{"postpaid partially paid", data.BillingPostpaid,
+			0, 0, 25, 1000, 30, 20, 50, 10},
+		{"postpaid setup not paid", data.BillingPostpaid,
+			0, 0, 25, 1000, 5, 20, 50, 20},
+		{"prepaid start", data.BillingPrepaid,
+			0, 0, 0, 1000, 0, 10, 30, 10},
+		{"prepaid partial interval", data.BillingPrepaid,
+			0, 0, 25, 1000, 0, 30, 70, 30},
+		{"prepaid interval boundary", data.BillingPrepaid,
+			0, 0, 30, 1000, 90, 40, 90, 0},
+		{"postpaid free units", data.BillingPostpaid,
+			5, 0, 4, 1000, 0, 0, 0, 0},
+		{"postpaid free units used up", data.BillingPostpaid,
+			5, 0, 25, 1000, 0, 20, 50, 20},
+		{"prepaid free units", data.BillingPrepaid,
+			5, 0, 4, 1000, 0, 0, 0, 0},
+		{"prepaid free units used up", data.BillingPrepaid,
+			5, 0, 5, 1000, 0, 10, 30, 10},
+		{"postpaid max units", data.BillingPostpaid,
+			0, 15, 25, 1000, 0, 15, 40, 15},
+		{"prepaid max units", data.BillingPrepaid,
+			5, 15, 12, 1000, 0, 10, 30, 10},
+		{"deposit limit", data.BillingPostpaid,
+			0, 0, 25, 40, 0, 15, 40, 15},
+		{"prepaid near deposit end, fully paid", data.BillingPrepaid,
+			0, 0, 10, 40, 40, 15, 40, 0},
+	} {
+		u := newTestUsage(v.billing, v.free, v.maxUnit, v.consumed,
+			v.deposit, v.paid)
+		if units := u.DueUnits(); units != v.units {
+			t.Errorf("%s: due units: %d, wanted: %d",
+				v.name, units, v.units)
+		}
+		if amount := u.DueAmount(); amount.Cmp(
+			data.NewAmount(v.amount)) != 0 {
+			t.Errorf("%s: due amount: %s, wanted: %d",
+				v.name, amount, v.amount)
+		}
+		if lag := u.Lag(); lag != v.lag {
+			t.Errorf("%s: lag: %d, wanted: %d", v.name, lag, v.lag)
+		}
+	}
+}
+
+func TestLagging(t *testing.T) {
+	for _, v := range []struct {
+		maxLag  uint
+		lagging bool
+	}{
+		{0, true},
+		{19, true},
+		{20, false},
+		{100, false},
+	} {
+		u := newTestUsage(data.BillingPostpaid, 0, 0, 25, 1000, 0)
+		u.Offering.MaxBillingUnitLag = v.maxLag
+		if u.Lagging() != v.lagging {
+			t.Errorf("max lag %d: lagging: %v, wanted: %v",
+				v.maxLag, !v.lagging, v.lagging)
+		}
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	for _, v := range []struct {
+		name      string
+		free      uint8
+		maxUnit   uint64
+		consumed  uint64
+		deposit   uint64
+		remaining uint64
+	}{
+		{"unused deposit", 0, 0, 0, 1000, 495},
+		{"used deposit", 0, 0, 200, 1000, 295},
+		{"deposit used up", 0, 0, 495, 1000, 0},
+		{"deposit exceeded", 0, 0, 500, 1000, 0},
+		{"deposit below setup price", 0, 0, 0, 5, 0},
+		{"free units only", 5, 0, 3, 5, 2},
+		{"free units and deposit", 5, 0, 10, 30, 5},
+		{"max units", 0, 100, 40, 1000, 60},
+		{"max units used up", 5, 100, 100, 1000, 0},
+	} {
+		u := newTestUsage(data.BillingPostpaid, v.free, v.maxUnit,
+			v.consumed, v.deposit, 0)
+		if remaining := u.Remaining(); remaining != v.remaining {
+			t.Errorf("%s: remaining: %d, wanted: %d",
+				v.name, remaining, v.remaining)
+		}
+	}
+}
+
+func TestFreeOffering(t *testing.T) {
+	for _, billing := range []string{
+		data.BillingPostpaid, data.BillingPrepaid} {
+		u := newTestUsage(billing, 0, 0, 25, 0, 0)
+		u.Offering.SetupPrice = data.NewAmount(0)
+		u.Offering.UnitPrice = data.NewAmount(0)
+
+		if amount := u.DueAmount(); !amount.IsZero() {
+			t.Errorf("%s: due amount: %s, wanted: 0", billing, amount)
+		}
+		if lag := u.Lag(); lag != 0 {
+			t.Errorf("%s: lag: %d, wanted: 0", billing, lag)
+		}
+		if remaining := u.Remaining(); remaining != math.MaxUint64-25 {
+			t.Errorf("%s: remaining: %d, wanted: %d",
+				billing, remaining, uint64(math.MaxUint64-25))
+		}
+	}
+}
+
+func TestMain(m *testing.M) {
+	// Ignore config flags when run all packages tests.
+	util.ReadTestConfig(&struct{}{})
+
+	os.Exit(m.Run())
+}
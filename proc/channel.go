@@ -6,23 +6,7 @@ import (
 	reform "gopkg.in/reform.v1"
 
 	"github.com/privatix/dappctrl/data"
-)
-
-type transition = map[string]struct{}
-
-var (
-	activateTransitions = transition{
-		data.ServicePending:   struct{}{},
-		data.ServiceSuspended: struct{}{},
-	}
-	suspendTransitions = transition{
-		data.ServiceActive: struct{}{},
-	}
-	terminateTransitions = transition{
-		data.ServicePending:   struct{}{},
-		data.ServiceActive:    struct{}{},
-		data.ServiceSuspended: struct{}{},
-	}
+	"github.com/privatix/dappctrl/proc/state"
 )
 
 func checkJobExists(tx *reform.TX, rel, ty string) error {
@@ -60,7 +44,7 @@ func cancelJobs(tx *reform.TX, rel string) error {
 }
 
 func (p *Processor) alterServiceStatus(id, jobCreator, jobType,
-	jobTypeToCheck string, trans transition, cancel bool) (string, error) {
+	jobTypeToCheck, status string, cancel bool) (string, error) {
 	tx, err := p.queue.DB().Begin()
 	if err != nil {
 		return "", err
@@ -73,8 +57,8 @@ func (p *Processor) alterServiceStatus(id, jobCreator, jobType,
 		return "", err
 	}
 
-	if _, ok := trans[ch.ServiceStatus]; !ok {
-		return "", ErrBadServiceStatus
+	if err := state.CheckService(ch.ServiceStatus, status); err != nil {
+		return "", err
 	}
 
 	if err := checkJobExists(tx, ch.ID, jobTypeToCheck); err != nil {
@@ -110,19 +94,18 @@ func (p *Processor) alterServiceStatus(id, jobCreator, jobType,
 // SuspendChannel tries to suspend a given channel.
 func (p *Processor) SuspendChannel(id, jobCreator string) (string, error) {
 	return p.alterServiceStatus(id, jobCreator,
-		data.JobAgentPreServiceSuspend, "", suspendTransitions, false)
+		data.JobAgentPreServiceSuspend, "", data.ServiceSuspended, false)
 }
 
 // ActivateChannel tries to activate a given channel.
 func (p *Processor) ActivateChannel(id, jobCreator string) (string, error) {
 	return p.alterServiceStatus(id, jobCreator,
-		data.JobAgentPreServiceUnsuspend, "", activateTransitions,
-		false)
+		data.JobAgentPreServiceUnsuspend, "", data.ServiceActive, false)
 }
 
 // TerminateChannel tries to terminate a given channel.
 func (p *Processor) TerminateChannel(id, jobCreator string) (string, error) {
 	return p.alterServiceStatus(id, jobCreator,
 		data.JobAgentPreServiceTerminate,
-		data.JobAgentPreServiceTerminate, terminateTransitions, true)
+		data.JobAgentPreServiceTerminate, data.ServiceTerminated, true)
 }
@@ -11,6 +11,7 @@ import (
 
 	"github.com/privatix/dappctrl/data"
 	"github.com/privatix/dappctrl/job"
+	"github.com/privatix/dappctrl/proc/state"
 	"github.com/privatix/dappctrl/util"
 )
 
@@ -51,7 +52,10 @@ func testChannelAction(t *testing.T, channelAction channelActionFunc,
 	fxt.Channel.ServiceStatus = badServiceStatus
 	data.SaveToTestDB(t, db, fxt.Channel)
 	_, err = channelAction(fxt.Channel.ID, data.JobUser)
-	util.TestExpectResult(t, funcName, ErrBadServiceStatus, err)
+	if _, ok := err.(*state.TransitionError); !ok {
+		t.Fatalf("unexpected '%s' result for bad service status: %v",
+			funcName, err)
+	}
 
 	job := newTestJob(fxt.Channel.ID)
 
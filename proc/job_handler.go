@@ -10,6 +10,8 @@ import (
 func HandlersMap(worker *worker.Worker) job.HandlerMap {
 	// TODO: add clients
 	return job.HandlerMap{
+		// Client jobs.
+		data.JobClientPreCooperativeClose: worker.ClientPreCooperativeClose,
 		// Agent jobs.
 		data.JobAgentAfterChannelCreate:             worker.AgentAfterChannelCreate,
 		data.JobAgentAfterChannelTopUp:              worker.AgentAfterChannelTopUp,
@@ -33,5 +35,11 @@ func HandlersMap(worker *worker.Worker) job.HandlerMap {
 		data.JobPreAccountReturnBalance:     worker.PreAccountReturnBalance,
 		data.JobAfterAccountReturnBalance:   worker.AfterAccountReturnBalance,
 		data.JobAccountAddCheckBalance:      worker.AccountAddCheckBalance,
+		data.JobPreAccountWithdrawETH:       worker.PreAccountWithdrawETH,
+		data.JobPreAccountWithdrawPTC:       worker.PreAccountWithdrawPTC,
+		data.JobPreAccountSetNetworkFee:     worker.PreAccountSetNetworkFee,
+		data.JobAccountUpdateNetworkFee:     worker.AccountUpdateNetworkFee,
+		data.JobSpeedUpTransaction:          worker.SpeedUpTransaction,
+		data.JobCancelTransaction:           worker.CancelTransaction,
 	}
 }
@@ -32,7 +32,6 @@ func NewProcessor(
 
 // Processor-specific errors.
 var (
-	ErrBadServiceStatus = errors.New("bad service status")
-	ErrActiveJobsExist  = errors.New("active jobs exist")
-	ErrSameJobExists    = errors.New("same job exists")
+	ErrActiveJobsExist = errors.New("active jobs exist")
+	ErrSameJobExists   = errors.New("same job exists")
 )
@@ -0,0 +1,123 @@
+// Package state defines legal transitions of channel and service statuses.
+// All channel status changes must be made through this package.
+package state
+
+import (
+	"fmt"
+
+	reform "gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/data"
+)
+
+// Status dimensions.
+const (
+	DimChannel = "channel"
+	DimService = "service"
+)
+
+// TransitionError is an error about an illegal status transition.
+type TransitionError struct {
+	Dimension string
+	From      string
+	To        string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("illegal %s status transition from %q to %q",
+		e.Dimension, e.From, e.To)
+}
+
+type transitions map[string][]string
+
+// channelTransitions follow the state channel life cycle in the contract.
+// Closing statuses can be skipped, since only events observed in blockchain
+// may be known.
+var channelTransitions = transitions{
+	data.ChannelPending: {data.ChannelActive},
+	data.ChannelActive: {data.ChannelWaitCoop, data.ChannelClosedCoop,
+		data.ChannelWaitChallenge, data.ChannelInChallenge,
+		data.ChannelClosedUncoop},
+	data.ChannelWaitCoop: {data.ChannelActive, data.ChannelClosedCoop},
+	data.ChannelWaitChallenge: {data.ChannelActive,
+		data.ChannelInChallenge},
+	data.ChannelInChallenge: {data.ChannelWaitUncoop,
+		data.ChannelClosedCoop, data.ChannelClosedUncoop},
+	data.ChannelWaitUncoop: {data.ChannelInChallenge,
+		data.ChannelClosedUncoop},
+	data.ChannelClosedCoop:   nil,
+	data.ChannelClosedUncoop: nil,
+}
+
+var serviceTransitions = transitions{
+	data.ServicePending: {data.ServiceActive, data.ServiceSuspended,
+		data.ServiceTerminated},
+	data.ServiceActive:     {data.ServiceSuspended, data.ServiceTerminated},
+	data.ServiceSuspended:  {data.ServiceActive, data.ServiceTerminated},
+	data.ServiceTerminated: nil,
+}
+
+func (t transitions) check(dim, from, to string) error {
+	for _, v := range t[from] {
+		if v == to {
+			return nil
+		}
+	}
+	return &TransitionError{Dimension: dim, From: from, To: to}
+}
+
+// CheckChannel checks that a channel status can be changed. Keeping the same
+// status is not a transition.
+func CheckChannel(from, to string) error {
+	return channelTransitions.check(DimChannel, from, to)
+}
+
+// CheckService checks that a service status can be changed. Keeping the same
+// status is not a transition.
+func CheckService(from, to string) error {
+	return serviceTransitions.check(DimService, from, to)
+}
+
+// Check checks that statuses of a channel can be changed to given ones.
+// Statuses which are not changed are not checked.
+func Check(ch *data.Channel, channelStatus, serviceStatus string) error {
+	if ch.ChannelStatus != channelStatus {
+		if err := CheckChannel(ch.ChannelStatus, channelStatus); err != nil {
+			return err
+		}
+	}
+
+	if ch.ServiceStatus != serviceStatus {
+		return CheckService(ch.ServiceStatus, serviceStatus)
+	}
+
+	return nil
+}
+
+// Insert inserts a new channel with known statuses and records them.
+func Insert(tx *reform.TX, ch *data.Channel, cause string,
+	job *string) error {
+	if _, ok := channelTransitions[ch.ChannelStatus]; !ok {
+		return &TransitionError{Dimension: DimChannel,
+			To: ch.ChannelStatus}
+	}
+
+	if _, ok := serviceTransitions[ch.ServiceStatus]; !ok {
+		return &TransitionError{Dimension: DimService,
+			To: ch.ServiceStatus}
+	}
+
+	return data.InsertChannel(tx, ch, cause, job)
+}
+
+// Update changes statuses of a channel if the transition is legal and records
+// it.
+func Update(tx *reform.TX, ch *data.Channel, channelStatus,
+	serviceStatus, cause string, job *string) error {
+	if err := Check(ch, channelStatus, serviceStatus); err != nil {
+		return err
+	}
+
+	return data.UpdateChannelStatus(tx, ch, channelStatus, serviceStatus,
+		cause, job)
+}
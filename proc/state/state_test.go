@@ -0,0 +1,126 @@
+package state
+
+import (
+	"os"
+	"testing"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/util"
+)
+
+var (
+	channelStatuses = []string{data.ChannelPending, data.ChannelActive,
+		data.ChannelWaitCoop, data.ChannelClosedCoop,
+		data.ChannelWaitChallenge, data.ChannelInChallenge,
+		data.ChannelWaitUncoop, data.ChannelClosedUncoop}
+
+	serviceStatuses = []string{data.ServicePending, data.ServiceActive,
+		data.ServiceSuspended, data.ServiceTerminated}
+)
+
+type transition struct {
+	from, to string
+}
+
+var legalChannel = map[transition]bool{
+	{data.ChannelPending, data.ChannelActive}:            true,
+	{data.ChannelActive, data.ChannelWaitCoop}:           true,
+	{data.ChannelActive, data.ChannelClosedCoop}:         true,
+	{data.ChannelActive, data.ChannelWaitChallenge}:      true,
+	{data.ChannelActive, data.ChannelInChallenge}:        true,
+	{data.ChannelActive, data.ChannelClosedUncoop}:       true,
+	{data.ChannelWaitCoop, data.ChannelActive}:           true,
+	{data.ChannelWaitCoop, data.ChannelClosedCoop}:       true,
+	{data.ChannelWaitChallenge, data.ChannelActive}:      true,
+	{data.ChannelWaitChallenge, data.ChannelInChallenge}: true,
+	{data.ChannelInChallenge, data.ChannelWaitUncoop}:    true,
+	{data.ChannelInChallenge, data.ChannelClosedCoop}:    true,
+	{data.ChannelInChallenge, data.ChannelClosedUncoop}:  true,
+	{data.ChannelWaitUncoop, data.ChannelInChallenge}:    true,
+	{data.ChannelWaitUncoop, data.ChannelClosedUncoop}:   true,
+}
+
+var legalService = map[transition]bool{
+	{data.ServicePending, data.ServiceActive}:       true,
+	{data.ServicePending, data.ServiceSuspended}:    true,
+	{data.ServicePending, data.ServiceTerminated}:   true,
+	{data.ServiceActive, data.ServiceSuspended}:     true,
+	{data.ServiceActive, data.ServiceTerminated}:    true,
+	{data.ServiceSuspended, data.ServiceActive}:     true,
+	{data.ServiceSuspended, data.ServiceTerminated}: true,
+}
+
+func testTransitions(t *testing.T, dim string, statuses []string,
+	legal map[transition]bool, check func(from, to string) error) {
+	// An unknown status is never legal.
+	statuses = append(statuses, "unknown")
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			err := check(from, to)
+			if legal[transition{from, to}] {
+				if err != nil {
+					t.Fatalf("legal %s transition %s -> %s "+
+						"failed: %v", dim, from, to, err)
+				}
+				continue
+			}
+
+			terr, ok := err.(*TransitionError)
+			if !ok || terr.Dimension != dim ||
+				terr.From != from || terr.To != to {
+				t.Fatalf("illegal %s transition %s -> %s: "+
+					"unexpected result: %v", dim, from, to, err)
+			}
+		}
+	}
+}
+
+func TestChannelTransitions(t *testing.T) {
+	testTransitions(t, DimChannel, channelStatuses, legalChannel,
+		CheckChannel)
+}
+
+func TestServiceTransitions(t *testing.T) {
+	testTransitions(t, DimService, serviceStatuses, legalService,
+		CheckService)
+}
+
+// allowed tells whether a status is kept or legally changed.
+func allowed(legal map[transition]bool, from, to string) bool {
+	return from == to || legal[transition{from, to}]
+}
+
+func TestCheck(t *testing.T) {
+	for _, chFrom := range channelStatuses {
+		for _, svcFrom := range serviceStatuses {
+			testCheck(t, &data.Channel{
+				ChannelStatus: chFrom,
+				ServiceStatus: svcFrom,
+			})
+		}
+	}
+}
+
+func testCheck(t *testing.T, ch *data.Channel) {
+	for _, chTo := range channelStatuses {
+		for _, svcTo := range serviceStatuses {
+			legal := allowed(legalChannel, ch.ChannelStatus, chTo) &&
+				allowed(legalService, ch.ServiceStatus, svcTo)
+
+			err := Check(ch, chTo, svcTo)
+			if legal != (err == nil) {
+				t.Fatalf("%s/%s -> %s/%s: unexpected result: %v",
+					ch.ChannelStatus, ch.ServiceStatus,
+					chTo, svcTo, err)
+			}
+		}
+	}
+}
+
+func TestMain(m *testing.M) {
+	// Ignore config flags when run all packages tests.
+	util.ReadTestConfig(&struct{}{})
+
+	os.Exit(m.Run())
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"math/big"
 
+	ethereum "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -26,13 +27,27 @@ type EthBackend interface {
 
 	PTCIncreaseApproval(*bind.TransactOpts, common.Address, *big.Int) (*types.Transaction, error)
 
+	PTCTransfer(*bind.TransactOpts, common.Address, *big.Int) (*types.Transaction, error)
+
 	PSCBalanceOf(*bind.CallOpts, common.Address) (*big.Int, error)
 
 	PSCAddBalanceERC20(*bind.TransactOpts, *big.Int) (*types.Transaction, error)
 
 	PSCReturnBalanceERC20(*bind.TransactOpts, *big.Int) (*types.Transaction, error)
 
+	PSCOwner(*bind.CallOpts) (common.Address, error)
+
+	PSCNetworkFee(*bind.CallOpts) (uint32, error)
+
+	PSCSetNetworkFee(*bind.TransactOpts, uint32) (*types.Transaction, error)
+
 	EthBalanceAt(context.Context, common.Address) (*big.Int, error)
+
+	SendTransaction(context.Context, *types.Transaction) error
+
+	PendingNonceAt(context.Context, common.Address) (uint64, error)
+
+	EstimateGas(context.Context, ethereum.CallMsg) (uint64, error)
 }
 
 type ethBackendInstance struct {
@@ -76,6 +91,11 @@ func (b *ethBackendInstance) PTCIncreaseApproval(opts *bind.TransactOpts,
 	return b.ptc.IncreaseApproval(opts, spender, addedVal)
 }
 
+func (b *ethBackendInstance) PTCTransfer(opts *bind.TransactOpts,
+	to common.Address, value *big.Int) (*types.Transaction, error) {
+	return b.ptc.Transfer(opts, to, value)
+}
+
 func (b *ethBackendInstance) PSCBalanceOf(opts *bind.CallOpts,
 	owner common.Address) (*big.Int, error) {
 	return b.psc.BalanceOf(opts, owner)
@@ -91,7 +111,37 @@ func (b *ethBackendInstance) PSCReturnBalanceERC20(opts *bind.TransactOpts,
 	return b.psc.ReturnBalanceERC20(opts, amount)
 }
 
+func (b *ethBackendInstance) PSCOwner(
+	opts *bind.CallOpts) (common.Address, error) {
+	return b.psc.Owner(opts)
+}
+
+func (b *ethBackendInstance) PSCNetworkFee(
+	opts *bind.CallOpts) (uint32, error) {
+	return b.psc.NetworkFee(opts)
+}
+
+func (b *ethBackendInstance) PSCSetNetworkFee(opts *bind.TransactOpts,
+	fee uint32) (*types.Transaction, error) {
+	return b.psc.SetNetworkFee(opts, fee)
+}
+
 func (b *ethBackendInstance) EthBalanceAt(ctx context.Context,
 	owner common.Address) (*big.Int, error) {
 	return b.conn.BalanceAt(ctx, owner, nil)
 }
+
+func (b *ethBackendInstance) SendTransaction(ctx context.Context,
+	tx *types.Transaction) error {
+	return b.conn.SendTransaction(ctx, tx)
+}
+
+func (b *ethBackendInstance) PendingNonceAt(ctx context.Context,
+	account common.Address) (uint64, error) {
+	return b.conn.PendingNonceAt(ctx, account)
+}
+
+func (b *ethBackendInstance) EstimateGas(ctx context.Context,
+	msg ethereum.CallMsg) (uint64, error) {
+	return b.conn.EstimateGas(ctx, msg)
+}
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"testing"
 
+	ethereum "github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
@@ -20,13 +21,17 @@ type testEthBackCall struct {
 }
 
 type testEthBackend struct {
-	callStack  []testEthBackCall
-	balanceEth *big.Int
-	balancePSC *big.Int
-	balancePTC *big.Int
-	abi        abi.ABI
-	pscAddr    common.Address
-	tx         *types.Transaction
+	callStack   []testEthBackCall
+	balanceEth  *big.Int
+	balancePSC  *big.Int
+	balancePTC  *big.Int
+	networkFee  uint32
+	owner       common.Address
+	abi         abi.ABI
+	pscAddr     common.Address
+	tx          *types.Transaction
+	nonce       uint64
+	gasEstimate uint64
 }
 
 func newTestEthBackend(pscAddr common.Address) *testEthBackend {
@@ -102,6 +107,18 @@ func (b *testEthBackend) PTCIncreaseApproval(opts *bind.TransactOpts,
 	return tx, nil
 }
 
+func (b *testEthBackend) PTCTransfer(opts *bind.TransactOpts,
+	to common.Address, value *big.Int) (*types.Transaction, error) {
+	b.callStack = append(b.callStack, testEthBackCall{
+		method: "PTCTransfer",
+		caller: opts.From,
+		txOpts: opts,
+		args:   []interface{}{to, value},
+	})
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(1), 1, big.NewInt(1), nil)
+	return tx, nil
+}
+
 func (b *testEthBackend) PSCAddBalanceERC20(opts *bind.TransactOpts,
 	val *big.Int) (*types.Transaction, error) {
 	b.callStack = append(b.callStack, testEthBackCall{
@@ -126,6 +143,58 @@ func (b *testEthBackend) PSCReturnBalanceERC20(opts *bind.TransactOpts,
 	return tx, nil
 }
 
+func (b *testEthBackend) PSCOwner(
+	opts *bind.CallOpts) (common.Address, error) {
+	b.callStack = append(b.callStack, testEthBackCall{
+		method: "PSCOwner",
+		caller: opts.From,
+	})
+	return b.owner, nil
+}
+
+func (b *testEthBackend) PSCNetworkFee(opts *bind.CallOpts) (uint32, error) {
+	b.callStack = append(b.callStack, testEthBackCall{
+		method: "PSCNetworkFee",
+		caller: opts.From,
+	})
+	return b.networkFee, nil
+}
+
+func (b *testEthBackend) PSCSetNetworkFee(opts *bind.TransactOpts,
+	fee uint32) (*types.Transaction, error) {
+	b.callStack = append(b.callStack, testEthBackCall{
+		method: "PSCSetNetworkFee",
+		caller: opts.From,
+		txOpts: opts,
+		args:   []interface{}{fee},
+	})
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(1), 1, big.NewInt(1), nil)
+	return tx, nil
+}
+
+func (b *testEthBackend) SendTransaction(_ context.Context,
+	tx *types.Transaction) error {
+	b.callStack = append(b.callStack, testEthBackCall{
+		method: "SendTransaction",
+		args:   []interface{}{tx},
+	})
+	return nil
+}
+
+func (b *testEthBackend) PendingNonceAt(_ context.Context,
+	addr common.Address) (uint64, error) {
+	return b.nonce, nil
+}
+
+// EstimateGas returns a set estimate or a given gas limit if it is not set.
+func (b *testEthBackend) EstimateGas(_ context.Context,
+	msg ethereum.CallMsg) (uint64, error) {
+	if b.gasEstimate == 0 {
+		return msg.Gas, nil
+	}
+	return b.gasEstimate, nil
+}
+
 // setTransaction mocks return value for GetTransactionByHash.
 func (b *testEthBackend) setTransaction(t *testing.T,
 	opts *bind.TransactOpts, input []byte) {
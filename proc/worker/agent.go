@@ -9,12 +9,15 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 
 	"github.com/privatix/dappctrl/data"
 	"github.com/privatix/dappctrl/eth"
 	"github.com/privatix/dappctrl/messages"
 	"github.com/privatix/dappctrl/messages/offer"
+	"github.com/privatix/dappctrl/proc/state"
+	"github.com/privatix/dappctrl/signer"
 	"github.com/privatix/dappctrl/util"
 )
 
@@ -64,13 +67,14 @@ func (w *Worker) AgentAfterChannelCreate(job *data.Job) error {
 		ID:            job.RelatedID,
 		Client:        data.FromBytes(logChannelCreated.clientAddr.Bytes()),
 		Agent:         data.FromBytes(logChannelCreated.agentAddr.Bytes()),
-		TotalDeposit:  logChannelCreated.deposit.Uint64(),
+		TotalDeposit:  data.NewAmountFromBig(logChannelCreated.deposit),
 		ChannelStatus: data.ChannelActive,
 		ServiceStatus: data.ServicePending,
 		Offering:      offering.ID,
 	}
 
-	if err := tx.Insert(channel); err != nil {
+	if err := state.Insert(tx, channel, job.CreatedBy,
+		&job.ID); err != nil {
 		tx.Rollback()
 		return fmt.Errorf("failed to insert %T: %v", channel, err)
 	}
@@ -128,7 +132,8 @@ func (w *Worker) AgentAfterChannelTopUp(job *data.Job) error {
 		return fmt.Errorf("related channel does not correspond to log input")
 	}
 
-	channel.TotalDeposit += logInput.addedDeposit.Uint64()
+	channel.TotalDeposit = channel.TotalDeposit.Add(
+		data.NewAmountFromBig(logInput.addedDeposit))
 	if err = w.db.Update(channel); err != nil {
 		return fmt.Errorf("could not update channels deposit: %v", err)
 	}
@@ -146,7 +151,7 @@ func (w *Worker) AgentAfterUncooperativeCloseRequest(job *data.Job) error {
 
 	var jobType string
 
-	if channel.ReceiptBalance > 0 {
+	if !channel.ReceiptBalance.IsZero() {
 		jobType = data.JobAgentPreCooperativeClose
 	} else {
 		jobType = data.JobAgentPreServiceTerminate
@@ -156,12 +161,8 @@ func (w *Worker) AgentAfterUncooperativeCloseRequest(job *data.Job) error {
 		return fmt.Errorf("could not add %s job: %v", jobType, err)
 	}
 
-	channel.ChannelStatus = data.ChannelInChallenge
-	if err = w.db.Update(channel); err != nil {
-		return fmt.Errorf("could not update channel's status: %v", err)
-	}
-
-	return nil
+	return w.updateChannelStatus(job, channel, data.ChannelInChallenge,
+		channel.ServiceStatus)
 }
 
 // AgentAfterUncooperativeClose marks channel closed uncoop.
@@ -177,12 +178,8 @@ func (w *Worker) AgentAfterUncooperativeClose(job *data.Job) error {
 		return err
 	}
 
-	channel.ChannelStatus = data.ChannelClosedUncoop
-	if err = w.db.Update(channel); err != nil {
-		return fmt.Errorf("could not update channel's status: %v", err)
-	}
-
-	return nil
+	return w.updateChannelStatus(job, channel, data.ChannelClosedUncoop,
+		channel.ServiceStatus)
 }
 
 // AgentPreCooperativeClose call contract cooperative close method and trigger
@@ -213,27 +210,22 @@ func (w *Worker) AgentPreCooperativeClose(job *data.Job) error {
 		return fmt.Errorf("unable to parse client addr: %v", err)
 	}
 
-	balance := big.NewInt(int64(channel.ReceiptBalance))
+	balance := channel.ReceiptBalance.Big()
 	block := uint32(channel.Block)
 
 	closingHash := eth.BalanceClosingHash(clientAddr, w.pscAddr, block,
 		offeringHash, balance)
 
-	accKey, err := w.key(agent.PrivateKey)
+	agentAddr, err := data.ToAddress(channel.Agent)
 	if err != nil {
-		return fmt.Errorf("unable to parse agent's key: %v", err)
+		return fmt.Errorf("unable to parse agent's address: %v", err)
 	}
 
-	closingSig, err := crypto.Sign(closingHash, accKey)
+	closingSig, err := w.signer.SignHash(agentAddr, closingHash)
 	if err != nil {
 		return fmt.Errorf("could not sign closing msg: %v", err)
 	}
 
-	agentAddr, err := data.ToAddress(channel.Agent)
-	if err != nil {
-		return fmt.Errorf("unable to parse agent's address: %v", err)
-	}
-
 	if channel.ReceiptSignature == nil {
 		return fmt.Errorf("no receipt signature in channel")
 	}
@@ -243,12 +235,21 @@ func (w *Worker) AgentPreCooperativeClose(job *data.Job) error {
 		return fmt.Errorf("unable to decode receipt signature: %v", err)
 	}
 
-	auth := bind.NewKeyedTransactor(accKey)
-	auth.GasLimit = w.gasConf.PSC.CooperativeClose
-
-	tx, err := w.ethBack.CooperativeClose(auth, agentAddr,
+	auth := signer.Transactor(w.signer, agentAddr)
+	auth.GasLimit, err = w.estimateGas(auth.From, w.pscAddr, w.abi,
+		w.gasConf.PSC.CooperativeClose, "cooperativeClose", agentAddr,
 		uint32(channel.Block), offeringHash, balance, balanceMsgSig,
 		closingSig)
+	if err != nil {
+		return err
+	}
+
+	tx, err := w.nonces.send(auth, func(
+		auth *bind.TransactOpts) (*types.Transaction, error) {
+		return w.ethBack.CooperativeClose(auth, agentAddr,
+			uint32(channel.Block), offeringHash, balance,
+			balanceMsgSig, closingSig)
+	})
 	if err != nil {
 		return fmt.Errorf("could not cooperative close: %v", err)
 	}
@@ -269,8 +270,8 @@ func (w *Worker) AgentAfterCooperativeClose(job *data.Job) error {
 		return err
 	}
 
-	channel.ChannelStatus = data.ChannelClosedCoop
-	return w.db.Update(channel)
+	return w.updateChannelStatus(job, channel, data.ChannelClosedCoop,
+		channel.ServiceStatus)
 }
 
 // AgentPreServiceSuspend marks service as suspended.
@@ -294,20 +295,18 @@ func (w *Worker) agentUpdateServiceStatus(job *data.Job, jobType string) error {
 		return err
 	}
 
+	var status string
 	switch jobType {
 	case data.JobAgentPreServiceSuspend:
-		channel.ServiceStatus = data.ServiceSuspended
+		status = data.ServiceSuspended
 	case data.JobAgentPreServiceTerminate:
-		channel.ServiceStatus = data.ServiceTerminated
+		status = data.ServiceTerminated
 	case data.JobAgentPreServiceUnsuspend:
-		channel.ServiceStatus = data.ServiceActive
-	}
-
-	if err = w.db.Update(channel); err != nil {
-		return fmt.Errorf("could not update service status: %v", err)
+		status = data.ServiceActive
 	}
 
-	return nil
+	return w.updateChannelStatus(job, channel, channel.ChannelStatus,
+		status)
 }
 
 // AgentPreEndpointMsgCreate prepares endpoint message to be sent to client.
@@ -348,12 +347,13 @@ func (w *Worker) AgentPreEndpointMsgCreate(job *data.Job) error {
 		return fmt.Errorf("could not find channel's agent: %v", err)
 	}
 
-	agentKey, err := w.key(agent.PrivateKey)
+	agentAddr, err := data.ToAddress(agent.EthAddr)
 	if err != nil {
-		return fmt.Errorf("unable to parse agent's priv key: %v", err)
+		return fmt.Errorf("unable to parse agent's address: %v", err)
 	}
 
-	msgSealed, err := messages.AgentSeal(msgBytes, clientPub, agentKey)
+	msgSealed, err := messages.AgentSeal(msgBytes, clientPub, w.signer,
+		agentAddr)
 	if err != nil {
 		return fmt.Errorf("could not seal endpoint message: %v", err)
 	}
@@ -446,11 +446,10 @@ func (w *Worker) AgentAfterEndpointMsgSOMCPublish(job *data.Job) error {
 		return err
 	}
 
-	if offering.BillingType == data.BillingPrepaid || offering.SetupPrice > 0 {
-		channel.ServiceStatus = data.ServiceSuspended
-		if err = w.db.Update(channel); err != nil {
-			return fmt.Errorf("failed to update %T: %v", channel, err)
-		}
+	if offering.BillingType == data.BillingPrepaid ||
+		!offering.SetupPrice.IsZero() {
+		return w.updateChannelStatus(job, channel,
+			channel.ChannelStatus, data.ServiceSuspended)
 	}
 
 	return nil
@@ -464,16 +463,17 @@ func (w *Worker) AgentPreOfferingMsgBCPublish(job *data.Job) error {
 		return err
 	}
 
-	minDeposit := offering.MinUnits*offering.UnitPrice + offering.SetupPrice
+	minDeposit := data.NewAmount(offering.MinUnits).Mul(
+		offering.UnitPrice).Add(offering.SetupPrice)
 
 	agent, err := w.account(offering.Agent)
 	if err != nil {
 		return fmt.Errorf("could not find offering's agent: %v", err)
 	}
 
-	agentKey, err := w.key(agent.PrivateKey)
+	agentAddr, err := data.ToAddress(agent.EthAddr)
 	if err != nil {
-		return fmt.Errorf("unable to parse agent's priv key: %v", err)
+		return fmt.Errorf("unable to parse agent's address: %v", err)
 	}
 
 	template, err := w.template(offering.Template)
@@ -488,7 +488,7 @@ func (w *Worker) AgentPreOfferingMsgBCPublish(job *data.Job) error {
 		return fmt.Errorf("failed to marshal offering msg: %v", err)
 	}
 
-	packed, err := messages.PackWithSignature(msgBytes, agentKey)
+	packed, err := messages.PackWithSignature(msgBytes, w.signer, agentAddr)
 	if err != nil {
 		return fmt.Errorf("failed to pack msg with signature: %v", err)
 	}
@@ -504,7 +504,12 @@ func (w *Worker) AgentPreOfferingMsgBCPublish(job *data.Job) error {
 		return err
 	}
 
-	auth := bind.NewKeyedTransactor(agentKey)
+	publishData.GasPrice, err = w.gasPrice(publishData.GasPrice)
+	if err != nil {
+		return err
+	}
+
+	auth := signer.Transactor(w.signer, agentAddr)
 
 	pscBalance, err := w.ethBack.PSCBalanceOf(&bind.CallOpts{}, auth.From)
 
@@ -512,8 +517,8 @@ func (w *Worker) AgentPreOfferingMsgBCPublish(job *data.Job) error {
 		return fmt.Errorf("failed to get psc balance: %v", err)
 	}
 
-	totalDeposit := minDeposit * uint64(offering.Supply)
-	if pscBalance.Uint64() < totalDeposit {
+	totalDeposit := minDeposit.Mul(data.NewAmount(uint64(offering.Supply)))
+	if pscBalance.Cmp(totalDeposit.Big()) < 0 {
 		return fmt.Errorf("failed to publish: insufficient psc balance")
 	}
 
@@ -522,19 +527,29 @@ func (w *Worker) AgentPreOfferingMsgBCPublish(job *data.Job) error {
 		return fmt.Errorf("failed to publish: %v", err)
 	}
 
-	wantedEthBalance := auth.GasLimit * publishData.GasPrice
-	if wantedEthBalance > ethAmount.Uint64() {
+	auth.GasLimit, err = w.estimateGas(auth.From, w.pscAddr, w.abi,
+		w.gasConf.PSC.RegisterServiceOffering, "registerServiceOffering",
+		[common.HashLength]byte(offeringHash),
+		minDeposit.Big(), offering.Supply)
+	if err != nil {
+		return err
+	}
+
+	wantedEthBalance := gasCost(auth.GasLimit, publishData.GasPrice)
+	if wantedEthBalance.Cmp(ethAmount) > 0 {
 		return fmt.Errorf("failed to publish: insufficient"+
 			"eth balance, wanted %v, got: %v", wantedEthBalance,
-			ethAmount.Uint64())
+			ethAmount)
 	}
 
 	auth.GasPrice = big.NewInt(int64(publishData.GasPrice))
-	auth.GasLimit = w.gasConf.PSC.RegisterServiceOffering
 
-	tx, err := w.ethBack.RegisterServiceOffering(auth,
-		[common.HashLength]byte(offeringHash),
-		big.NewInt(int64(minDeposit)), offering.Supply)
+	tx, err := w.nonces.send(auth, func(
+		auth *bind.TransactOpts) (*types.Transaction, error) {
+		return w.ethBack.RegisterServiceOffering(auth,
+			[common.HashLength]byte(offeringHash),
+			minDeposit.Big(), offering.Supply)
+	})
 	if err != nil {
 		return err
 	}
@@ -48,9 +48,10 @@ func TestAgentAfterChannelCreate(t *testing.T) {
 	env.ethBack.setTransaction(t, auth, nil)
 
 	// Create related eth log record.
-	var deposit int64 = 100
+	// Deposit does not fit into int64.
+	deposit := new(big.Int).Lsh(big.NewInt(1), 64)
 	logData, err := logChannelCreatedDataArguments.Pack(
-		big.NewInt(deposit),
+		deposit,
 		common.HexToHash("0x12312"))
 	if err != nil {
 		t.Fatal(err)
@@ -103,7 +104,7 @@ func TestAgentAfterChannelCreate(t *testing.T) {
 		t.Fatalf("wanted offering: %s, got: %s", fixture.Offering.ID,
 			channel.Offering)
 	}
-	if channel.TotalDeposit != uint64(deposit) {
+	if channel.TotalDeposit.Big().Cmp(deposit) != 0 {
 		t.Fatalf("wanted total deposit: %v, got: %v", deposit,
 			channel.TotalDeposit)
 	}
@@ -132,7 +133,7 @@ func TestAgentAfterChannelTopUp(t *testing.T) {
 	defer fixture.close()
 
 	block := fixture.Channel.Block
-	addedDeposit := big.NewInt(1)
+	addedDeposit := new(big.Int).Lsh(big.NewInt(1), 64)
 
 	eventData, err := logChannelTopUpDataArguments.Pack(block, addedDeposit)
 	if err != nil {
@@ -163,8 +164,8 @@ func TestAgentAfterChannelTopUp(t *testing.T) {
 	channel := &data.Channel{}
 	env.findTo(t, channel, fixture.Channel.ID)
 
-	diff := channel.TotalDeposit - fixture.Channel.TotalDeposit
-	if diff != addedDeposit.Uint64() {
+	diff := channel.TotalDeposit.Sub(fixture.Channel.TotalDeposit)
+	if diff.Big().Cmp(addedDeposit) != 0 {
 		t.Fatal("total deposit not updated")
 	}
 
@@ -194,7 +195,7 @@ func TestAgentAfterUncooperativeCloseRequest(t *testing.T) {
 	defer fixture.close()
 
 	testChangesStatusAndCreatesJob := func(t *testing.T, balance uint64, jobType string) {
-		fixture.Channel.ReceiptBalance = balance
+		fixture.Channel.ReceiptBalance = data.NewAmount(balance)
 		env.updateInTestDB(t, fixture.Channel)
 		runJob(t, env.worker.AgentAfterUncooperativeCloseRequest,
 			fixture.job)
@@ -261,7 +262,7 @@ func TestAgentPreCooperativeClose(t *testing.T) {
 
 	offeringHash := data.TestToHash(t, fixture.Offering.Hash)
 
-	balance := big.NewInt(int64(fixture.Channel.ReceiptBalance))
+	balance := fixture.Channel.ReceiptBalance.Big()
 
 	balanceMsgSig := data.TestToBytes(t, *fixture.Channel.ReceiptSignature)
 
@@ -271,7 +272,7 @@ func TestAgentPreCooperativeClose(t *testing.T) {
 		uint32(fixture.Channel.Block), offeringHash,
 		balance)
 
-	key, err := data.TestToPrivateKey(fixture.Account.PrivateKey, data.TestPassword)
+	key, err := data.TestToPrivateKey(*fixture.Account.PrivateKey, data.TestPassword)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -316,6 +317,21 @@ func testServiceStatusChanged(t *testing.T,
 	if newStatus != updated.ServiceStatus {
 		t.Fatalf("wanted: %s, got: %s", newStatus, updated.ChannelStatus)
 	}
+
+	if updated.ServiceChangedTime == nil {
+		t.Fatal("service changed time is not set")
+	}
+
+	ev := &data.ChannelEvent{}
+	if err := env.db.SelectOneTo(ev, `
+		WHERE channel = $1 AND job = $2
+		ORDER BY created_at DESC`, job.RelatedID, job.ID); err != nil {
+		t.Fatal("failed to find channel event: ", err)
+	}
+
+	if ev.NewServiceStatus != newStatus || ev.Cause != job.CreatedBy {
+		t.Fatalf("wrong channel event: %+v", ev)
+	}
 }
 
 func TestAgentPreServiceSuspend(t *testing.T) {
@@ -366,6 +382,28 @@ func TestAgentPreServiceTerminate(t *testing.T) {
 	testCommonErrors(t, env.worker.AgentPreServiceTerminate, *fixture.job)
 }
 
+func TestAgentIllegalServiceTransition(t *testing.T) {
+	env := newWorkerTest(t)
+	fixture := env.newTestFixture(t, data.JobAgentPreServiceUnsuspend,
+		data.JobChannel)
+	defer env.close()
+	defer fixture.close()
+
+	fixture.Channel.ServiceStatus = data.ServiceTerminated
+	env.updateInTestDB(t, fixture.Channel)
+
+	err := env.worker.AgentPreServiceUnsuspend(fixture.job)
+	if err == nil {
+		t.Fatal("terminated service is activated")
+	}
+
+	updated := &data.Channel{}
+	env.findTo(t, updated, fixture.Channel.ID)
+	if updated.ServiceStatus != data.ServiceTerminated {
+		t.Fatalf("service status changed to %s", updated.ServiceStatus)
+	}
+}
+
 func TestAgentPreEndpointMsgCreate(t *testing.T) {
 	// generate password
 	// store password in DB.channels.password + DB.channels.salt
@@ -466,7 +504,7 @@ func testAgentAfterEndpointMsgSOMCPublish(t *testing.T,
 	fixture.Channel.ServiceStatus = data.ServicePending
 	env.updateInTestDB(t, fixture.Channel)
 
-	fixture.Offering.SetupPrice = setupPrice
+	fixture.Offering.SetupPrice = data.NewAmount(setupPrice)
 	fixture.Offering.BillingType = billingType
 	env.updateInTestDB(t, fixture.Offering)
 
@@ -515,13 +553,19 @@ func TestAgentPreOfferingMsgBCPublish(t *testing.T) {
 	fixture.job.Data = jobDataB
 	env.updateInTestDB(t, fixture.job)
 
-	minDeposit := fixture.Offering.MinUnits*fixture.Offering.UnitPrice +
-		fixture.Offering.SetupPrice
+	minDeposit := data.NewAmount(fixture.Offering.MinUnits).Mul(
+		fixture.Offering.UnitPrice).Add(fixture.Offering.SetupPrice)
 
-	env.ethBack.balancePSC = big.NewInt(int64(minDeposit*
-		uint64(fixture.Offering.Supply) + 1))
-	env.ethBack.balanceEth = big.NewInt(99999)
+	env.ethBack.balancePSC = minDeposit.Mul(data.NewAmount(
+		uint64(fixture.Offering.Supply))).Add(data.NewAmount(1)).Big()
+	env.ethBack.balanceEth = big.NewInt(int64(
+		env.gasConf.PSC.RegisterServiceOffering*jobData.GasPrice - 1))
+	if err := env.worker.AgentPreOfferingMsgBCPublish(
+		fixture.job); err == nil {
+		t.Fatal("published with insufficient eth balance")
+	}
 
+	env.ethBack.balanceEth.Add(env.ethBack.balanceEth, big.NewInt(1))
 	runJob(t, env.worker.AgentPreOfferingMsgBCPublish, fixture.job)
 
 	agentAddr := data.TestToAddress(t, fixture.Channel.Agent)
@@ -542,7 +586,7 @@ func TestAgentPreOfferingMsgBCPublish(t *testing.T) {
 	env.ethBack.testCalled(t, "RegisterServiceOffering", agentAddr,
 		env.gasConf.PSC.RegisterServiceOffering,
 		[common.HashLength]byte(offeringHash),
-		big.NewInt(int64(minDeposit)), offering.Supply)
+		minDeposit.Big(), offering.Supply)
 
 	offering = &data.Offering{}
 	env.findTo(t, offering, fixture.Offering.ID)
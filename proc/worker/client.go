@@ -1,8 +1,107 @@
 package worker
 
-import "github.com/privatix/dappctrl/data"
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/signer"
+)
 
 // ClientPreChannelCreate creates channel.
 func (w *Worker) ClientPreChannelCreate(job *data.Job) error {
+	// TODO: check client budget caps (see client/budget) for the deposit
+	// here and in the top-up job, when channel creation and top-up are
+	// implemented. Neither is started from uisrv or proc yet.
 	return nil
 }
+
+// ClientPreCooperativeClose requests agent's closing signature for the
+// receipt balance and calls contract cooperative close method.
+func (w *Worker) ClientPreCooperativeClose(job *data.Job) error {
+	ch, err := w.relatedChannel(job, data.JobClientPreCooperativeClose)
+	if err != nil {
+		return err
+	}
+
+	jobData, err := w.closeData(job)
+	if err != nil {
+		return fmt.Errorf("failed to parse job data: %v", err)
+	}
+
+	jobData.GasPrice, err = w.gasPrice(jobData.GasPrice)
+	if err != nil {
+		return err
+	}
+
+	offering, err := w.offering(ch.Offering)
+	if err != nil {
+		return err
+	}
+
+	client, err := w.account(ch.Client)
+	if err != nil {
+		return err
+	}
+
+	offeringHash, err := w.toHashArr(offering.Hash)
+	if err != nil {
+		return err
+	}
+
+	agentAddr, err := data.ToAddress(ch.Agent)
+	if err != nil {
+		return fmt.Errorf("unable to parse agent's address: %v", err)
+	}
+
+	clientAddr, err := data.ToAddress(client.EthAddr)
+	if err != nil {
+		return fmt.Errorf("unable to parse client's address: %v", err)
+	}
+
+	sigs, err := w.requestClose(w.db, ch.ID, w.pscAddr.Hex(), w.signer,
+		w.payTLS, w.payTimeout)
+	if err != nil {
+		return fmt.Errorf("could not get closing signature: %v", err)
+	}
+
+	balance := sigs.Balance.Big()
+
+	gasLimit, err := w.estimateGas(clientAddr, w.pscAddr, w.abi,
+		w.gasConf.PSC.CooperativeClose, "cooperativeClose", agentAddr,
+		ch.Block, offeringHash, balance, sigs.BalanceMsgSig,
+		sigs.ClosingSig)
+	if err != nil {
+		return err
+	}
+
+	ethBalance, err := w.ethBalance(clientAddr)
+	if err != nil {
+		return err
+	}
+
+	wanted := gasCost(gasLimit, jobData.GasPrice)
+	if wanted.Cmp(ethBalance) > 0 {
+		return fmt.Errorf("unsufficient eth balance, wanted: %v, got: %v",
+			wanted, ethBalance)
+	}
+
+	auth := signer.Transactor(w.signer, clientAddr)
+	auth.GasLimit = gasLimit
+	auth.GasPrice = new(big.Int).SetUint64(jobData.GasPrice)
+
+	tx, err := w.nonces.send(auth, func(
+		auth *bind.TransactOpts) (*types.Transaction, error) {
+		return w.ethBack.CooperativeClose(auth, agentAddr, ch.Block,
+			offeringHash, balance, sigs.BalanceMsgSig, sigs.ClosingSig)
+	})
+	if err != nil {
+		return fmt.Errorf("could not cooperative close: %v", err)
+	}
+
+	return w.saveEthTX(job, tx, "CooperativeClose", job.RelatedType,
+		job.RelatedID, client.EthAddr, data.FromBytes(w.pscAddr.Bytes()))
+}
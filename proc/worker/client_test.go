@@ -1,7 +1,16 @@
 package worker
 
 import (
+	"fmt"
+	"math/big"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	reform "gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/pay"
+	"github.com/privatix/dappctrl/signer"
 )
 
 func TestClientPreChannelCreate(t *testing.T) {
@@ -62,6 +71,73 @@ func TestClientAfterUncooperativeClose(t *testing.T) {
 	// 1. set ch_status="closed_uncoop"
 }
 
+func TestClientPreCooperativeClose(t *testing.T) {
+	// 1. Request agent's closing signature.
+	// 2. PSC.cooperativeClose()
+	env := newWorkerTest(t)
+	fixture := env.newTestFixture(t, data.JobClientPreCooperativeClose,
+		data.JobChannel)
+	defer env.close()
+	defer fixture.close()
+
+	fixture.Channel.Client = fixture.Account.EthAddr
+	env.updateInTestDB(t, fixture.Channel)
+
+	sigs := &pay.CloseSignatures{
+		Balance:       data.NewAmount(5),
+		BalanceMsgSig: []byte("balance-sig"),
+		ClosingSig:    []byte("closing-sig"),
+	}
+
+	env.worker.requestClose = func(db *reform.DB, channel, pscAddr string,
+		s signer.Signer, tls bool, timeout uint) (*pay.CloseSignatures,
+		error) {
+		if channel != fixture.Channel.ID {
+			t.Fatalf("unexpected channel: %s", channel)
+		}
+		return sigs, nil
+	}
+
+	// Test eth transaction was recorder.
+	defer env.deleteEthTx(t, fixture.job.ID)
+
+	jobData := &data.JobCloseData{GasPrice: 10}
+	fixture.setJobData(t, jobData)
+
+	env.ethBack.balanceEth = big.NewInt(int64(
+		env.gasConf.PSC.CooperativeClose*jobData.GasPrice - 1))
+	if err := env.worker.ClientPreCooperativeClose(
+		fixture.job); err == nil {
+		t.Fatal("closed with insufficient eth balance")
+	}
+
+	env.ethBack.balanceEth.Add(env.ethBack.balanceEth, big.NewInt(1))
+	runJob(t, env.worker.ClientPreCooperativeClose, fixture.job)
+
+	agentAddr := data.TestToAddress(t, fixture.Channel.Agent)
+	clientAddr := data.TestToAddress(t, fixture.Channel.Client)
+	offeringHash := data.TestToHash(t, fixture.Offering.Hash)
+
+	env.ethBack.testCalled(t, "CooperativeClose", clientAddr,
+		env.gasConf.PSC.CooperativeClose, agentAddr,
+		uint32(fixture.Channel.Block),
+		[common.HashLength]byte(offeringHash), sigs.Balance.Big(),
+		sigs.BalanceMsgSig, sigs.ClosingSig)
+
+	env.worker.requestClose = func(db *reform.DB, channel, pscAddr string,
+		s signer.Signer, tls bool, timeout uint) (*pay.CloseSignatures,
+		error) {
+		return nil, fmt.Errorf("some error")
+	}
+
+	if err := env.worker.ClientPreCooperativeClose(
+		fixture.job); err == nil {
+		t.Fatal("cooperative close without closing signature")
+	}
+
+	testCommonErrors(t, env.worker.ClientPreCooperativeClose, *fixture.job)
+}
+
 func TestClientAfterCooperativeClose(t *testing.T) {
 	t.Skip("TODO")
 	// 1. set ch_status="closed_coop"
@@ -4,11 +4,14 @@ import (
 	"database/sql"
 	"fmt"
 	"math/big"
-	"time"
 
+	"github.com/AlekSi/pointer"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	reform "gopkg.in/reform.v1"
 
 	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/signer"
 )
 
 // PreAccountAddBalanceApprove approve balance if amount exists.
@@ -24,6 +27,11 @@ func (w *Worker) PreAccountAddBalanceApprove(job *data.Job) error {
 		return fmt.Errorf("failed to parse job data: %v", err)
 	}
 
+	jobData.GasPrice, err = w.gasPrice(jobData.GasPrice)
+	if err != nil {
+		return err
+	}
+
 	addr, err := data.ToAddress(acc.EthAddr)
 	if err != nil {
 		return fmt.Errorf("unable to parse account's addr: %v", err)
@@ -34,7 +42,7 @@ func (w *Worker) PreAccountAddBalanceApprove(job *data.Job) error {
 		return fmt.Errorf("could not get account's ptc balance: %v", err)
 	}
 
-	if amount.Uint64() < uint64(jobData.Amount) {
+	if amount.Cmp(jobData.Amount.Big()) < 0 {
 		return fmt.Errorf("insufficient ptc balance")
 	}
 
@@ -43,23 +51,28 @@ func (w *Worker) PreAccountAddBalanceApprove(job *data.Job) error {
 		return fmt.Errorf("failed to get eth balance: %v", err)
 	}
 
-	wantedEthBalance := w.gasConf.PTC.Approve * jobData.GasPrice
-
-	if wantedEthBalance > amount.Uint64() {
-		return fmt.Errorf("unsufficient eth balance, wanted: %v, got: %v",
-			wantedEthBalance, amount.Uint64())
+	gasLimit, err := w.estimateGas(addr, w.ptcAddr, w.ptcABI,
+		w.gasConf.PTC.Approve, "increaseApproval", w.pscAddr,
+		jobData.Amount.Big())
+	if err != nil {
+		return err
 	}
 
-	key, err := w.key(acc.PrivateKey)
-	if err != nil {
-		return fmt.Errorf("unable to parse account's priv key: %v", err)
+	wantedEthBalance := gasCost(gasLimit, jobData.GasPrice)
+
+	if wantedEthBalance.Cmp(amount) > 0 {
+		return fmt.Errorf("unsufficient eth balance, wanted: %v, got: %v",
+			wantedEthBalance, amount)
 	}
 
-	auth := bind.NewKeyedTransactor(key)
-	auth.GasLimit = w.gasConf.PTC.Approve
+	auth := signer.Transactor(w.signer, addr)
+	auth.GasLimit = gasLimit
 	auth.GasPrice = big.NewInt(int64(jobData.GasPrice))
-	tx, err := w.ethBack.PTCIncreaseApproval(auth,
-		w.pscAddr, big.NewInt(int64(jobData.Amount)))
+	tx, err := w.nonces.send(auth, func(
+		auth *bind.TransactOpts) (*types.Transaction, error) {
+		return w.ethBack.PTCIncreaseApproval(auth,
+			w.pscAddr, jobData.Amount.Big())
+	})
 	if err != nil {
 		return fmt.Errorf("could not ptc increase approve: %v", err)
 	}
@@ -80,14 +93,29 @@ func (w *Worker) PreAccountAddBalance(job *data.Job) error {
 		return fmt.Errorf("failed to parse job data: %v", err)
 	}
 
-	key, err := w.key(acc.PrivateKey)
+	jobData.GasPrice, err = w.gasPrice(jobData.GasPrice)
 	if err != nil {
-		return fmt.Errorf("unable to parse account's priv key: %v", err)
+		return err
+	}
+
+	addr, err := data.ToAddress(acc.EthAddr)
+	if err != nil {
+		return fmt.Errorf("unable to parse account's addr: %v", err)
 	}
 
-	auth := bind.NewKeyedTransactor(key)
-	auth.GasLimit = w.gasConf.PSC.AddBalanceERC20
-	tx, err := w.ethBack.PSCAddBalanceERC20(auth, big.NewInt(int64(jobData.Amount)))
+	auth := signer.Transactor(w.signer, addr)
+	auth.GasLimit, err = w.estimateGas(auth.From, w.pscAddr, w.abi,
+		w.gasConf.PSC.AddBalanceERC20, "addBalanceERC20",
+		jobData.Amount.Big())
+	if err != nil {
+		return err
+	}
+	auth.GasPrice = big.NewInt(int64(jobData.GasPrice))
+	tx, err := w.nonces.send(auth, func(
+		auth *bind.TransactOpts) (*types.Transaction, error) {
+		return w.ethBack.PSCAddBalanceERC20(auth,
+			jobData.Amount.Big())
+	})
 	if err != nil {
 		return fmt.Errorf("could not add balance to psc: %v", err)
 	}
@@ -113,9 +141,9 @@ func (w *Worker) PreAccountReturnBalance(job *data.Job) error {
 		return err
 	}
 
-	key, err := w.key(acc.PrivateKey)
+	addr, err := data.ToAddress(acc.EthAddr)
 	if err != nil {
-		return fmt.Errorf("unable to parse account's priv key: %v", err)
+		return fmt.Errorf("unable to parse account's addr: %v", err)
 	}
 
 	jobData, err := w.balanceData(job)
@@ -123,14 +151,19 @@ func (w *Worker) PreAccountReturnBalance(job *data.Job) error {
 		return fmt.Errorf("failed to parse job data: %v", err)
 	}
 
-	auth := bind.NewKeyedTransactor(key)
+	jobData.GasPrice, err = w.gasPrice(jobData.GasPrice)
+	if err != nil {
+		return err
+	}
+
+	auth := signer.Transactor(w.signer, addr)
 
 	amount, err := w.ethBack.PSCBalanceOf(&bind.CallOpts{}, auth.From)
 	if err != nil {
 		return fmt.Errorf("could not get account's psc balance: %v", err)
 	}
 
-	if amount.Uint64() < uint64(jobData.Amount) {
+	if amount.Cmp(jobData.Amount.Big()) < 0 {
 		return fmt.Errorf("insufficient psc balance")
 	}
 
@@ -139,18 +172,28 @@ func (w *Worker) PreAccountReturnBalance(job *data.Job) error {
 		return fmt.Errorf("failed to get eth balance: %v", err)
 	}
 
-	wantedEthBalance := w.gasConf.PSC.ReturnBalanceERC20 * jobData.GasPrice
+	gasLimit, err := w.estimateGas(auth.From, w.pscAddr, w.abi,
+		w.gasConf.PSC.ReturnBalanceERC20, "returnBalanceERC20",
+		jobData.Amount.Big())
+	if err != nil {
+		return err
+	}
+
+	wantedEthBalance := gasCost(gasLimit, jobData.GasPrice)
 
-	if wantedEthBalance > amount.Uint64() {
+	if wantedEthBalance.Cmp(amount) > 0 {
 		return fmt.Errorf("unsufficient eth balance, wanted: %v, got: %v",
-			wantedEthBalance, amount.Uint64())
+			wantedEthBalance, amount)
 	}
 
-	auth.GasLimit = w.gasConf.PSC.ReturnBalanceERC20
+	auth.GasLimit = gasLimit
 	auth.GasPrice = big.NewInt(int64(jobData.GasPrice))
 
-	tx, err := w.ethBack.PSCReturnBalanceERC20(auth,
-		big.NewInt(int64(jobData.Amount)))
+	tx, err := w.nonces.send(auth, func(
+		auth *bind.TransactOpts) (*types.Transaction, error) {
+		return w.ethBack.PSCReturnBalanceERC20(auth,
+			jobData.Amount.Big())
+	})
 	if err != nil {
 		return fmt.Errorf("could not return balance from psc: %v", err)
 	}
@@ -169,22 +212,251 @@ func (w *Worker) AfterAccountReturnBalance(job *data.Job) error {
 	return w.updateAccountBalances(acc)
 }
 
-// AccountAddCheckBalance updates ptc, psc and eth balance values.
+// PreAccountWithdrawETH transfers ether from an account to an external
+// address.
+func (w *Worker) PreAccountWithdrawETH(job *data.Job) error {
+	acc, err := w.relatedAccount(job, data.JobPreAccountWithdrawETH)
+	if err != nil {
+		return err
+	}
+
+	jobData, err := w.withdrawData(job)
+	if err != nil {
+		return fmt.Errorf("failed to parse job data: %v", err)
+	}
+
+	jobData.GasPrice, err = w.gasPrice(jobData.GasPrice)
+	if err != nil {
+		return err
+	}
+
+	addr, err := data.ToAddress(acc.EthAddr)
+	if err != nil {
+		return fmt.Errorf("unable to parse account's addr: %v", err)
+	}
+
+	to, err := data.ToAddress(jobData.To)
+	if err != nil {
+		return fmt.Errorf("unable to parse withdrawal addr: %v", err)
+	}
+
+	amount, err := w.ethBalance(addr)
+	if err != nil {
+		return fmt.Errorf("failed to get eth balance: %v", err)
+	}
+
+	value := jobData.Amount.Big()
+
+	gas, err := w.estimateTransferGas(addr, to, value,
+		w.gasConf.ETH.Transfer)
+	if err != nil {
+		return err
+	}
+
+	wantedEthBalance := gasCost(gas, jobData.GasPrice)
+	wantedEthBalance.Add(wantedEthBalance, value)
+
+	if wantedEthBalance.Cmp(amount) > 0 {
+		return fmt.Errorf("unsufficient eth balance, wanted: %v, got: %v",
+			wantedEthBalance, amount)
+	}
+
+	auth := signer.Transactor(w.signer, addr)
+	auth.GasLimit = gas
+	auth.GasPrice = new(big.Int).SetUint64(jobData.GasPrice)
+	tx, err := w.nonces.send(auth, func(
+		auth *bind.TransactOpts) (*types.Transaction, error) {
+		return w.sendEth(auth, to, value)
+	})
+	if err != nil {
+		return fmt.Errorf("could not withdraw eth: %v", err)
+	}
+
+	return w.saveEthTX(job, tx, ethTransferMethod, job.RelatedType,
+		job.RelatedID, acc.EthAddr, jobData.To)
+}
+
+// PreAccountWithdrawPTC transfers ptc from an account to an external
+// address.
+func (w *Worker) PreAccountWithdrawPTC(job *data.Job) error {
+	acc, err := w.relatedAccount(job, data.JobPreAccountWithdrawPTC)
+	if err != nil {
+		return err
+	}
+
+	jobData, err := w.withdrawData(job)
+	if err != nil {
+		return fmt.Errorf("failed to parse job data: %v", err)
+	}
+
+	jobData.GasPrice, err = w.gasPrice(jobData.GasPrice)
+	if err != nil {
+		return err
+	}
+
+	addr, err := data.ToAddress(acc.EthAddr)
+	if err != nil {
+		return fmt.Errorf("unable to parse account's addr: %v", err)
+	}
+
+	to, err := data.ToAddress(jobData.To)
+	if err != nil {
+		return fmt.Errorf("unable to parse withdrawal addr: %v", err)
+	}
+
+	value := jobData.Amount.Big()
+
+	amount, err := w.ethBack.PTCBalanceOf(&bind.CallOpts{}, addr)
+	if err != nil {
+		return fmt.Errorf("could not get account's ptc balance: %v", err)
+	}
+
+	if amount.Cmp(value) < 0 {
+		return fmt.Errorf("insufficient ptc balance")
+	}
+
+	amount, err = w.ethBalance(addr)
+	if err != nil {
+		return fmt.Errorf("failed to get eth balance: %v", err)
+	}
+
+	gasLimit, err := w.estimateGas(addr, w.ptcAddr, w.ptcABI,
+		w.gasConf.PTC.Transfer, "transfer", to, value)
+	if err != nil {
+		return err
+	}
+
+	wantedEthBalance := gasCost(gasLimit, jobData.GasPrice)
+
+	if wantedEthBalance.Cmp(amount) > 0 {
+		return fmt.Errorf("unsufficient eth balance, wanted: %v, got: %v",
+			wantedEthBalance, amount)
+	}
+
+	auth := signer.Transactor(w.signer, addr)
+	auth.GasLimit = gasLimit
+	auth.GasPrice = new(big.Int).SetUint64(jobData.GasPrice)
+	tx, err := w.nonces.send(auth, func(
+		auth *bind.TransactOpts) (*types.Transaction, error) {
+		return w.ethBack.PTCTransfer(auth, to, value)
+	})
+	if err != nil {
+		return fmt.Errorf("could not withdraw ptc: %v", err)
+	}
+
+	return w.saveEthTX(job, tx, "PTCTransfer", job.RelatedType,
+		job.RelatedID, acc.EthAddr, jobData.To)
+}
+
+// PreAccountSetNetworkFee sets a network fee of the service contract. Only
+// the contract owner is allowed to do it.
+func (w *Worker) PreAccountSetNetworkFee(job *data.Job) error {
+	acc, err := w.relatedAccount(job, data.JobPreAccountSetNetworkFee)
+	if err != nil {
+		return err
+	}
+
+	jobData, err := w.networkFeeData(job)
+	if err != nil {
+		return fmt.Errorf("failed to parse job data: %v", err)
+	}
+
+	jobData.GasPrice, err = w.gasPrice(jobData.GasPrice)
+	if err != nil {
+		return err
+	}
+
+	addr, err := data.ToAddress(acc.EthAddr)
+	if err != nil {
+		return fmt.Errorf("unable to parse account's addr: %v", err)
+	}
+
+	owner, err := w.ethBack.PSCOwner(&bind.CallOpts{})
+	if err != nil {
+		return fmt.Errorf("could not get psc owner: %v", err)
+	}
+
+	if owner != addr {
+		return fmt.Errorf("account is not the psc owner")
+	}
+
+	amount, err := w.ethBalance(addr)
+	if err != nil {
+		return fmt.Errorf("failed to get eth balance: %v", err)
+	}
+
+	gasLimit, err := w.estimateGas(addr, w.pscAddr, w.abi,
+		w.gasConf.PSC.SetNetworkFee, "setNetworkFee", jobData.NetworkFee)
+	if err != nil {
+		return err
+	}
+
+	wantedEthBalance := gasCost(gasLimit, jobData.GasPrice)
+
+	if wantedEthBalance.Cmp(amount) > 0 {
+		return fmt.Errorf("unsufficient eth balance, wanted: %v, got: %v",
+			wantedEthBalance, amount)
+	}
+
+	auth := signer.Transactor(w.signer, addr)
+	auth.GasLimit = gasLimit
+	auth.GasPrice = new(big.Int).SetUint64(jobData.GasPrice)
+	tx, err := w.nonces.send(auth, func(
+		auth *bind.TransactOpts) (*types.Transaction, error) {
+		return w.ethBack.PSCSetNetworkFee(auth, jobData.NetworkFee)
+	})
+	if err != nil {
+		return fmt.Errorf("could not set network fee: %v", err)
+	}
+
+	return w.saveEthTX(job, tx, "PSCSetNetworkFee", job.RelatedType,
+		job.RelatedID, acc.EthAddr, data.FromBytes(w.pscAddr.Bytes()))
+}
+
+// AccountUpdateNetworkFee reads a network fee of the service contract and
+// stores it in settings. The jobs are added by the transaction tracker once
+// a new fee is set, or by user request.
+func (w *Worker) AccountUpdateNetworkFee(job *data.Job) error {
+	if _, err := w.relatedAccount(job,
+		data.JobAccountUpdateNetworkFee); err != nil {
+		return err
+	}
+
+	fee, err := w.ethBack.PSCNetworkFee(&bind.CallOpts{})
+	if err != nil {
+		return fmt.Errorf("could not get network fee: %v", err)
+	}
+
+	setting := &data.Setting{
+		Key:   data.SettingNetworkFee,
+		Value: fmt.Sprint(fee),
+		Description: pointer.ToString("network fee of the service " +
+			"contract, updated from the blockchain."),
+		Name: "network fee",
+	}
+
+	err = w.db.Update(setting)
+	if err == reform.ErrNoRows {
+		err = w.db.Insert(setting)
+	}
+	if err != nil {
+		return fmt.Errorf("could not save network fee: %v", err)
+	}
+
+	return nil
+}
+
+// AccountAddCheckBalance updates ptc, psc and eth balance values. The jobs
+// are added periodically by the balance checker.
 func (w *Worker) AccountAddCheckBalance(job *data.Job) error {
 	acc, err := w.relatedAccount(job, data.JobAccountAddCheckBalance)
 	if err != nil {
-		// Account was deleted, stop updating.
+		// Account was deleted, nothing to update.
 		if err == sql.ErrNoRows {
 			return nil
 		}
 		return err
 	}
 
-	if err = w.updateAccountBalances(acc); err != nil {
-		return err
-	}
-
-	// HACK: return error to repeat job after a minute.
-	job.NotBefore = time.Now().Add(time.Minute)
-	return fmt.Errorf("repeating job")
+	return w.updateAccountBalances(acc)
 }
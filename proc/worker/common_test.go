@@ -1,11 +1,12 @@
 package worker
 
 import (
+	"fmt"
 	"math/big"
-	"strings"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 
 	"github.com/privatix/dappctrl/data"
 )
@@ -22,18 +23,22 @@ func TestPreAccountAddBalanceApprove(t *testing.T) {
 	var transferAmount int64 = 10
 
 	fixture.setJobData(t, data.JobBalanceData{
-		Amount: uint(transferAmount),
+		Amount: data.NewAmount(uint64(transferAmount)),
 	})
 
+	// Balance check is based on the gas estimate, not the upper bound.
+	env.ethBack.gasEstimate = 1000
+	gasLimit := env.ethBack.gasEstimate +
+		env.ethBack.gasEstimate*env.gasConf.EstimateMargin/100
+
 	env.ethBack.balancePTC = big.NewInt(transferAmount)
-	env.ethBack.balanceEth = big.NewInt(999999)
+	env.ethBack.balanceEth = big.NewInt(int64(gasLimit * env.gasOracle.price))
 
 	runJob(t, env.worker.PreAccountAddBalanceApprove, fixture.job)
 
 	agentAddr := data.TestToAddress(t, fixture.Account.EthAddr)
 
-	env.ethBack.testCalled(t, "PTCIncreaseApproval", agentAddr,
-		env.gasConf.PTC.Approve,
+	env.ethBack.testCalled(t, "PTCIncreaseApproval", agentAddr, gasLimit,
 		conf.pscAddr,
 		big.NewInt(transferAmount))
 
@@ -59,7 +64,7 @@ func TestPreAccountAddBalance(t *testing.T) {
 	var transferAmount int64 = 10
 
 	fixture.setJobData(t, data.JobBalanceData{
-		Amount: uint(transferAmount),
+		Amount: data.NewAmount(uint64(transferAmount)),
 	})
 
 	runJob(t, env.worker.PreAccountAddBalance, fixture.job)
@@ -69,6 +74,12 @@ func TestPreAccountAddBalance(t *testing.T) {
 	env.ethBack.testCalled(t, "PSCAddBalanceERC20", agentAddr,
 		env.gasConf.PSC.AddBalanceERC20, big.NewInt(transferAmount))
 
+	// Gas price is not set in job data, so a recommended one is used.
+	if price := env.ethBack.callStack[0].txOpts.GasPrice; price == nil ||
+		price.Uint64() != env.gasOracle.price {
+		t.Fatal("recommended gas price is not used")
+	}
+
 	// Test eth transaction was recorded.
 	env.deleteEthTx(t, fixture.job.ID)
 
@@ -87,7 +98,7 @@ func TestPreAccountReturnBalance(t *testing.T) {
 	var amount int64 = 10
 
 	fixture.setJobData(t, &data.JobBalanceData{
-		Amount: uint(amount),
+		Amount: data.NewAmount(uint64(amount)),
 	})
 
 	env.ethBack.balancePSC = big.NewInt(amount)
@@ -109,6 +120,91 @@ func TestPreAccountReturnBalance(t *testing.T) {
 	testCommonErrors(t, env.worker.PreAccountReturnBalance, *fixture.job)
 }
 
+func TestPreAccountWithdrawETH(t *testing.T) {
+	env := newWorkerTest(t)
+	fixture := env.newTestFixture(t, data.JobPreAccountWithdrawETH,
+		data.JobAccount)
+	defer env.close()
+	defer fixture.close()
+
+	var amount int64 = 10
+	to := common.HexToAddress("0x5")
+
+	fixture.setJobData(t, &data.JobWithdrawData{
+		Amount: data.NewAmount(uint64(amount)),
+		To:     data.FromBytes(to.Bytes()),
+	})
+
+	// Transfers to contracts cost more than a plain transfer.
+	env.ethBack.gasEstimate = 30000
+	gasLimit := env.ethBack.gasEstimate +
+		env.ethBack.gasEstimate*env.gasConf.EstimateMargin/100
+
+	// Not enough to pay for gas on top of the amount.
+	env.ethBack.balanceEth = big.NewInt(
+		amount + int64(gasLimit*env.gasOracle.price) - 1)
+	if err := env.worker.PreAccountWithdrawETH(fixture.job); err == nil {
+		t.Fatal("withdrawal with insufficient eth balance succeeded")
+	}
+
+	env.ethBack.balanceEth.Add(env.ethBack.balanceEth, big.NewInt(1))
+
+	runJob(t, env.worker.PreAccountWithdrawETH, fixture.job)
+
+	call := env.ethBack.callStack[len(env.ethBack.callStack)-1]
+	if call.method != "SendTransaction" {
+		t.Fatalf("transaction not sent, last call: %s", call.method)
+	}
+
+	tx := call.args[0].(*types.Transaction)
+	if *tx.To() != to || tx.Value().Int64() != amount ||
+		tx.Gas() != gasLimit ||
+		tx.GasPrice().Uint64() != env.gasOracle.price {
+		t.Fatal("wrong transaction sent")
+	}
+
+	// Test eth transaction was recorded.
+	env.deleteEthTx(t, fixture.job.ID)
+
+	testCommonErrors(t, env.worker.PreAccountWithdrawETH, *fixture.job)
+}
+
+func TestPreAccountWithdrawPTC(t *testing.T) {
+	env := newWorkerTest(t)
+	fixture := env.newTestFixture(t, data.JobPreAccountWithdrawPTC,
+		data.JobAccount)
+	defer env.close()
+	defer fixture.close()
+
+	var amount int64 = 10
+	to := common.HexToAddress("0x5")
+
+	fixture.setJobData(t, &data.JobWithdrawData{
+		Amount: data.NewAmount(uint64(amount)),
+		To:     data.FromBytes(to.Bytes()),
+	})
+
+	env.ethBack.balancePTC = big.NewInt(amount - 1)
+	env.ethBack.balanceEth = big.NewInt(999999999)
+	if err := env.worker.PreAccountWithdrawPTC(fixture.job); err == nil {
+		t.Fatal("withdrawal with insufficient ptc balance succeeded")
+	}
+
+	env.ethBack.balancePTC = big.NewInt(amount)
+
+	runJob(t, env.worker.PreAccountWithdrawPTC, fixture.job)
+
+	agentAddr := data.TestToAddress(t, fixture.Account.EthAddr)
+
+	env.ethBack.testCalled(t, "PTCTransfer", agentAddr,
+		env.gasConf.PTC.Transfer, to, big.NewInt(amount))
+
+	// Test eth transaction was recorded.
+	env.deleteEthTx(t, fixture.job.ID)
+
+	testCommonErrors(t, env.worker.PreAccountWithdrawPTC, *fixture.job)
+}
+
 func TestAfterAccountAddBalance(t *testing.T) {
 	// update balance in DB.accounts.ptc_balance
 	env := newWorkerTest(t)
@@ -126,12 +222,11 @@ func TestAfterAccountReturnBalance(t *testing.T) {
 		data.JobAfterAccountReturnBalance)
 }
 
-func TestAccountAddCheckBalancee(t *testing.T) {
-	t.Skip("TODO")
-	// env := newWorkerTest(t)
-	// defer env.close()
-	// testAccountBalancesUpdate(t, env, env.worker.AccountAddCheckBalance,
-	// 	data.JobAccountAddCheckBalance)
+func TestAccountAddCheckBalance(t *testing.T) {
+	env := newWorkerTest(t)
+	defer env.close()
+	testAccountBalancesUpdate(t, env, env.worker.AccountAddCheckBalance,
+		data.JobAccountAddCheckBalance)
 }
 
 func testAccountBalancesUpdate(t *testing.T, env *workerTest,
@@ -141,28 +236,86 @@ func testAccountBalancesUpdate(t *testing.T, env *workerTest,
 	fixture := env.newTestFixture(t, jobType, data.JobAccount)
 	defer fixture.close()
 
-	env.ethBack.balanceEth = big.NewInt(2)
-	env.ethBack.balancePTC = big.NewInt(100)
-	env.ethBack.balancePSC = big.NewInt(200)
+	// Balances do not fit into int64.
+	huge := new(big.Int).Lsh(big.NewInt(1), 64)
+	env.ethBack.balanceEth = new(big.Int).Add(huge, big.NewInt(2))
+	env.ethBack.balancePTC = new(big.Int).Add(huge, big.NewInt(100))
+	env.ethBack.balancePSC = new(big.Int).Add(huge, big.NewInt(200))
 
 	runJob(t, worker, fixture.job)
 
 	account := &data.Account{}
 	env.findTo(t, account, fixture.Account.ID)
-	if account.PTCBalance != 100 {
-		t.Fatalf("wrong ptc balance, wanted: %v, got: %v", 100,
-			account.PTCBalance)
+	if account.PTCBalance.Big().Cmp(env.ethBack.balancePTC) != 0 {
+		t.Fatalf("wrong ptc balance, wanted: %v, got: %v",
+			env.ethBack.balancePTC, account.PTCBalance)
+	}
+	if account.PSCBalance.Big().Cmp(env.ethBack.balancePSC) != 0 {
+		t.Fatalf("wrong psc balance, wanted: %v, got: %v",
+			env.ethBack.balancePSC, account.PSCBalance)
 	}
-	if account.PSCBalance != 200 {
-		t.Fatalf("wrong psc balance, wanted: %v, got: %v", 200,
-			account.PSCBalance)
+	if account.EthBalance.Big().Cmp(env.ethBack.balanceEth) != 0 {
+		t.Fatalf("wrong eth balance, wanted: %v, got: %v",
+			env.ethBack.balanceEth, account.EthBalance)
 	}
-	if strings.TrimSpace(string(account.EthBalance)) !=
-		data.FromBytes(env.ethBack.balanceEth.Bytes()) {
-		t.Logf("%v!=%v", string(account.EthBalance),
-			data.FromBytes(env.ethBack.balanceEth.Bytes()))
-		t.Fatal("wrong eth balance")
+	if account.LastBalanceCheck == nil {
+		t.Fatal("last balance check time is not set")
 	}
 
 	testCommonErrors(t, worker, *fixture.job)
 }
+
+func TestPreAccountSetNetworkFee(t *testing.T) {
+	env := newWorkerTest(t)
+	fixture := env.newTestFixture(t, data.JobPreAccountSetNetworkFee,
+		data.JobAccount)
+	defer env.close()
+	defer fixture.close()
+
+	var fee uint32 = 5
+
+	fixture.setJobData(t, &data.JobNetworkFeeData{NetworkFee: fee})
+
+	env.ethBack.balanceEth = big.NewInt(999999999)
+	if err := env.worker.PreAccountSetNetworkFee(fixture.job); err == nil {
+		t.Fatal("network fee is set by not a contract owner")
+	}
+
+	agentAddr := data.TestToAddress(t, fixture.Account.EthAddr)
+	env.ethBack.owner = agentAddr
+
+	runJob(t, env.worker.PreAccountSetNetworkFee, fixture.job)
+
+	env.ethBack.testCalled(t, "PSCSetNetworkFee", agentAddr,
+		env.gasConf.PSC.SetNetworkFee, fee)
+
+	// Test eth transaction was recorded.
+	env.deleteEthTx(t, fixture.job.ID)
+
+	testCommonErrors(t, env.worker.PreAccountSetNetworkFee, *fixture.job)
+}
+
+func TestAccountUpdateNetworkFee(t *testing.T) {
+	env := newWorkerTest(t)
+	fixture := env.newTestFixture(t, data.JobAccountUpdateNetworkFee,
+		data.JobAccount)
+	defer env.close()
+	defer fixture.close()
+
+	// The setting is inserted first and updated then.
+	for _, fee := range []uint32{5, 7} {
+		env.ethBack.networkFee = fee
+
+		runJob(t, env.worker.AccountUpdateNetworkFee, fixture.job)
+
+		setting := &data.Setting{}
+		env.findTo(t, setting, data.SettingNetworkFee)
+		if setting.Value != fmt.Sprint(fee) {
+			t.Fatalf("wrong network fee setting: %s", setting.Value)
+		}
+	}
+
+	env.deleteFromTestDB(t, &data.Setting{Key: data.SettingNetworkFee})
+
+	testCommonErrors(t, env.worker.AccountUpdateNetworkFee, *fixture.job)
+}
@@ -4,5 +4,7 @@ import "errors"
 
 // Errors returned by workers.
 var (
-	ErrInvalidJob = errors.New("unexpected job type or job related type")
+	ErrInvalidJob     = errors.New("unexpected job type or job related type")
+	ErrTxNotPending   = errors.New("transaction is not pending")
+	ErrGasPriceTooLow = errors.New("gas price is too low to replace transaction")
 )
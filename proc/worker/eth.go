@@ -3,8 +3,10 @@ package worker
 import (
 	"context"
 	"fmt"
+	"math/big"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 )
@@ -25,3 +27,26 @@ func (w *Worker) getTransaction(hash common.Hash) (*types.Transaction, error) {
 
 	return ethTx, nil
 }
+
+// sendEth signs and sends a plain ether transfer using given transaction
+// options.
+func (w *Worker) sendEth(auth *bind.TransactOpts, to common.Address,
+	value *big.Int) (*types.Transaction, error) {
+	tx := types.NewTransaction(auth.Nonce.Uint64(), to, value,
+		auth.GasLimit, auth.GasPrice, nil)
+
+	signedTx, err := auth.Signer(types.HomesteadSigner{}, auth.From, tx)
+	if err != nil {
+		return nil, fmt.Errorf("could not sign tx: %v", err)
+	}
+
+	// TODO: move timeout to conf
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if err := w.ethBack.SendTransaction(ctx, signedTx); err != nil {
+		return nil, fmt.Errorf("could not send tx: %v", err)
+	}
+
+	return signedTx, nil
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// estimateGas returns a gas limit for a contract call. The node estimate is
+// increased by a configured margin and capped by a given upper bound, which
+// is also passed to the node, so that calls requiring more gas fail early.
+func (w *Worker) estimateGas(from, contractAddr common.Address,
+	contractABI abi.ABI, limit uint64, method string,
+	args ...interface{}) (uint64, error) {
+	input, err := contractABI.Pack(method, args...)
+	if err != nil {
+		return 0, fmt.Errorf("could not pack %s call: %v", method, err)
+	}
+
+	return w.estimateCallGas(ethereum.CallMsg{
+		From: from,
+		To:   &contractAddr,
+		Gas:  limit,
+		Data: input,
+	}, method)
+}
+
+// estimateTransferGas returns a gas limit for an ether transfer, which may
+// cost more than a plain transfer if a recipient is a contract.
+func (w *Worker) estimateTransferGas(from, to common.Address,
+	value *big.Int, limit uint64) (uint64, error) {
+	return w.estimateCallGas(ethereum.CallMsg{
+		From:  from,
+		To:    &to,
+		Gas:   limit,
+		Value: value,
+	}, ethTransferMethod)
+}
+
+func (w *Worker) estimateCallGas(
+	msg ethereum.CallMsg, method string) (uint64, error) {
+	// TODO: move timeout to conf
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	gas, err := w.ethBack.EstimateGas(ctx, msg)
+	if err != nil {
+		return 0, fmt.Errorf("could not estimate gas of %s: %v",
+			method, err)
+	}
+
+	gas += gas * w.gasConf.EstimateMargin / 100
+	if msg.Gas != 0 && gas > msg.Gas {
+		gas = msg.Gas
+	}
+
+	return gas, nil
+}
@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestEstimateGas(t *testing.T) {
+	env := newWorkerTest(t)
+	defer env.close()
+
+	margin := env.gasConf.EstimateMargin
+	defer func() { env.gasConf.EstimateMargin = margin }()
+	env.gasConf.EstimateMargin = 20
+
+	cases := []struct {
+		estimate uint64
+		limit    uint64
+		expected uint64
+	}{
+		{1000, 2000, 1200},
+		{1000, 1100, 1100},
+		{1000, 0, 1200},
+	}
+
+	for _, c := range cases {
+		env.ethBack.gasEstimate = c.estimate
+		gas, err := env.worker.estimateGas(conf.pscAddr, conf.pscAddr,
+			env.worker.abi, c.limit, "addBalanceERC20", big.NewInt(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gas != c.expected {
+			t.Fatalf("wrong gas limit for %+v: %d", c, gas)
+		}
+	}
+
+	if _, err := env.worker.estimateGas(conf.pscAddr, conf.pscAddr,
+		env.worker.abi, 0, "unknownMethod"); err == nil {
+		t.Fatal("unknown method call estimated")
+	}
+}
@@ -2,7 +2,6 @@ package worker
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
 	"math/big"
@@ -16,13 +15,10 @@ import (
 
 	"github.com/privatix/dappctrl/data"
 	ethutil "github.com/privatix/dappctrl/eth/util"
+	"github.com/privatix/dappctrl/proc/state"
 	"github.com/privatix/dappctrl/util"
 )
 
-func (w *Worker) key(key string) (*ecdsa.PrivateKey, error) {
-	return w.decryptKeyFunc(key, w.pwdGetter.Get())
-}
-
 func (w *Worker) toHashArr(h string) (ret [common.HashLength]byte, err error) {
 	var hash common.Hash
 	hash, err = data.ToHash(h)
@@ -42,6 +38,31 @@ func (w *Worker) balanceData(job *data.Job) (*data.JobBalanceData, error) {
 	return balanceData, nil
 }
 
+func (w *Worker) withdrawData(job *data.Job) (*data.JobWithdrawData, error) {
+	withdrawData := &data.JobWithdrawData{}
+	if err := w.unmarshalDataTo(job.Data, withdrawData); err != nil {
+		return nil, err
+	}
+	return withdrawData, nil
+}
+
+func (w *Worker) networkFeeData(
+	job *data.Job) (*data.JobNetworkFeeData, error) {
+	networkFeeData := &data.JobNetworkFeeData{}
+	if err := w.unmarshalDataTo(job.Data, networkFeeData); err != nil {
+		return nil, err
+	}
+	return networkFeeData, nil
+}
+
+func (w *Worker) closeData(job *data.Job) (*data.JobCloseData, error) {
+	closeData := &data.JobCloseData{}
+	if err := w.unmarshalDataTo(job.Data, closeData); err != nil {
+		return nil, err
+	}
+	return closeData, nil
+}
+
 func (w *Worker) publishData(job *data.Job) (*data.JobPublishData, error) {
 	publishData := &data.JobPublishData{}
 	if err := w.unmarshalDataTo(job.Data, publishData); err != nil {
@@ -107,21 +128,24 @@ func (w *Worker) updateAccountBalances(acc *data.Account) error {
 		return fmt.Errorf("could not get ptc balance: %v", err)
 	}
 
-	acc.PTCBalance = amount.Uint64()
+	acc.PTCBalance = data.NewAmountFromBig(amount)
 
 	amount, err = w.ethBack.PSCBalanceOf(&bind.CallOpts{}, agentAddr)
 	if err != nil {
 		return fmt.Errorf("could not get psc balance: %v", err)
 	}
 
-	acc.PSCBalance = amount.Uint64()
+	acc.PSCBalance = data.NewAmountFromBig(amount)
 
 	amount, err = w.ethBalance(agentAddr)
 	if err != nil {
 		return err
 	}
 
-	acc.EthBalance = data.B64BigInt(data.FromBytes(amount.Bytes()))
+	acc.EthBalance = data.NewAmountFromBig(amount)
+
+	now := time.Now()
+	acc.LastBalanceCheck = &now
 
 	return w.db.Update(acc)
 }
@@ -139,6 +163,50 @@ func (w *Worker) ethBalance(addr common.Address) (*big.Int, error) {
 	return amount, nil
 }
 
+// updateChannelStatus changes statuses of a channel, if the transition is
+// legal, and records it as caused by a given job.
+func (w *Worker) updateChannelStatus(job *data.Job, ch *data.Channel,
+	channelStatus, serviceStatus string) error {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+
+	if err := state.Update(tx, ch, channelStatus, serviceStatus,
+		job.CreatedBy, &job.ID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("could not update channel status: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("unable to commit changes: %v", err)
+	}
+
+	return nil
+}
+
+// gasCost returns a price of a given amount of gas in wei.
+func gasCost(gas, gasPrice uint64) *big.Int {
+	cost := new(big.Int).SetUint64(gas)
+	return cost.Mul(cost, new(big.Int).SetUint64(gasPrice))
+}
+
+// gasPrice returns a given gas price or a recommended one if it is zero.
+func (w *Worker) gasPrice(price uint64) (uint64, error) {
+	if price != 0 {
+		return price, nil
+	}
+
+	price, err := w.gasOracle.GasPrice()
+	if err != nil {
+		return 0, fmt.Errorf("could not get recommended gas price: %v",
+			err)
+	}
+
+	return price, nil
+}
+
 func (w *Worker) saveEthTX(job *data.Job, tx *types.Transaction,
 	method, relatedType, relatedID, from, to string) error {
 	raw, err := tx.MarshalJSON()
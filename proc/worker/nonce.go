@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// accountNonce is a nonce state of a single account.
+type accountNonce struct {
+	mtx    sync.Mutex
+	synced bool
+	next   uint64
+}
+
+// nonceManager hands out transaction nonces per account. Nonces are not
+// known after startup and become invalid after send errors, in both cases
+// they are resynced from the pending nonce of the eth node.
+type nonceManager struct {
+	ethBack EthBackend
+
+	mtx      sync.Mutex
+	accounts map[common.Address]*accountNonce
+}
+
+func newNonceManager(ethBack EthBackend) *nonceManager {
+	return &nonceManager{
+		ethBack:  ethBack,
+		accounts: make(map[common.Address]*accountNonce),
+	}
+}
+
+func (m *nonceManager) account(addr common.Address) *accountNonce {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	acc, ok := m.accounts[addr]
+	if !ok {
+		acc = &accountNonce{}
+		m.accounts[addr] = acc
+	}
+	return acc
+}
+
+// send sets the next nonce of the sender to the transaction options and calls
+// a given send function. Sends from the same account are serialized, so that
+// transactions reach the eth node in the nonce order.
+func (m *nonceManager) send(auth *bind.TransactOpts,
+	send func(*bind.TransactOpts) (*types.Transaction, error)) (
+	*types.Transaction, error) {
+	acc := m.account(auth.From)
+
+	acc.mtx.Lock()
+	defer acc.mtx.Unlock()
+
+	if !acc.synced {
+		next, err := m.sync(auth.From)
+		if err != nil {
+			return nil, err
+		}
+		acc.next = next
+		acc.synced = true
+	}
+
+	auth.Nonce = new(big.Int).SetUint64(acc.next)
+
+	tx, err := send(auth)
+	if err != nil {
+		// The nonce might be consumed or not, so resync it next time.
+		acc.synced = false
+		return nil, err
+	}
+
+	acc.next++
+
+	return tx, nil
+}
+
+// sync returns the next nonce of an account. The pending nonce of the eth
+// node is trusted, as stored transactions might be dropped by the node, and
+// nonces after them would never be mined.
+func (m *nonceManager) sync(addr common.Address) (uint64, error) {
+	// TODO: move timeout to conf
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	next, err := m.ethBack.PendingNonceAt(ctx, addr)
+	if err != nil {
+		return 0, fmt.Errorf("could not get pending nonce: %v", err)
+	}
+
+	return next, nil
+}
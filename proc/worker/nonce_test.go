@@ -0,0 +1,113 @@
+package worker
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/AlekSi/pointer"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/util"
+)
+
+var testNonceAddr = common.HexToAddress("0x2")
+
+func nonceSend(m *nonceManager, sendErr error) (uint64, error) {
+	var nonce uint64
+	_, err := m.send(&bind.TransactOpts{From: testNonceAddr}, func(
+		auth *bind.TransactOpts) (*types.Transaction, error) {
+		nonce = auth.Nonce.Uint64()
+		if sendErr != nil {
+			return nil, sendErr
+		}
+		return types.NewTransaction(nonce, common.Address{},
+			big.NewInt(1), 1, big.NewInt(1), nil), nil
+	})
+	return nonce, err
+}
+
+func testNonceSend(t *testing.T, m *nonceManager, sendErr error) uint64 {
+	nonce, err := nonceSend(m, sendErr)
+	if err != sendErr {
+		t.Fatalf("unexpected send error: %v", err)
+	}
+	return nonce
+}
+
+func TestNonceConcurrentSend(t *testing.T) {
+	const sends = 20
+
+	ethBack := newTestEthBackend(conf.pscAddr)
+	ethBack.nonce = 5
+	m := newNonceManager(ethBack)
+
+	var wg sync.WaitGroup
+	nonces := make(chan uint64, sends)
+	errs := make(chan error, sends)
+	for i := 0; i < sends; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nonce, err := nonceSend(m, nil)
+			nonces <- nonce
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(nonces)
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := make(map[uint64]bool)
+	for nonce := range nonces {
+		if seen[nonce] || nonce < ethBack.nonce ||
+			nonce >= ethBack.nonce+sends {
+			t.Fatalf("unexpected nonce %d", nonce)
+		}
+		seen[nonce] = true
+	}
+}
+
+func TestNonceResync(t *testing.T) {
+	ethBack := newTestEthBackend(conf.pscAddr)
+	ethBack.nonce = 3
+	m := newNonceManager(ethBack)
+
+	if nonce := testNonceSend(t, m, nil); nonce != 3 {
+		t.Fatalf("wrong initial nonce: %d", nonce)
+	}
+
+	// Pending nonce is not requested until a send error.
+	ethBack.nonce = 10
+	if nonce := testNonceSend(t, m, nil); nonce != 4 {
+		t.Fatalf("wrong next nonce: %d", nonce)
+	}
+
+	testNonceSend(t, m, errors.New("some error"))
+	if nonce := testNonceSend(t, m, nil); nonce != 10 {
+		t.Fatalf("nonce is not resynced after error: %d", nonce)
+	}
+
+	// Stored transactions might be dropped by the node, so they don't
+	// leave gaps in nonces.
+	tx := data.NewTestEthTx(data.JobAccount, util.NewUUID())
+	tx.AddrFrom = data.FromBytes(testNonceAddr.Bytes())
+	tx.Nonce = pointer.ToString("20")
+	data.InsertToTestDB(t, db, tx)
+	defer data.DeleteFromTestDB(t, db, tx)
+
+	m = newNonceManager(ethBack)
+	if nonce := testNonceSend(t, m, nil); nonce != 10 {
+		t.Fatalf("nonce is not synced with the node: %d", nonce)
+	}
+}
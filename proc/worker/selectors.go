@@ -47,6 +47,12 @@ func (w *Worker) relatedAccount(job *data.Job, jobType string) (*data.Account, e
 	return rec, err
 }
 
+func (w *Worker) relatedTransaction(job *data.Job, jobType string) (*data.EthTx, error) {
+	rec := &data.EthTx{}
+	err := w.relatedAndValidate(rec, job, jobType, data.JobTransaction)
+	return rec, err
+}
+
 func (w *Worker) ethLog(job *data.Job) (*data.EthLog, error) {
 	log := &data.EthLog{}
 	err := w.db.FindOneTo(log, "job", job.ID)
@@ -0,0 +1,160 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/AlekSi/pointer"
+	"github.com/ethereum/go-ethereum/core/types"
+	"gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/signer"
+	"github.com/privatix/dappctrl/util"
+)
+
+const (
+	// Gas limit of a plain ether transfer.
+	transferGas = 21000
+
+	// Minimal gas price increase (in percents) for a node to accept
+	// a transaction replacement.
+	replaceGasPriceBump = 10
+
+	cancelMethod      = "cancel"
+	ethTransferMethod = "transfer"
+)
+
+// SpeedUpTransaction re-sends a pending transaction with the same nonce and
+// payload, but with a higher gas price.
+func (w *Worker) SpeedUpTransaction(job *data.Job) error {
+	return w.replaceTransaction(job, data.JobSpeedUpTransaction)
+}
+
+// CancelTransaction replaces a pending transaction with a zero-value
+// transfer to its sender.
+func (w *Worker) CancelTransaction(job *data.Job) error {
+	return w.replaceTransaction(job, data.JobCancelTransaction)
+}
+
+func (w *Worker) replaceTransaction(job *data.Job, jobType string) error {
+	ethTx, err := w.relatedTransaction(job, jobType)
+	if err != nil {
+		return err
+	}
+
+	if ethTx.Status != data.TxSent {
+		return ErrTxNotPending
+	}
+
+	jdata := &data.JobReplaceTxData{}
+	if err := w.unmarshalDataTo(job.Data, jdata); err != nil {
+		return err
+	}
+
+	orig := &types.Transaction{}
+	if err := orig.UnmarshalJSON(ethTx.TxRaw); err != nil {
+		return fmt.Errorf("could not unmarshal raw tx: %v", err)
+	}
+
+	minGasPrice := new(big.Int).Mul(orig.GasPrice(),
+		big.NewInt(100+replaceGasPriceBump))
+	minGasPrice.Div(minGasPrice, big.NewInt(100))
+
+	gasPrice := new(big.Int).SetUint64(jdata.GasPrice)
+	if jdata.GasPrice == 0 {
+		// Use a recommended price if it is higher than the minimal one.
+		recommended, err := w.gasPrice(0)
+		if err != nil {
+			return err
+		}
+		gasPrice.SetUint64(recommended)
+		if gasPrice.Cmp(minGasPrice) < 0 {
+			gasPrice = minGasPrice
+		}
+	} else if gasPrice.Cmp(minGasPrice) < 0 {
+		return ErrGasPriceTooLow
+	}
+
+	acc := &data.Account{}
+	if err := w.db.FindOneTo(acc, "eth_addr", ethTx.AddrFrom); err != nil {
+		return fmt.Errorf("could not find tx sender account: %v", err)
+	}
+
+	addr, err := data.ToAddress(acc.EthAddr)
+	if err != nil {
+		return fmt.Errorf("unable to parse account's addr: %v", err)
+	}
+
+	auth := signer.Transactor(w.signer, addr)
+
+	replacement := &data.EthTx{
+		ID:          util.NewUUID(),
+		Method:      ethTx.Method,
+		Status:      data.TxSent,
+		JobID:       ethTx.JobID,
+		AddrFrom:    ethTx.AddrFrom,
+		AddrTo:      ethTx.AddrTo,
+		RelatedType: ethTx.RelatedType,
+		RelatedID:   ethTx.RelatedID,
+	}
+
+	var tx *types.Transaction
+	if jobType == data.JobCancelTransaction {
+		tx = types.NewTransaction(orig.Nonce(), auth.From,
+			big.NewInt(0), transferGas, gasPrice, nil)
+		replacement.Method = cancelMethod
+		replacement.JobID = pointer.ToString(job.ID)
+		replacement.AddrTo = acc.EthAddr
+	} else if orig.To() == nil {
+		tx = types.NewContractCreation(orig.Nonce(), orig.Value(),
+			orig.Gas(), gasPrice, orig.Data())
+	} else {
+		tx = types.NewTransaction(orig.Nonce(), *orig.To(),
+			orig.Value(), orig.Gas(), gasPrice, orig.Data())
+	}
+
+	signedTx, err := auth.Signer(types.HomesteadSigner{}, auth.From, tx)
+	if err != nil {
+		return fmt.Errorf("could not sign replacement tx: %v", err)
+	}
+
+	// TODO: move timeout to conf
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	if err := w.ethBack.SendTransaction(ctx, signedTx); err != nil {
+		return fmt.Errorf("could not send replacement tx: %v", err)
+	}
+
+	return w.saveReplacementTX(ethTx, replacement, signedTx)
+}
+
+// saveReplacementTX records a sent replacement transaction and links the
+// replaced one to it.
+func (w *Worker) saveReplacementTX(replaced, replacement *data.EthTx,
+	tx *types.Transaction) error {
+	raw, err := tx.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	replacement.Hash = data.FromBytes(tx.Hash().Bytes())
+	replacement.Issued = time.Now()
+	replacement.Nonce = pointer.ToString(fmt.Sprint(tx.Nonce()))
+	replacement.GasPrice = tx.GasPrice().Uint64()
+	replacement.Gas = tx.Gas()
+	replacement.TxRaw = raw
+
+	return w.db.InTransaction(func(dbtx *reform.TX) error {
+		if err := dbtx.Insert(replacement); err != nil {
+			return err
+		}
+
+		replaced.Status = data.TxReplaced
+		replaced.ReplacedBy = pointer.ToString(replacement.ID)
+		return dbtx.Update(replaced)
+	})
+}
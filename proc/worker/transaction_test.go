@@ -0,0 +1,133 @@
+package worker
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/privatix/dappctrl/data"
+)
+
+const testTxNonce = 7
+
+func newTestReplacedTx(t *testing.T, env *workerTest,
+	fixture *workerTestFixture, gasPrice int64) (*data.EthTx, *data.Job) {
+	tx := types.NewTransaction(testTxNonce, conf.pscAddr, big.NewInt(0),
+		env.gasConf.PSC.AddBalanceERC20, big.NewInt(gasPrice), []byte{1})
+	raw, err := tx.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := data.NewTestJob(data.JobPreAccountAddBalance,
+		data.JobUser, data.JobAccount)
+	job.RelatedID = fixture.Account.ID
+	job.Status = data.JobDone
+	env.insertToTestDB(t, job)
+
+	ethTx := data.NewTestEthTx(data.JobAccount, fixture.Account.ID)
+	ethTx.JobID = &job.ID
+	ethTx.AddrFrom = fixture.Account.EthAddr
+	ethTx.AddrTo = data.FromBytes(conf.pscAddr.Bytes())
+	ethTx.GasPrice = uint64(gasPrice)
+	ethTx.TxRaw = raw
+	env.insertToTestDB(t, ethTx)
+
+	fixture.job.RelatedID = ethTx.ID
+	fixture.job.RelatedType = data.JobTransaction
+	env.updateInTestDB(t, fixture.job)
+
+	return ethTx, job
+}
+
+func testReplacement(t *testing.T, env *workerTest, replaced *data.EthTx,
+	gasPrice uint64) (*data.EthTx, *types.Transaction) {
+	if len(env.ethBack.callStack) != 1 ||
+		env.ethBack.callStack[0].method != "SendTransaction" {
+		t.Fatalf("SendTransaction not called: %+v", env.ethBack.callStack)
+	}
+	tx := env.ethBack.callStack[0].args[0].(*types.Transaction)
+
+	if tx.Nonce() != testTxNonce || tx.GasPrice().Uint64() != gasPrice {
+		t.Fatal("wrong nonce or gas price of replacement tx")
+	}
+
+	env.findTo(t, replaced, replaced.ID)
+	if replaced.Status != data.TxReplaced || replaced.ReplacedBy == nil {
+		t.Fatal("replaced tx is not updated")
+	}
+
+	replacement := &data.EthTx{}
+	env.findTo(t, replacement, *replaced.ReplacedBy)
+	if replacement.Hash != data.FromBytes(tx.Hash().Bytes()) ||
+		replacement.Status != data.TxSent ||
+		replacement.RelatedID != replaced.RelatedID {
+		t.Fatal("wrong replacement tx saved")
+	}
+
+	return replacement, tx
+}
+
+func TestSpeedUpTransaction(t *testing.T) {
+	env := newWorkerTest(t)
+	fixture := env.newTestFixture(t, data.JobSpeedUpTransaction,
+		data.JobAccount)
+	defer env.close()
+	defer fixture.close()
+
+	ethTx, job := newTestReplacedTx(t, env, fixture, 100)
+	defer env.deleteFromTestDB(t, job)
+
+	fixture.setJobData(t, &data.JobReplaceTxData{GasPrice: 105})
+	if err := env.worker.SpeedUpTransaction(
+		fixture.job); err != ErrGasPriceTooLow {
+		t.Fatal("low gas price not validated: ", err)
+	}
+
+	fixture.setJobData(t, &data.JobReplaceTxData{GasPrice: 200})
+	runJob(t, env.worker.SpeedUpTransaction, fixture.job)
+
+	replacement, tx := testReplacement(t, env, ethTx, 200)
+	defer env.deleteFromTestDB(t, ethTx, replacement)
+
+	if *tx.To() != conf.pscAddr || tx.Data()[0] != 1 ||
+		replacement.JobID == nil || *replacement.JobID != *ethTx.JobID {
+		t.Fatal("replacement tx does not repeat the original one")
+	}
+
+	if err := env.worker.SpeedUpTransaction(
+		fixture.job); err != ErrTxNotPending {
+		t.Fatal("replaced tx speeded up again: ", err)
+	}
+
+	testCommonErrors(t, env.worker.SpeedUpTransaction, *fixture.job)
+}
+
+func TestCancelTransaction(t *testing.T) {
+	env := newWorkerTest(t)
+	fixture := env.newTestFixture(t, data.JobCancelTransaction,
+		data.JobAccount)
+	defer env.close()
+	defer fixture.close()
+
+	ethTx, job := newTestReplacedTx(t, env, fixture, 100)
+	defer env.deleteFromTestDB(t, job)
+
+	// Zero gas price means minimal acceptable one, unless a recommended
+	// price is higher.
+	env.gasOracle.price = 120
+	runJob(t, env.worker.CancelTransaction, fixture.job)
+
+	replacement, tx := testReplacement(t, env, ethTx, 120)
+	defer env.deleteFromTestDB(t, ethTx, replacement)
+
+	agentAddr := data.TestToAddress(t, fixture.Account.EthAddr)
+	if *tx.To() != agentAddr || tx.Value().Sign() != 0 ||
+		len(tx.Data()) != 0 || replacement.Method != cancelMethod ||
+		*replacement.JobID != fixture.job.ID {
+		t.Fatal("replacement tx is not a cancellation")
+	}
+
+	testCommonErrors(t, env.worker.CancelTransaction, *fixture.job)
+}
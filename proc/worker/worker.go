@@ -7,17 +7,25 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	reform "gopkg.in/reform.v1"
 
-	"github.com/privatix/dappctrl/data"
 	"github.com/privatix/dappctrl/eth/contract"
 	"github.com/privatix/dappctrl/job"
 	"github.com/privatix/dappctrl/messages/ept"
+	"github.com/privatix/dappctrl/pay"
+	"github.com/privatix/dappctrl/signer"
 	"github.com/privatix/dappctrl/somc"
 )
 
-// GasConf amounts of gas limit to use for contracts calls.
+// GasConf amounts of gas limit to use for contracts calls. Gas limits are
+// estimated by the eth node, these amounts are used as upper bounds.
 type GasConf struct {
+	EstimateMargin uint64 // In percent of an estimate.
+
+	ETH struct {
+		Transfer uint64
+	}
 	PTC struct {
-		Approve uint64
+		Approve  uint64
+		Transfer uint64
 	}
 	PSC struct {
 		AddBalanceERC20                uint64
@@ -38,26 +46,46 @@ type GasConf struct {
 	}
 }
 
+// GasPriceOracle recommends gas prices for transactions.
+type GasPriceOracle interface {
+	GasPrice() (uint64, error)
+}
+
+type requestCloseFunc func(db *reform.DB, channel, pscAddr string,
+	s signer.Signer, tls bool, timeout uint) (*pay.CloseSignatures, error)
+
 // Worker has all worker routines.
 type Worker struct {
-	abi            abi.ABI
-	db             *reform.DB
-	decryptKeyFunc data.ToPrivateKeyFunc
-	ept            *ept.Service
-	ethBack        EthBackend
-	gasConf        *GasConf
-	pscAddr        common.Address
-	pwdGetter      data.PWDGetter
-	somc           *somc.Conn
-	queue          *job.Queue
+	abi       abi.ABI
+	ptcABI    abi.ABI
+	db        *reform.DB
+	ept       *ept.Service
+	ethBack   EthBackend
+	gasConf   *GasConf
+	gasOracle GasPriceOracle
+	nonces    *nonceManager
+	pscAddr   common.Address
+	ptcAddr   common.Address
+	signer    signer.Signer
+	somc      *somc.Conn
+	queue     *job.Queue
+
+	requestClose requestCloseFunc // Is overrided in unit-tests.
+	payTLS       bool
+	payTimeout   uint // In milliseconds.
 }
 
 // NewWorker returns new instance of worker.
 func NewWorker(db *reform.DB, somc *somc.Conn,
-	ethBack EthBackend, gasConc *GasConf,
-	pscAddr common.Address,
-	payAddr string, pwdGetter data.PWDGetter,
-	decryptKeyFunc data.ToPrivateKeyFunc) (*Worker, error) {
+	ethBack EthBackend, gasConc *GasConf, gasOracle GasPriceOracle,
+	pscAddr, ptcAddr common.Address,
+	payAddr string, signer signer.Signer) (*Worker, error) {
+
+	ptcABI, err := abi.JSON(
+		strings.NewReader(contract.PrivatixTokenContractABI))
+	if err != nil {
+		return nil, err
+	}
 
 	abi, err := abi.JSON(strings.NewReader(contract.PrivatixServiceContractABI))
 	if err != nil {
@@ -70,18 +98,29 @@ func NewWorker(db *reform.DB, somc *somc.Conn,
 	}
 
 	return &Worker{
-		abi:            abi,
-		db:             db,
-		decryptKeyFunc: decryptKeyFunc,
-		gasConf:        gasConc,
-		ept:            eptService,
-		ethBack:        ethBack,
-		pscAddr:        pscAddr,
-		pwdGetter:      pwdGetter,
-		somc:           somc,
+		abi:       abi,
+		ptcABI:    ptcABI,
+		db:        db,
+		gasConf:   gasConc,
+		gasOracle: gasOracle,
+		ept:       eptService,
+		ethBack:   ethBack,
+		nonces:    newNonceManager(ethBack),
+		pscAddr:   pscAddr,
+		ptcAddr:   ptcAddr,
+		signer:    signer,
+		somc:      somc,
+
+		requestClose: pay.RequestCloseSignatures,
 	}, nil
 }
 
+// SetPayClient sets parameters of requests to payment servers of agents.
+func (h *Worker) SetPayClient(tls bool, timeout uint) {
+	h.payTLS = tls
+	h.payTimeout = timeout
+}
+
 // SetQueue sets queue for handlers.
 func (h *Worker) SetQueue(queue *job.Queue) {
 	h.queue = queue
@@ -20,6 +20,7 @@ import (
 	"github.com/privatix/dappctrl/messages"
 	"github.com/privatix/dappctrl/messages/offer"
 	"github.com/privatix/dappctrl/pay"
+	"github.com/privatix/dappctrl/signer"
 	"github.com/privatix/dappctrl/somc"
 	"github.com/privatix/dappctrl/util"
 )
@@ -36,6 +37,7 @@ type testConfig struct {
 	SOMC      *somc.Config
 	SOMCTest  *somc.TestConfig
 	pscAddr   common.Address
+	ptcAddr   common.Address
 }
 
 func newTestConfig() *testConfig {
@@ -46,16 +48,26 @@ func newTestConfig() *testConfig {
 		SOMC:     somc.NewConfig(),
 		SOMCTest: somc.NewTestConfig(),
 		pscAddr:  common.HexToAddress("0x1"),
+		ptcAddr:  common.HexToAddress("0x3"),
 	}
 }
 
+type testGasOracle struct {
+	price uint64
+}
+
+func (o *testGasOracle) GasPrice() (uint64, error) {
+	return o.price, nil
+}
+
 type workerTest struct {
-	db       *reform.DB
-	ethBack  *testEthBackend
-	fakeSOMC *somc.FakeSOMC
-	somcConn *somc.Conn
-	worker   *Worker
-	gasConf  *GasConf
+	db        *reform.DB
+	ethBack   *testEthBackend
+	fakeSOMC  *somc.FakeSOMC
+	somcConn  *somc.Conn
+	worker    *Worker
+	gasConf   *GasConf
+	gasOracle *testGasOracle
 }
 
 var (
@@ -78,12 +90,14 @@ func newWorkerTest(t *testing.T) *workerTest {
 
 	ethBack := newTestEthBackend(conf.pscAddr)
 
+	gasOracle := &testGasOracle{price: 5}
+
 	pwdStorage := new(data.PWDStorage)
 	pwdStorage.Set(data.TestPassword)
 
-	worker, err := NewWorker(db, somcConn, ethBack, conf.Gas,
-		conf.pscAddr, conf.PayServer.Addr,
-		pwdStorage, data.TestToPrivateKey)
+	worker, err := NewWorker(db, somcConn, ethBack, conf.Gas, gasOracle,
+		conf.pscAddr, conf.ptcAddr, conf.PayServer.Addr,
+		signer.NewDBSigner(db, pwdStorage, data.TestToPrivateKey))
 	if err != nil {
 		fakeSOMC.Close()
 		somcConn.Close()
@@ -92,12 +106,13 @@ func newWorkerTest(t *testing.T) *workerTest {
 	worker.SetQueue(jobQueue)
 
 	return &workerTest{
-		db:       db,
-		ethBack:  ethBack,
-		fakeSOMC: fakeSOMC,
-		somcConn: somcConn,
-		worker:   worker,
-		gasConf:  conf.Gas,
+		db:        db,
+		ethBack:   ethBack,
+		fakeSOMC:  fakeSOMC,
+		somcConn:  somcConn,
+		worker:    worker,
+		gasConf:   conf.Gas,
+		gasOracle: gasOracle,
 	}
 }
 
@@ -208,10 +223,8 @@ func (e *workerTest) setOfferingHash(t *testing.T, fixture *workerTestFixture) {
 		fixture.Offering)
 	msgBytes, _ := json.Marshal(msg)
 
-	agentKey, _ := e.worker.decryptKeyFunc(fixture.Account.PrivateKey,
-		data.TestPassword)
-
-	packed, _ := messages.PackWithSignature(msgBytes, agentKey)
+	packed, _ := messages.PackWithSignature(msgBytes, e.worker.signer,
+		data.TestToAddress(t, fixture.Account.EthAddr))
 
 	fixture.Offering.RawMsg = data.FromBytes(packed)
 	fixture.Offering.Hash = data.FromBytes(ethcrypto.Keccak256(packed))
@@ -37,6 +37,17 @@ func (s *Server) updateProduct(
 	return true
 }
 
+func (s *Server) findOffering(
+	w http.ResponseWriter, id string) (*data.Offering, bool) {
+	var offer data.Offering
+	if err := s.db.FindByPrimaryKeyTo(&offer, id); err != nil {
+		s.Logger().Error("failed to find offering: %s", err)
+		s.RespondError(w, srv.ErrInternalServerError)
+		return nil, false
+	}
+	return &offer, true
+}
+
 func (s *Server) identClient(w http.ResponseWriter,
 	productID, clientID string) (*data.Channel, bool) {
 	prod, ok := s.findProduct(w, productID)
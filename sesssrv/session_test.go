@@ -167,3 +167,64 @@ func testUpdateStopNormalFlow(fxt *data.TestFixture, sess *data.Session, stop bo
 		data.SaveToTestDB(fxt.T, db, sess)
 	}
 }
+
+func TestSecondsConsumed(t *testing.T) {
+	fxt := newTestFixtures(t)
+	defer fxt.Close()
+
+	sess := testStartNormalFlow(fxt)
+	defer db.Delete(sess)
+
+	update := func(path string, gap time.Duration) {
+		sess.LastUsageTime = time.Now().Add(-gap)
+		data.SaveToTestDB(t, db, sess)
+
+		args := UpdateArgs{ClientID: fxt.Channel.ID}
+		err := Post(conf.SessionServer.Config, fxt.Product.ID,
+			data.TestPassword, path, args, nil)
+		util.TestExpectResult(t, "Post", nil, err)
+
+		data.ReloadFromTestDB(t, db, sess)
+	}
+
+	// Seconds are added to already consumed ones.
+	update(PathUpdate, 10*time.Second)
+	update(PathUpdate, 10*time.Second)
+	if sess.SecondsConsumed < 20 || sess.SecondsConsumed > 22 {
+		t.Fatalf("wrong seconds consumed: %d", sess.SecondsConsumed)
+	}
+
+	// Too long gaps are counted up to the max inactive time.
+	consumed := sess.SecondsConsumed
+	maxInactive := uint64(5)
+	fxt.Offering.MaxInactiveTimeSec = &maxInactive
+	data.SaveToTestDB(t, db, fxt.Offering)
+
+	update(PathStop, 10*time.Second)
+	if sess.SecondsConsumed != consumed+maxInactive || sess.Stopped == nil {
+		t.Fatalf("wrong seconds consumed after gap: %d",
+			sess.SecondsConsumed)
+	}
+}
+
+func TestUsedSeconds(t *testing.T) {
+	maxInactive := uint64(60)
+	offer := &data.Offering{MaxInactiveTimeSec: &maxInactive}
+
+	last := time.Unix(1000, 900000000)
+	for _, v := range []struct {
+		now  time.Time
+		secs uint64
+	}{
+		{last.Add(-time.Second), 0},
+		{time.Unix(1000, 950000000), 0},
+		// Fraction of the previous second is counted here.
+		{time.Unix(1001, 100000000), 1},
+		{time.Unix(1060, 0), 60},
+		{time.Unix(1061, 0), 60},
+	} {
+		if secs := usedSeconds(offer, last, v.now); secs != v.secs {
+			t.Fatalf("wrong seconds used till %v: %d", v.now, secs)
+		}
+	}
+}
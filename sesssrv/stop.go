@@ -22,7 +22,7 @@ func (s *Server) handleUpdateStop(
 		return
 	}
 
-	_, ok := s.identClient(w, ctx.Username, args.ClientID)
+	ch, ok := s.identClient(w, ctx.Username, args.ClientID)
 	if !ok {
 		return
 	}
@@ -32,6 +32,11 @@ func (s *Server) handleUpdateStop(
 		return
 	}
 
+	offer, ok := s.findOffering(w, ch.Offering)
+	if !ok {
+		return
+	}
+
 	if args.Units != 0 {
 		prod, ok := s.findProduct(w, ctx.Username)
 		if !ok {
@@ -48,7 +53,9 @@ func (s *Server) handleUpdateStop(
 		}
 	}
 
-	sess.LastUsageTime = time.Now()
+	now := time.Now()
+	sess.SecondsConsumed += usedSeconds(offer, sess.LastUsageTime, now)
+	sess.LastUsageTime = now
 	if stop {
 		sess.Stopped = pointer.ToTime(sess.LastUsageTime)
 	}
@@ -56,11 +63,30 @@ func (s *Server) handleUpdateStop(
 	if err := s.db.Save(sess); err != nil {
 		s.Logger().Error("failed to save session: %s", err)
 		s.RespondError(w, srv.ErrInternalServerError)
+		return
 	}
 
 	s.RespondResult(w, nil)
 }
 
+// usedSeconds returns a number of seconds used since the last usage time.
+// A client is considered connected for no longer than the max inactive time
+// after an update, so longer gaps are credited up to that time. Whole
+// seconds of times are subtracted, so that fractions of seconds are not lost
+// between updates.
+func usedSeconds(offer *data.Offering, last, now time.Time) uint64 {
+	if !now.After(last) {
+		return 0
+	}
+
+	secs := uint64(now.Unix() - last.Unix())
+	if offer.MaxInactiveTimeSec != nil && secs > *offer.MaxInactiveTimeSec {
+		return *offer.MaxInactiveTimeSec
+	}
+
+	return secs
+}
+
 // UpdateArgs is a set of arguments for session usage update.
 type UpdateArgs = updateStopArgs
 
@@ -0,0 +1,46 @@
+package signer
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	reform "gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/data"
+)
+
+// DBSigner signs with private keys stored encrypted in accounts table.
+type DBSigner struct {
+	db      *reform.DB
+	pwd     data.PWDGetter
+	decrypt data.ToPrivateKeyFunc
+}
+
+// NewDBSigner creates a new signer for keys stored in accounts table.
+func NewDBSigner(db *reform.DB, pwd data.PWDGetter,
+	decrypt data.ToPrivateKeyFunc) *DBSigner {
+	return &DBSigner{db: db, pwd: pwd, decrypt: decrypt}
+}
+
+// SignHash signs a hash with a key of an account.
+func (s *DBSigner) SignHash(addr common.Address, hash []byte) ([]byte, error) {
+	var acc data.Account
+	if err := s.db.FindOneTo(&acc, "eth_addr",
+		data.FromBytes(addr.Bytes())); err != nil {
+		return nil, fmt.Errorf("could not find account %s: %v",
+			addr.Hex(), err)
+	}
+
+	if acc.PrivateKey == nil {
+		return nil, fmt.Errorf("no stored key of %s", addr.Hex())
+	}
+
+	key, err := s.decrypt(*acc.PrivateKey, s.pwd.Get())
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt key of %s: %v",
+			addr.Hex(), err)
+	}
+
+	return crypto.Sign(hash, key)
+}
@@ -0,0 +1,72 @@
+package signer
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/privatix/dappctrl/data"
+)
+
+// KeystoreSigner signs with private keys from a geth keystore directory, so
+// that keys are not copied to the database. Keys are expected to be
+// encrypted with the same password as the one used for the application.
+type KeystoreSigner struct {
+	ks  *keystore.KeyStore
+	pwd data.PWDGetter
+}
+
+// NewKeystoreSigner creates a new signer for keys in a keystore directory.
+func NewKeystoreSigner(dir string, pwd data.PWDGetter) *KeystoreSigner {
+	return &KeystoreSigner{
+		ks: keystore.NewKeyStore(dir,
+			keystore.StandardScryptN, keystore.StandardScryptP),
+		pwd: pwd,
+	}
+}
+
+// SignHash signs a hash with a key of an account.
+func (s *KeystoreSigner) SignHash(
+	addr common.Address, hash []byte) ([]byte, error) {
+	acc, err := s.ks.Find(accounts.Account{Address: addr})
+	if err != nil {
+		return nil, fmt.Errorf("could not find key of %s: %v",
+			addr.Hex(), err)
+	}
+
+	return s.ks.SignHashWithPassphrase(acc, s.pwd.Get(), hash)
+}
+
+// UpdatePassword encrypts all keys of the keystore with a new password.
+// Already updated keys are restored if any of the keys fails.
+func (s *KeystoreSigner) UpdatePassword(oldPwd, newPwd string) error {
+	accs := s.ks.Accounts()
+	for i, acc := range accs {
+		if err := s.ks.Update(acc, oldPwd, newPwd); err != nil {
+			for _, v := range accs[:i] {
+				s.ks.Update(v, newPwd, oldPwd)
+			}
+			return fmt.Errorf("could not update key of %s: %v",
+				acc.Address.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// keystoreDBSigner signs with keys from a keystore and falls back to keys
+// stored in accounts table, e.g. for accounts imported with raw keys or
+// derived from mnemonics.
+type keystoreDBSigner struct {
+	*KeystoreSigner
+	db *DBSigner
+}
+
+func (s *keystoreDBSigner) SignHash(
+	addr common.Address, hash []byte) ([]byte, error) {
+	if s.ks.HasAddress(addr) {
+		return s.KeystoreSigner.SignHash(addr, hash)
+	}
+	return s.db.SignHash(addr, hash)
+}
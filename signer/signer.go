@@ -0,0 +1,88 @@
+package signer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	reform "gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/data"
+)
+
+// Signer backends.
+const (
+	BackendDB       = "db"       // Keys encrypted in accounts table.
+	BackendKeystore = "keystore" // Keys in geth keystore directory.
+)
+
+// Errors.
+var (
+	ErrNotAuthorized = errors.New("not authorized to sign this account")
+)
+
+// Config is a signer configuration.
+type Config struct {
+	Backend     string
+	KeystoreDir string // For keystore backend.
+}
+
+// NewConfig creates a default signer configuration.
+func NewConfig() *Config {
+	return &Config{
+		Backend: BackendDB,
+	}
+}
+
+// Signer signs hashes with private keys of accounts.
+type Signer interface {
+	// SignHash returns a signature of a hash in [R || S || V] format.
+	SignHash(addr common.Address, hash []byte) ([]byte, error)
+}
+
+// PasswordUpdater is implemented by signers, which keep keys encrypted with
+// the application password outside of the database.
+type PasswordUpdater interface {
+	// UpdatePassword encrypts the keys with a new password.
+	UpdatePassword(oldPwd, newPwd string) error
+}
+
+// NewSigner creates a signer with a configured backend. Keys are decrypted
+// with a password from a given storage. The keystore backend signs with
+// keys stored in accounts table for accounts which are not in the keystore.
+func NewSigner(conf *Config, db *reform.DB,
+	pwd data.PWDGetter) (Signer, error) {
+	switch conf.Backend {
+	case BackendDB:
+		return NewDBSigner(db, pwd, data.ToPrivateKey), nil
+	case BackendKeystore:
+		return &keystoreDBSigner{
+			KeystoreSigner: NewKeystoreSigner(conf.KeystoreDir, pwd),
+			db:             NewDBSigner(db, pwd, data.ToPrivateKey),
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown signer backend: %s", conf.Backend)
+}
+
+// Transactor returns transaction options to send transactions from a given
+// address signed by a signer.
+func Transactor(s Signer, addr common.Address) *bind.TransactOpts {
+	return &bind.TransactOpts{
+		From: addr,
+		Signer: func(txSigner types.Signer, from common.Address,
+			tx *types.Transaction) (*types.Transaction, error) {
+			if from != addr {
+				return nil, ErrNotAuthorized
+			}
+
+			sig, err := s.SignHash(addr, txSigner.Hash(tx).Bytes())
+			if err != nil {
+				return nil, err
+			}
+
+			return tx.WithSignature(txSigner, sig)
+		},
+	}
+}
@@ -0,0 +1,169 @@
+// +build !nosignertest
+
+package signer
+
+import (
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	reform "gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/util"
+)
+
+var (
+	conf struct {
+		DB  *data.DBConfig
+		Log *util.LogConfig
+	}
+
+	logger *util.Logger
+	db     *reform.DB
+)
+
+func testSigner(t *testing.T, s Signer, addr common.Address) {
+	hash := crypto.Keccak256([]byte("test-message"))
+
+	sig, err := s.SignHash(addr, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crypto.PubkeyToAddress(*pub) != addr {
+		t.Fatal("hash signed with wrong key")
+	}
+
+	tx := types.NewTransaction(0, common.Address{}, big.NewInt(1), 21000,
+		big.NewInt(1), nil)
+
+	auth := Transactor(s, addr)
+	signed, err := auth.Signer(types.HomesteadSigner{}, addr, tx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := types.Sender(types.HomesteadSigner{}, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sender != addr {
+		t.Fatal("transaction signed with wrong key")
+	}
+
+	if _, err := auth.Signer(types.HomesteadSigner{},
+		common.HexToAddress("0x1"), tx); err != ErrNotAuthorized {
+		t.Fatal("transaction of another account signed")
+	}
+
+	if _, err := s.SignHash(common.HexToAddress("0x1"), hash); err == nil {
+		t.Fatal("hash signed for unknown account")
+	}
+}
+
+func TestDBSigner(t *testing.T) {
+	acc := data.NewTestAccount(data.TestPassword)
+	data.InsertToTestDB(t, db, acc)
+	defer data.DeleteFromTestDB(t, db, acc)
+
+	pwd := data.StaticPWDStorage(data.TestPassword)
+	testSigner(t, NewDBSigner(db, &pwd, data.TestToPrivateKey),
+		data.TestToAddress(t, acc.EthAddr))
+
+	pwd = data.StaticPWDStorage("wrong-password")
+	if _, err := NewDBSigner(db, &pwd, data.TestToPrivateKey).SignHash(
+		data.TestToAddress(t, acc.EthAddr),
+		crypto.Keccak256(nil)); err == nil {
+		t.Fatal("hash signed with wrong password")
+	}
+}
+
+func newTestKeystore(t *testing.T) (string, common.Address) {
+	dir, err := ioutil.TempDir("", "dappctrl-keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks := keystore.NewKeyStore(dir,
+		keystore.LightScryptN, keystore.LightScryptP)
+	acc, err := ks.NewAccount(data.TestPassword)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return dir, acc.Address
+}
+
+func TestKeystoreSigner(t *testing.T) {
+	dir, addr := newTestKeystore(t)
+	defer os.RemoveAll(dir)
+
+	pwd := data.StaticPWDStorage(data.TestPassword)
+	testSigner(t, NewKeystoreSigner(dir, &pwd), addr)
+}
+
+func TestKeystoreSignerUpdatePassword(t *testing.T) {
+	dir, addr := newTestKeystore(t)
+	defer os.RemoveAll(dir)
+
+	newPwd := data.TestPassword + "-updated"
+
+	pwd := data.StaticPWDStorage(data.TestPassword)
+	s := NewKeystoreSigner(dir, &pwd)
+
+	if err := s.UpdatePassword("wrong-password", newPwd); err == nil {
+		t.Fatal("keys updated with wrong password")
+	}
+
+	if err := s.UpdatePassword(data.TestPassword, newPwd); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.SignHash(addr, crypto.Keccak256(nil)); err == nil {
+		t.Fatal("hash signed with old password")
+	}
+
+	pwd = data.StaticPWDStorage(newPwd)
+	testSigner(t, s, addr)
+}
+
+func TestKeystoreSignerFallsBackToDB(t *testing.T) {
+	dir, addr := newTestKeystore(t)
+	defer os.RemoveAll(dir)
+
+	acc := data.NewTestAccount(data.TestPassword)
+	data.InsertToTestDB(t, db, acc)
+	defer data.DeleteFromTestDB(t, db, acc)
+
+	pwd := data.StaticPWDStorage(data.TestPassword)
+	s := &keystoreDBSigner{
+		KeystoreSigner: NewKeystoreSigner(dir, &pwd),
+		db:             NewDBSigner(db, &pwd, data.TestToPrivateKey),
+	}
+
+	testSigner(t, s, addr)
+	testSigner(t, s, data.TestToAddress(t, acc.EthAddr))
+}
+
+func TestMain(m *testing.M) {
+	conf.DB = data.NewDBConfig()
+	conf.Log = util.NewLogConfig()
+	util.ReadTestConfig(&conf)
+
+	logger = util.NewTestLogger(conf.Log)
+	db = data.NewTestDB(conf.DB, logger)
+	defer data.CloseDB(db)
+
+	os.Exit(m.Run())
+}
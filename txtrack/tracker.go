@@ -0,0 +1,319 @@
+package txtrack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/eth"
+	"github.com/privatix/dappctrl/util"
+)
+
+const minConfirmationsKey = "eth.min.confirmations"
+
+// Receipt statuses as reported by an ethereum node.
+const (
+	receiptFailed  = 0
+	receiptSuccess = 1
+)
+
+// Transaction tracker errors.
+var (
+	ErrInput = errors.New("one or more input parameters is wrong")
+)
+
+// Config is a transaction tracker configuration.
+type Config struct {
+	CheckPause  int64 // pause between check iterations, in seconds
+	DropTimeout int64 // time before unknown tx is considered dropped
+}
+
+// NewConfig creates a default transaction tracker configuration.
+func NewConfig() *Config {
+	return &Config{
+		CheckPause:  10,
+		DropTimeout: 600,
+	}
+}
+
+// Client is an ethereum node client used to check transactions.
+type Client interface {
+	GetBlockNumber() (*eth.BlockNumberAPIResponse, error)
+	GetTransactionByHash(hash string) (*eth.TransactionAPIResponse, error)
+	GetTransactionReceipt(
+		hash string) (*eth.TransactionReceiptAPIResponse, error)
+}
+
+// Queue is a job queue used to retry jobs of failed transactions and to
+// follow up mined ones.
+type Queue interface {
+	Add(j *data.Job) error
+	Reschedule(id string) error
+}
+
+// followUpJobs are jobs added for objects related to mined transactions of
+// given methods, which produce no blockchain events to react to.
+var followUpJobs = map[string]string{
+	"PSCSetNetworkFee": data.JobAccountUpdateNetworkFee,
+}
+
+// Tracker follows sent transactions until they are mined with enough
+// confirmations, fail or get dropped. Jobs which sent failed or dropped
+// transactions are rescheduled.
+type Tracker struct {
+	conf   *Config
+	logger *util.Logger
+	db     *reform.DB
+	queue  Queue
+	eth    Client
+
+	cancel context.CancelFunc
+	ticker *time.Ticker
+}
+
+// NewTracker creates a new transaction tracker.
+func NewTracker(conf *Config, logger *util.Logger, db *reform.DB,
+	queue Queue, eth Client) (*Tracker, error) {
+	if logger == nil || db == nil || queue == nil || eth == nil ||
+		conf.CheckPause <= 0 || conf.DropTimeout <= 0 {
+		return nil, ErrInput
+	}
+
+	return &Tracker{
+		conf:   conf,
+		logger: logger,
+		db:     db,
+		queue:  queue,
+		eth:    eth,
+	}, nil
+}
+
+// Start starts the tracker. It will continue checking transactions until it
+// is stopped with Stop.
+func (t *Tracker) Start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancel = cancel
+
+	t.ticker = time.NewTicker(
+		time.Duration(t.conf.CheckPause) * time.Second)
+	go t.run(ctx, t.ticker.C)
+
+	t.logger.Debug("transaction tracker started")
+	return nil
+}
+
+// Stop makes the tracker stop.
+func (t *Tracker) Stop() error {
+	t.cancel()
+	t.ticker.Stop()
+
+	t.logger.Debug("transaction tracker stopped")
+	return nil
+}
+
+func (t *Tracker) run(ctx context.Context, ticker <-chan time.Time) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker:
+			if err := t.check(); err != nil {
+				t.logger.Error("transaction tracker: %s", err)
+			}
+		}
+	}
+}
+
+// check updates all transactions which are not final yet. Mined transactions
+// are rechecked until they get enough confirmations.
+func (t *Tracker) check() error {
+	confirmations, err := data.GetUint64Setting(t.db, minConfirmationsKey)
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.eth.GetBlockNumber()
+	if err != nil {
+		return fmt.Errorf("could not get block number: %v", err)
+	}
+
+	latest, err := hexutil.DecodeUint64(resp.Result)
+	if err != nil {
+		return fmt.Errorf("could not parse block number: %v", err)
+	}
+
+	var confirmed uint64
+	if latest > confirmations {
+		confirmed = latest - confirmations
+	}
+
+	// Replaced transactions are checked as well while their replacements
+	// are pending, since any of them can be mined.
+	txs, err := t.db.SelectAllFrom(data.EthTxTable, `
+		WHERE status IN ($1, $2) OR (status = $3 AND block_number > $4)
+		      OR (status = $5 AND replaced_by IN (SELECT id FROM eth_txs
+		                                     WHERE status IN ($1, $2, $5)))
+		ORDER BY issued`, data.TxSent, data.TxUncle, data.TxMined,
+		confirmed, data.TxReplaced)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range txs {
+		tx := v.(*data.EthTx)
+		if err := t.checkTx(tx); err != nil {
+			t.logger.Error("failed to check transaction %s: %s",
+				tx.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (t *Tracker) checkTx(tx *data.EthTx) error {
+	// The status might be changed when checking other transactions with
+	// the same nonce.
+	if err := t.db.Reload(tx); err != nil {
+		return err
+	}
+
+	hash, err := data.ToHash(tx.Hash)
+	if err != nil {
+		return err
+	}
+
+	receipt, err := t.eth.GetTransactionReceipt(hash.Hex())
+	if err != nil {
+		return fmt.Errorf("could not get receipt: %v", err)
+	}
+
+	now := time.Now()
+	tx.Checked = &now
+
+	if receipt.Result != nil {
+		return t.mined(tx, receipt.Result)
+	}
+
+	if tx.Status == data.TxMined {
+		// The block with this transaction is not in the main chain
+		// anymore.
+		tx.Status = data.TxUncle
+		tx.BlockNumber = nil
+		tx.GasUsed = nil
+		return t.db.Save(tx)
+	}
+
+	if tx.Status == data.TxReplaced {
+		return t.db.Save(tx)
+	}
+
+	known, err := t.eth.GetTransactionByHash(hash.Hex())
+	if err != nil {
+		return fmt.Errorf("could not get transaction: %v", err)
+	}
+
+	timeout := time.Duration(t.conf.DropTimeout) * time.Second
+	if known.Result != nil || now.Sub(tx.Issued) < timeout {
+		return t.db.Save(tx)
+	}
+
+	t.logger.Warn("transaction %s is dropped", hash.Hex())
+	return t.finish(tx, data.TxDropped)
+}
+
+func (t *Tracker) mined(tx *data.EthTx, receipt *eth.TransactionReceipt) error {
+	block, err := hexutil.DecodeUint64(receipt.BlockNumber)
+	if err != nil {
+		return fmt.Errorf("could not parse block number: %v", err)
+	}
+
+	gas, err := hexutil.DecodeUint64(receipt.GasUsed)
+	if err != nil {
+		return fmt.Errorf("could not parse gas used: %v", err)
+	}
+
+	tx.BlockNumber = &block
+	tx.GasUsed = &gas
+
+	if err := t.replaceOthers(tx); err != nil {
+		return err
+	}
+
+	// Receipts of pre-Byzantium blocks contain no status.
+	var status uint64 = receiptSuccess
+	if receipt.Status != "" {
+		status, err = hexutil.DecodeUint64(receipt.Status)
+		if err != nil {
+			return fmt.Errorf(
+				"could not parse receipt status: %v", err)
+		}
+	}
+
+	if status == receiptFailed {
+		t.logger.Warn("transaction %s is reverted",
+			receipt.TransactionHash)
+		return t.finish(tx, data.TxFailed)
+	}
+
+	wasMined := tx.Status == data.TxMined
+	tx.Status = data.TxMined
+	if err := t.db.Save(tx); err != nil || wasMined {
+		return err
+	}
+
+	return t.followUp(tx)
+}
+
+// followUp adds a job to update an object related to a newly mined
+// transaction, if its method requires one.
+func (t *Tracker) followUp(tx *data.EthTx) error {
+	jobType, ok := followUpJobs[tx.Method]
+	if !ok {
+		return nil
+	}
+
+	return t.queue.Add(&data.Job{
+		Type:        jobType,
+		RelatedType: tx.RelatedType,
+		RelatedID:   tx.RelatedID,
+		CreatedBy:   data.JobBCMonitor,
+		Data:        []byte("{}"),
+	})
+}
+
+// finish saves a transaction with a given unsuccessful status and reschedules
+// the job which has sent it.
+func (t *Tracker) finish(tx *data.EthTx, status string) error {
+	tx.Status = status
+	if err := t.db.Save(tx); err != nil {
+		return err
+	}
+
+	if tx.JobID == nil {
+		return nil
+	}
+
+	return t.queue.Reschedule(*tx.JobID)
+}
+
+// replaceOthers marks all pending transactions with the same nonce as
+// a given mined one as replaced.
+func (t *Tracker) replaceOthers(tx *data.EthTx) error {
+	if tx.Nonce == nil {
+		return nil
+	}
+
+	_, err := t.db.Exec(`
+		UPDATE eth_txs
+		   SET status = $1
+		 WHERE addr_from = $2 AND nonce = $3 AND id <> $4
+		       AND status IN ($5, $6)`,
+		data.TxReplaced, tx.AddrFrom, *tx.Nonce, tx.ID,
+		data.TxSent, data.TxUncle)
+	return err
+}
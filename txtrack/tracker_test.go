@@ -0,0 +1,277 @@
+// +build !notxtracktest
+
+package txtrack
+
+import (
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/eth"
+	"github.com/privatix/dappctrl/util"
+)
+
+const (
+	testLatestBlock   = 100
+	testConfirmations = 6
+)
+
+var (
+	conf struct {
+		DB        *data.DBConfig
+		Log       *util.LogConfig
+		TxTracker *Config
+	}
+
+	logger *util.Logger
+	db     *reform.DB
+)
+
+type mockClient struct {
+	receipts map[string]*eth.TransactionReceipt
+	pending  map[string]bool
+}
+
+func newMockClient() *mockClient {
+	return &mockClient{
+		receipts: make(map[string]*eth.TransactionReceipt),
+		pending:  make(map[string]bool),
+	}
+}
+
+func (c *mockClient) GetBlockNumber() (*eth.BlockNumberAPIResponse, error) {
+	return &eth.BlockNumberAPIResponse{
+		Result: hexutil.EncodeUint64(testLatestBlock),
+	}, nil
+}
+
+func (c *mockClient) GetTransactionByHash(
+	hash string) (*eth.TransactionAPIResponse, error) {
+	resp := &eth.TransactionAPIResponse{}
+	if c.pending[hash] {
+		resp.Result = &eth.Transaction{Hash: hash}
+	}
+	return resp, nil
+}
+
+func (c *mockClient) GetTransactionReceipt(
+	hash string) (*eth.TransactionReceiptAPIResponse, error) {
+	return &eth.TransactionReceiptAPIResponse{
+		Result: c.receipts[hash],
+	}, nil
+}
+
+func (c *mockClient) mine(t *testing.T, tx *data.EthTx, block uint64,
+	status uint64) {
+	hash := data.TestToHash(t, tx.Hash).Hex()
+	c.receipts[hash] = &eth.TransactionReceipt{
+		BlockNumber:     hexutil.EncodeUint64(block),
+		GasUsed:         hexutil.EncodeUint64(tx.Gas),
+		Status:          hexutil.EncodeUint64(status),
+		TransactionHash: hash,
+	}
+}
+
+type mockQueue struct {
+	added       []*data.Job
+	rescheduled []string
+}
+
+func (q *mockQueue) Add(j *data.Job) error {
+	q.added = append(q.added, j)
+	return nil
+}
+
+func (q *mockQueue) Reschedule(id string) error {
+	q.rescheduled = append(q.rescheduled, id)
+	return nil
+}
+
+func newTestTracker(t *testing.T) (*Tracker, *mockClient, *mockQueue) {
+	client := newMockClient()
+	queue := &mockQueue{}
+
+	tracker, err := NewTracker(conf.TxTracker, logger, db, queue, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tracker, client, queue
+}
+
+func newTestTx(t *testing.T, job *data.Job) *data.EthTx {
+	tx := data.NewTestEthTx(job.RelatedType, job.RelatedID)
+	tx.JobID = &job.ID
+	data.InsertToTestDB(t, db, tx)
+	return tx
+}
+
+func setConfirmations(t *testing.T) {
+	data.InsertToTestDB(t, db, &data.Setting{
+		Key:   minConfirmationsKey,
+		Value: strconv.Itoa(testConfirmations),
+		Name:  minConfirmationsKey,
+	})
+}
+
+func checkTx(t *testing.T, tx *data.EthTx, status string) {
+	data.ReloadFromTestDB(t, db, tx)
+	if tx.Status != status {
+		t.Fatalf("wrong tx status: got %s, expected %s",
+			tx.Status, status)
+	}
+	if tx.Checked == nil {
+		t.Fatal("tx check time is not set")
+	}
+}
+
+func TestTrack(t *testing.T) {
+	defer data.CleanTestDB(t, db)
+
+	setConfirmations(t)
+
+	job := data.NewTestJob(data.JobPreAccountAddBalanceApprove,
+		data.JobUser, data.JobAccount)
+	job.RelatedID = util.NewUUID()
+	job.Status = data.JobDone
+	data.InsertToTestDB(t, db, job)
+
+	tracker, client, queue := newTestTracker(t)
+
+	pending := newTestTx(t, job)
+	client.pending[data.TestToHash(t, pending.Hash).Hex()] = true
+
+	unknown := newTestTx(t, job)
+
+	dropped := newTestTx(t, job)
+	dropped.Issued = time.Now().Add(
+		-time.Duration(conf.TxTracker.DropTimeout+1) * time.Second)
+	data.SaveToTestDB(t, db, dropped)
+
+	mined := newTestTx(t, job)
+	client.mine(t, mined, testLatestBlock, receiptSuccess)
+
+	reverted := newTestTx(t, job)
+	client.mine(t, reverted, testLatestBlock, receiptFailed)
+
+	util.TestExpectResult(t, "check", nil, tracker.check())
+
+	checkTx(t, pending, data.TxSent)
+	checkTx(t, unknown, data.TxSent)
+	checkTx(t, dropped, data.TxDropped)
+	checkTx(t, mined, data.TxMined)
+	checkTx(t, reverted, data.TxFailed)
+
+	if mined.BlockNumber == nil || *mined.BlockNumber != testLatestBlock ||
+		mined.GasUsed == nil || *mined.GasUsed != mined.Gas {
+		t.Fatal("receipt data of mined tx is not saved")
+	}
+
+	if len(queue.rescheduled) != 2 || queue.rescheduled[0] != job.ID ||
+		queue.rescheduled[1] != job.ID {
+		t.Fatalf("unexpected rescheduled jobs: %v", queue.rescheduled)
+	}
+
+	// The block with mined tx is not confirmed yet and leaves the chain.
+	delete(client.receipts, data.TestToHash(t, mined.Hash).Hex())
+
+	util.TestExpectResult(t, "check", nil, tracker.check())
+
+	checkTx(t, mined, data.TxUncle)
+	if mined.BlockNumber != nil || mined.GasUsed != nil {
+		t.Fatal("receipt data of uncle tx is not reset")
+	}
+}
+
+func TestTrackReplaced(t *testing.T) {
+	defer data.CleanTestDB(t, db)
+
+	setConfirmations(t)
+
+	tracker, client, queue := newTestTracker(t)
+
+	job := data.NewTestJob(data.JobPreAccountAddBalanceApprove,
+		data.JobUser, data.JobAccount)
+	job.RelatedID = util.NewUUID()
+	job.Status = data.JobDone
+	data.InsertToTestDB(t, db, job)
+
+	nonce := "1"
+
+	replacement := newTestTx(t, job)
+	replacement.Nonce = &nonce
+	data.SaveToTestDB(t, db, replacement)
+
+	replaced := newTestTx(t, job)
+	replaced.Nonce = &nonce
+	replaced.Status = data.TxReplaced
+	replaced.ReplacedBy = &replacement.ID
+	replaced.Issued = time.Now().Add(
+		-time.Duration(conf.TxTracker.DropTimeout+1) * time.Second)
+	data.SaveToTestDB(t, db, replaced)
+
+	// The replaced tx is the one which gets mined.
+	client.mine(t, replaced, testLatestBlock, receiptSuccess)
+
+	util.TestExpectResult(t, "check", nil, tracker.check())
+
+	checkTx(t, replaced, data.TxMined)
+	data.ReloadFromTestDB(t, db, replacement)
+	if replacement.Status != data.TxReplaced {
+		t.Fatalf("wrong replacement tx status: %s", replacement.Status)
+	}
+
+	if len(queue.rescheduled) != 0 {
+		t.Fatalf("unexpected rescheduled jobs: %v", queue.rescheduled)
+	}
+}
+
+func TestTrackFollowUp(t *testing.T) {
+	defer data.CleanTestDB(t, db)
+
+	setConfirmations(t)
+
+	tracker, client, queue := newTestTracker(t)
+
+	job := data.NewTestJob(data.JobPreAccountSetNetworkFee,
+		data.JobUser, data.JobAccount)
+	job.RelatedID = util.NewUUID()
+	job.Status = data.JobDone
+	data.InsertToTestDB(t, db, job)
+
+	tx := newTestTx(t, job)
+	tx.Method = "PSCSetNetworkFee"
+	data.SaveToTestDB(t, db, tx)
+
+	client.mine(t, tx, testLatestBlock, receiptSuccess)
+
+	// Follow-up job is added only once, when the tx gets mined.
+	for i := 0; i < 2; i++ {
+		util.TestExpectResult(t, "check", nil, tracker.check())
+	}
+
+	checkTx(t, tx, data.TxMined)
+	if len(queue.added) != 1 ||
+		queue.added[0].Type != data.JobAccountUpdateNetworkFee ||
+		queue.added[0].RelatedID != job.RelatedID {
+		t.Fatalf("unexpected follow-up jobs: %v", queue.added)
+	}
+}
+
+func TestMain(m *testing.M) {
+	conf.DB = data.NewDBConfig()
+	conf.Log = util.NewLogConfig()
+	conf.TxTracker = NewConfig()
+	util.ReadTestConfig(&conf)
+
+	logger = util.NewTestLogger(conf.Log)
+	db = data.NewTestDB(conf.DB, logger)
+	defer data.CloseDB(db)
+
+	os.Exit(m.Run())
+}
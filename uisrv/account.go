@@ -9,10 +9,12 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"gopkg.in/reform.v1"
 
 	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/hdwallet"
 	"github.com/privatix/dappctrl/util"
 )
 
@@ -33,9 +35,17 @@ func (s *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
 		s.handleCreateAccount(w, r)
 		return
 	}
-	id := idFromStatusPath(accountsPath, r.URL.Path)
-	if id != "" && r.Method == http.MethodPut {
-		s.handleUpdateAccountBalance(w, r, id)
+	if r.Method == http.MethodPut {
+		if id := idFromStatusPath(accountsPath, r.URL.Path); id != "" {
+			s.handleUpdateAccountBalance(w, r, id)
+			return
+		}
+		s.handleUpdateAccount(w, r)
+		return
+	}
+	if r.Method == http.MethodDelete {
+		s.handleDeleteAccount(w, r,
+			strings.TrimPrefix(r.URL.Path, accountsPath))
 		return
 	}
 	w.WriteHeader(http.StatusMethodNotAllowed)
@@ -57,12 +67,32 @@ func (s *Server) handleExportAccount(w http.ResponseWriter, r *http.Request, id
 		return
 	}
 
-	privKeyJSONBytes, err := data.ToBytes(acc.PrivateKey)
+	if acc.PrivateKey == nil {
+		s.replyErr(w, http.StatusBadRequest, &serverError{
+			Message: "account key is kept in a keystore",
+		})
+		return
+	}
+
+	privKeyJSONBytes, err := data.ToBytes(*acc.PrivateKey)
 	if err != nil {
 		s.replyUnexpectedErr(w)
 		return
 	}
 
+	// Keys are not exported unless the export is recorded.
+	if !s.insert(w, &data.KeyExport{
+		ID:         util.NewUUID(),
+		Account:    acc.ID,
+		EthAddr:    acc.EthAddr,
+		RemoteAddr: r.RemoteAddr,
+		ExportedAt: time.Now(),
+	}) {
+		return
+	}
+	s.logger.Warn("private key of account %s exported by %s",
+		acc.ID, r.RemoteAddr)
+
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	if _, err := w.Write(privKeyJSONBytes); err != nil {
 		s.logger.Warn("failed to reply with the private key: %v", err)
@@ -80,9 +110,23 @@ type accountCreatePayload struct {
 	PrivateKey           string `json:"privateKey"`
 	JSONKeyStoreRaw      string `json:"jsonKeyStoreRaw"`
 	JSONKeyStorePassword string `json:"jsonKeyStorePassword"`
+	Mnemonic             string `json:"mnemonic"`
+	MnemonicPassphrase   string `json:"mnemonicPassphrase"`
+	HDIndex              uint32 `json:"hdIndex"`
+	EthAddr              string `json:"ethAddr"` // Hex, for keystore keys.
 	IsDefault            bool   `json:"isDefault"`
 	InUse                bool   `json:"inUse"`
 	Name                 string `json:"name"`
+
+	// Balance alert thresholds, defaults are used when not set.
+	MinEthBalance *data.Amount `json:"minEthBalance"`
+	MinPTCBalance *data.Amount `json:"minPtcBalance"`
+	MinPSCBalance *data.Amount `json:"minPscBalance"`
+
+	// Client spending caps, not limited when not set.
+	MaxDailySpend   *data.Amount `json:"maxDailySpend"`
+	MaxChannelSpend *data.Amount `json:"maxChannelSpend"`
+	MaxUnitPrice    *data.Amount `json:"maxUnitPrice"`
 }
 
 func (p *accountCreatePayload) fromPrivateKeyToECDSA() (*ecdsa.PrivateKey, error) {
@@ -105,55 +149,217 @@ func (p *accountCreatePayload) fromJSONKeyStoreRawToECDSA() (*ecdsa.PrivateKey,
 	return key.PrivateKey, nil
 }
 
+func (p *accountCreatePayload) hdWallet() (*hdwallet.Wallet, error) {
+	return hdwallet.NewWallet(p.Mnemonic, p.MnemonicPassphrase)
+}
+
+func (p *accountCreatePayload) fromMnemonicToECDSA() (*ecdsa.PrivateKey, error) {
+	wallet, err := p.hdWallet()
+	if err != nil {
+		return nil, fmt.Errorf("could not create hd wallet: %v", err)
+	}
+	return wallet.Derive(hdwallet.AccountPath(hdwallet.BasePath, p.HDIndex))
+}
+
+// derived tells whether an account key is derived from a mnemonic.
+func (p *accountCreatePayload) derived() bool {
+	return p.PrivateKey == "" && p.JSONKeyStoreRaw == "" && p.Mnemonic != ""
+}
+
+// keystore tells whether an account is imported by address, so that its key
+// is kept in a signer keystore.
+func (p *accountCreatePayload) keystore() bool {
+	return p.PrivateKey == "" && p.JSONKeyStoreRaw == "" &&
+		p.Mnemonic == "" && p.EthAddr != ""
+}
+
 func (p *accountCreatePayload) toECDSA() (*ecdsa.PrivateKey, error) {
 	if p.PrivateKey != "" {
 		return p.fromPrivateKeyToECDSA()
 	} else if p.JSONKeyStoreRaw != "" {
 		return p.fromJSONKeyStoreRawToECDSA()
+	} else if p.Mnemonic != "" {
+		return p.fromMnemonicToECDSA()
 	}
 
-	return nil, fmt.Errorf("neither private key nor raw keystore json provided")
+	return nil, fmt.Errorf("neither private key, raw keystore json" +
+		" nor mnemonic provided")
 }
 
-func (s *Server) handleCreateAccount(w http.ResponseWriter, r *http.Request) {
-	payload := &accountCreatePayload{}
-	if !s.parsePayload(w, r, payload) {
-		return
+// keystorePublicKey returns a public key of an account kept in a signer
+// keystore. The key is recovered from a signature, which also proves that
+// the account can be signed for.
+func (s *Server) keystorePublicKey(
+	hexAddr string) (*ecdsa.PublicKey, error) {
+	if !common.IsHexAddress(hexAddr) {
+		return nil, fmt.Errorf("invalid address: %s", hexAddr)
+	}
+	addr := common.HexToAddress(hexAddr)
+
+	hash := crypto.Keccak256(addr.Bytes())
+	sig, err := s.signer.SignHash(addr, hash)
+	if err != nil {
+		return nil, fmt.Errorf("could not sign for %s: %v",
+			addr.Hex(), err)
+	}
+
+	pub, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return nil, fmt.Errorf("could not recover public key: %v", err)
+	}
+	if crypto.PubkeyToAddress(*pub) != addr {
+		return nil, fmt.Errorf("key of %s does not match", addr.Hex())
+	}
+
+	return pub, nil
+}
+
+// setAccountKeys sets keys of a new account. Private keys are stored
+// encrypted, unless an account is imported from a signer keystore.
+func (s *Server) setAccountKeys(w http.ResponseWriter,
+	payload *accountCreatePayload, acc *data.Account) bool {
+	if payload.keystore() {
+		pub, err := s.keystorePublicKey(payload.EthAddr)
+		if err != nil {
+			s.logger.Warn("could not import keystore account: %v", err)
+			s.replyInvalidPayload(w)
+			return false
+		}
+		acc.PublicKey = data.FromBytes(crypto.FromECDSAPub(pub))
+		acc.EthAddr = data.FromBytes(crypto.PubkeyToAddress(*pub).Bytes())
+		return true
 	}
-	acc := &data.Account{}
-	acc.ID = util.NewUUID()
 
 	privKey, err := payload.toECDSA()
 	if err != nil {
 		s.logger.Warn("could not extract priv key: %v", err)
 		s.replyInvalidPayload(w)
-		return
+		return false
 	}
 
-	acc.PrivateKey, err = s.encryptKeyFunc(privKey, s.pwdStorage.Get())
+	encrypted, err := s.encryptKeyFunc(privKey, s.pwdStorage.Get())
 	if err != nil {
 		s.logger.Warn("could not encrypt priv key: %v", err)
 		s.replyUnexpectedErr(w)
-		return
+		return false
 	}
+	acc.PrivateKey = &encrypted
 
 	acc.PublicKey = data.FromBytes(crypto.FromECDSAPub(&privKey.PublicKey))
 
 	ethAddr := crypto.PubkeyToAddress(privKey.PublicKey)
 	acc.EthAddr = data.FromBytes(ethAddr.Bytes())
+	return true
+}
+
+// setHDWallet links an account derived from a mnemonic to its hd wallet.
+// The wallet is stored on first use, so that accounts can be restored later
+// from the mnemonic using stored derivation paths.
+func (s *Server) setHDWallet(w http.ResponseWriter,
+	payload *accountCreatePayload, acc *data.Account, tx *reform.TX) bool {
+	walletID, err := findOrInsertHDWallet(tx, payload)
+	if err != nil {
+		tx.Rollback()
+		s.logger.Error("failed to set hd wallet: %v", err)
+		s.replyUnexpectedErr(w)
+		return false
+	}
+
+	acc.HDWallet = &walletID
+	acc.HDIndex = &payload.HDIndex
+	return true
+}
+
+func findOrInsertHDWallet(tx *reform.TX,
+	payload *accountCreatePayload) (string, error) {
+	wallet, err := payload.hdWallet()
+	if err != nil {
+		return "", err
+	}
+
+	addr, err := wallet.Fingerprint()
+	if err != nil {
+		return "", err
+	}
+	fingerprint := data.FromBytes(addr.Bytes())
+
+	rec := &data.HDWallet{}
+	err = tx.FindOneTo(rec, "fingerprint", fingerprint)
+	if err == reform.ErrNoRows {
+		rec = &data.HDWallet{
+			ID:          util.NewUUID(),
+			Fingerprint: fingerprint,
+			BasePath:    hdwallet.BasePath.String(),
+			CreatedAt:   time.Now(),
+		}
+		err = tx.Insert(rec)
+	}
+	if err != nil {
+		return "", err
+	}
+	return rec.ID, nil
+}
+
+// mnemonicReply is a reply with a newly generated mnemonic.
+type mnemonicReply struct {
+	Mnemonic string `json:"mnemonic"`
+}
+
+// handleGetMnemonic replies with a new mnemonic to derive accounts from.
+// The mnemonic is not stored.
+func (s *Server) handleGetMnemonic(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	mnemonic, err := hdwallet.NewMnemonic()
+	if err != nil {
+		s.logger.Error("failed to generate mnemonic: %v", err)
+		s.replyUnexpectedErr(w)
+		return
+	}
+
+	s.reply(w, &mnemonicReply{Mnemonic: mnemonic})
+}
+
+func (s *Server) handleCreateAccount(w http.ResponseWriter, r *http.Request) {
+	payload := &accountCreatePayload{}
+	if !s.parsePayload(w, r, payload) {
+		return
+	}
+	acc := &data.Account{}
+	acc.ID = util.NewUUID()
+
+	if !s.setAccountKeys(w, payload, acc) {
+		return
+	}
 
 	acc.IsDefault = payload.IsDefault
 	acc.InUse = payload.InUse
 	acc.Name = payload.Name
+	acc.MinEthBalance = payload.MinEthBalance
+	acc.MinPTCBalance = payload.MinPTCBalance
+	acc.MinPSCBalance = payload.MinPSCBalance
+	acc.MaxDailySpend = payload.MaxDailySpend
+	acc.MaxChannelSpend = payload.MaxChannelSpend
+	acc.MaxUnitPrice = payload.MaxUnitPrice
 
 	// Set 0 balances on initial create.
-	acc.PTCBalance = 0
-	acc.PSCBalance = 0
-	acc.EthBalance = data.B64BigInt(data.FromBytes([]byte{0}))
+	acc.PTCBalance = data.Amount{}
+	acc.PSCBalance = data.Amount{}
+	acc.EthBalance = data.Amount{}
 
-	if err := s.db.Insert(acc); err != nil {
-		s.logger.Warn("could not insert account: %v", err)
-		s.replyUnexpectedErr(w)
+	tx, ok := s.begin(w)
+	if !ok {
+		return
+	}
+
+	if payload.derived() && !s.setHDWallet(w, payload, acc, tx) {
+		return
+	}
+
+	if !s.insertTx(w, acc, tx) || !s.commit(w, tx) {
 		return
 	}
 
@@ -175,10 +381,203 @@ func (s *Server) handleCreateAccount(w http.ResponseWriter, r *http.Request) {
 	s.replyEntityCreated(w, acc.ID)
 }
 
+// accountUpdatePayload is an account update payload. Balances and keys are
+// not updated.
+type accountUpdatePayload struct {
+	ID            string       `json:"id"`
+	IsDefault     bool         `json:"isDefault"`
+	InUse         bool         `json:"inUse"`
+	Name          string       `json:"name"`
+	MinEthBalance *data.Amount `json:"minEthBalance"`
+	MinPTCBalance *data.Amount `json:"minPtcBalance"`
+	MinPSCBalance *data.Amount `json:"minPscBalance"`
+
+	MaxDailySpend   *data.Amount `json:"maxDailySpend"`
+	MaxChannelSpend *data.Amount `json:"maxChannelSpend"`
+	MaxUnitPrice    *data.Amount `json:"maxUnitPrice"`
+}
+
+// handleUpdateAccount updates an account. Agent accounts with open channels
+// can be deactivated only after offerings of the channels are removed.
+func (s *Server) handleUpdateAccount(w http.ResponseWriter, r *http.Request) {
+	payload := &accountUpdatePayload{}
+	if !s.parsePayload(w, r, payload) {
+		return
+	}
+	if !util.IsUUID(payload.ID) {
+		s.replyInvalidPayload(w)
+		return
+	}
+
+	tx, ok := s.begin(w)
+	if !ok {
+		return
+	}
+
+	acc := &data.Account{}
+	if !s.findForUpdateTx(w, acc, payload.ID, tx) {
+		return
+	}
+
+	if acc.InUse && !payload.InUse {
+		reason, err := deactivationBlocker(tx, acc)
+		if err != nil {
+			tx.Rollback()
+			s.logger.Error("failed to check account channels: %v", err)
+			s.replyUnexpectedErr(w)
+			return
+		}
+		if reason != "" {
+			tx.Rollback()
+			s.replyErr(w, http.StatusBadRequest,
+				&serverError{Message: reason})
+			return
+		}
+	}
+
+	acc.IsDefault = payload.IsDefault
+	acc.InUse = payload.InUse
+	acc.Name = payload.Name
+	acc.MinEthBalance = payload.MinEthBalance
+	acc.MinPTCBalance = payload.MinPTCBalance
+	acc.MinPSCBalance = payload.MinPSCBalance
+	acc.MaxDailySpend = payload.MaxDailySpend
+	acc.MaxChannelSpend = payload.MaxChannelSpend
+	acc.MaxUnitPrice = payload.MaxUnitPrice
+
+	if !s.updateTx(w, acc, tx) || !s.commit(w, tx) {
+		return
+	}
+
+	s.replyEntityUpdated(w, acc.ID)
+}
+
+// handleDeleteAccount deletes an account, unless it has psc balance, open
+// channels or active jobs.
+func (s *Server) handleDeleteAccount(w http.ResponseWriter,
+	r *http.Request, id string) {
+	if !util.IsUUID(id) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tx, ok := s.begin(w)
+	if !ok {
+		return
+	}
+
+	acc := &data.Account{}
+	if !s.findForUpdateTx(w, acc, id, tx) {
+		return
+	}
+
+	reason, err := deletionBlocker(tx, acc)
+	if err != nil {
+		tx.Rollback()
+		s.logger.Error("failed to check account usage: %v", err)
+		s.replyUnexpectedErr(w)
+		return
+	}
+	if reason != "" {
+		tx.Rollback()
+		s.replyErr(w, http.StatusBadRequest, &serverError{Message: reason})
+		return
+	}
+
+	if !s.deleteTx(w, acc, tx) || !s.commit(w, tx) {
+		return
+	}
+
+	s.replyOK(w, "account deleted")
+}
+
+// openChannelCond is a condition selecting channels which are not closed.
+const openChannelCond = "channels.channel_status NOT IN ('" +
+	data.ChannelClosedCoop + "', '" + data.ChannelClosedUncoop + "')"
+
+// deactivationBlocker returns a reason why an account can not be
+// deactivated, or an empty string if it can.
+func deactivationBlocker(tx *reform.TX, acc *data.Account) (string, error) {
+	var num int
+	if err := tx.QueryRow(`
+		SELECT count(*)
+		  FROM channels
+		       JOIN offerings ON offerings.id = channels.offering
+		 WHERE channels.agent = $1 AND offerings.offer_status <> $2
+		       AND `+openChannelCond,
+		acc.EthAddr, data.OfferRemove).Scan(&num); err != nil {
+		return "", err
+	}
+	if num != 0 {
+		return "account has open channels, remove their offerings first",
+			nil
+	}
+
+	return "", nil
+}
+
+// deletionBlocker returns a reason why an account can not be deleted, or an
+// empty string if it can. Balance checks are not considered as active jobs,
+// since they stop for deleted accounts.
+func deletionBlocker(tx *reform.TX, acc *data.Account) (string, error) {
+	if !acc.PSCBalance.IsZero() {
+		return "account has psc balance, return it first", nil
+	}
+
+	var num int
+	if err := tx.QueryRow(`
+		SELECT count(*)
+		  FROM channels
+		 WHERE (channels.agent = $1 OR channels.client = $1)
+		       AND `+openChannelCond, acc.EthAddr).Scan(&num); err != nil {
+		return "", err
+	}
+	if num != 0 {
+		return "account has open channels", nil
+	}
+
+	if err := tx.QueryRow(`
+		SELECT count(*)
+		  FROM jobs
+		 WHERE related_type = $1 AND related_id = $2
+		       AND status = $3 AND type <> $4`,
+		data.JobAccount, acc.ID, data.JobActive,
+		data.JobAccountAddCheckBalance).Scan(&num); err != nil {
+		return "", err
+	}
+	if num != 0 {
+		return "account has active jobs", nil
+	}
+
+	return "", nil
+}
+
+// Actions on account balances.
+const (
+	accountTransfer         = "transfer"
+	accountWithdraw         = "withdraw"
+	accountSetNetworkFee    = "setNetworkFee"
+	accountUpdateNetworkFee = "updateNetworkFee"
+)
+
+// Currencies that can be withdrawn from an account.
+const (
+	currencyETH = "eth"
+	currencyPTC = "ptc"
+)
+
+// accountBalancePayload is an account balance action payload. Transfer moves
+// funds between the ptc and psc contracts, withdraw sends eth or ptc to
+// a hex encoded external address. Network fee actions are allowed only for
+// the psc owner, the current fee is shown in settings after an update.
 type accountBalancePayload struct {
-	Amount      uint   `json:"amount"`
-	Destination string `json:"destination"`
-	GasPrice    uint64 `json:"gasPrice"`
+	Action      string      `json:"action"`
+	Amount      data.Amount `json:"amount"`
+	Destination string      `json:"destination"`
+	Currency    string      `json:"currency"`
+	To          string      `json:"to"`
+	NetworkFee  uint32      `json:"networkFee"`
+	GasPrice    uint64      `json:"gasPrice"`
 }
 
 func (s *Server) handleUpdateAccountBalance(w http.ResponseWriter, r *http.Request, id string) {
@@ -186,7 +585,33 @@ func (s *Server) handleUpdateAccountBalance(w http.ResponseWriter, r *http.Reque
 	if !s.parsePayload(w, r, payload) {
 		return
 	}
-	if payload.Amount == 0 || (payload.Destination != data.ContractPSC &&
+
+	switch payload.Action {
+	case "", accountTransfer:
+		s.transferAccountBalance(w, payload, id)
+	case accountWithdraw:
+		s.withdrawAccountBalance(w, payload, id)
+	case accountSetNetworkFee:
+		if s.findTo(w, &data.Account{}, id) {
+			s.addAccountJob(w, data.JobPreAccountSetNetworkFee, id,
+				&data.JobNetworkFeeData{
+					NetworkFee: payload.NetworkFee,
+					GasPrice:   payload.GasPrice,
+				})
+		}
+	case accountUpdateNetworkFee:
+		if s.findTo(w, &data.Account{}, id) {
+			s.addAccountJob(w, data.JobAccountUpdateNetworkFee, id,
+				&struct{}{})
+		}
+	default:
+		s.replyInvalidAction(w)
+	}
+}
+
+func (s *Server) transferAccountBalance(w http.ResponseWriter,
+	payload *accountBalancePayload, id string) {
+	if payload.Amount.IsZero() || (payload.Destination != data.ContractPSC &&
 		payload.Destination != data.ContractPTC) {
 		s.replyErr(w, http.StatusBadRequest, &serverError{
 			Message: "invalid amount or destination",
@@ -203,11 +628,48 @@ func (s *Server) handleUpdateAccountBalance(w http.ResponseWriter, r *http.Reque
 		jobType = data.JobPreAccountReturnBalance
 	}
 
-	jobData := &data.JobBalanceData{
+	s.addAccountJob(w, jobType, id, &data.JobBalanceData{
 		Amount:   payload.Amount,
 		GasPrice: payload.GasPrice,
+	})
+}
+
+func (s *Server) withdrawAccountBalance(w http.ResponseWriter,
+	payload *accountBalancePayload, id string) {
+	if payload.Amount.IsZero() || (payload.Currency != currencyETH &&
+		payload.Currency != currencyPTC) {
+		s.replyErr(w, http.StatusBadRequest, &serverError{
+			Message: "invalid amount or currency",
+		})
+		return
+	}
+
+	if !common.IsHexAddress(payload.To) ||
+		common.HexToAddress(payload.To) == (common.Address{}) {
+		s.replyErr(w, http.StatusBadRequest, &serverError{
+			Message: "invalid withdrawal address",
+		})
+		return
 	}
 
+	if !s.findTo(w, &data.Account{}, id) {
+		return
+	}
+
+	jobType := data.JobPreAccountWithdrawETH
+	if payload.Currency == currencyPTC {
+		jobType = data.JobPreAccountWithdrawPTC
+	}
+
+	s.addAccountJob(w, jobType, id, &data.JobWithdrawData{
+		Amount:   payload.Amount,
+		To:       data.FromBytes(common.HexToAddress(payload.To).Bytes()),
+		GasPrice: payload.GasPrice,
+	})
+}
+
+func (s *Server) addAccountJob(w http.ResponseWriter,
+	jobType, id string, jobData interface{}) {
 	jobDataB, err := json.Marshal(jobData)
 	if err != nil {
 		s.logger.Error("failed to marshal %T: %v", jobData, err)
@@ -222,7 +684,7 @@ func (s *Server) handleUpdateAccountBalance(w http.ResponseWriter, r *http.Reque
 		Data:        jobDataB,
 		CreatedBy:   data.JobUser,
 	}); err != nil {
-		s.logger.Error("failed to add transfer job: %v", err)
+		s.logger.Error("failed to add %s job: %v", jobType, err)
 		s.replyUnexpectedErr(w)
 		return
 	}
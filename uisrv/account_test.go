@@ -3,15 +3,18 @@ package uisrv
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 
 	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/hdwallet"
 )
 
 func TestUpdateAccountCheckAvailableBalance(t *testing.T) {
@@ -25,7 +28,7 @@ func TestUpdateAccountCheckAvailableBalance(t *testing.T) {
 		id          string
 		action      string
 		destination string
-		amount      uint
+		amount      uint64
 	}{
 		// Wrong destination.
 		{
@@ -81,11 +84,108 @@ func TestUpdateAccountCheckAvailableBalance(t *testing.T) {
 		data.JobPreAccountAddBalanceApprove)
 }
 
+func TestWithdrawAccountBalance(t *testing.T) {
+	defer cleanDB(t)
+	setTestUserCredentials(t)
+
+	acc := data.NewTestAccount(testPassword)
+	insertItems(t, acc)
+
+	one := data.NewAmount(1)
+	to := "0x0000000000000000000000000000000000000005"
+	path := fmt.Sprint(accountsPath, acc.ID, "/status")
+
+	for _, payload := range []*accountBalancePayload{
+		// Wrong amount.
+		{Action: accountWithdraw, Currency: currencyETH, To: to},
+		// Wrong currency.
+		{Action: accountWithdraw, Amount: one, Currency: "psc", To: to},
+		// Wrong address.
+		{Action: accountWithdraw, Amount: one, Currency: currencyETH,
+			To: "0x5"},
+		{Action: accountWithdraw, Amount: one, Currency: currencyPTC,
+			To: "0x0000000000000000000000000000000000000000"},
+	} {
+		res := sendPayload(t, http.MethodPut, path, payload)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("got: %d for: %+v", res.StatusCode, payload)
+		}
+	}
+
+	for currency, jobType := range map[string]string{
+		currencyETH: data.JobPreAccountWithdrawETH,
+		currencyPTC: data.JobPreAccountWithdrawPTC,
+	} {
+		res := sendPayload(t, http.MethodPut, path,
+			&accountBalancePayload{
+				Action:   accountWithdraw,
+				Amount:   one,
+				Currency: currency,
+				To:       to,
+			})
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("got: ", res.Status)
+		}
+
+		job := &data.Job{}
+		data.FindInTestDB(t, testServer.db, job, "type", jobType)
+
+		jobData := &data.JobWithdrawData{}
+		if err := json.Unmarshal(job.Data, jobData); err != nil {
+			t.Fatal(err)
+		}
+		if jobData.Amount.Cmp(one) != 0 || jobData.To != data.FromBytes(
+			common.HexToAddress(to).Bytes()) {
+			t.Fatalf("wrong job data: %+v", jobData)
+		}
+	}
+}
+
+func TestAccountNetworkFee(t *testing.T) {
+	defer cleanDB(t)
+	setTestUserCredentials(t)
+
+	acc := data.NewTestAccount(testPassword)
+	insertItems(t, acc)
+
+	path := fmt.Sprint(accountsPath, acc.ID, "/status")
+
+	res := sendPayload(t, http.MethodPut, path, &accountBalancePayload{
+		Action:     accountSetNetworkFee,
+		NetworkFee: 5,
+	})
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("got: ", res.Status)
+	}
+
+	job := &data.Job{}
+	data.FindInTestDB(t, testServer.db, job, "type",
+		data.JobPreAccountSetNetworkFee)
+
+	jobData := &data.JobNetworkFeeData{}
+	if err := json.Unmarshal(job.Data, jobData); err != nil {
+		t.Fatal(err)
+	}
+	if jobData.NetworkFee != 5 || job.RelatedID != acc.ID {
+		t.Fatalf("wrong job: %+v", job)
+	}
+
+	res = sendPayload(t, http.MethodPut, path, &accountBalancePayload{
+		Action: accountUpdateNetworkFee,
+	})
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("got: ", res.Status)
+	}
+
+	data.FindInTestDB(t, testServer.db, &data.Job{}, "type",
+		data.JobAccountUpdateNetworkFee)
+}
+
 func sendAccountBalanceAction(t *testing.T,
-	id, destination string, amount uint) *http.Response {
+	id, destination string, amount uint64) *http.Response {
 	path := fmt.Sprint(accountsPath, id, "/status")
 	payload := &accountBalancePayload{
-		Amount:      amount,
+		Amount:      data.NewAmount(amount),
 		Destination: destination,
 	}
 	return sendPayload(t, http.MethodPut, path, payload)
@@ -146,7 +246,7 @@ func testAccountFields(
 		t.Fatalf("could not extract private key from payload: %v", err)
 	}
 
-	createdKey, err := data.TestToPrivateKey(created.PrivateKey, testPassword)
+	createdKey, err := data.TestToPrivateKey(*created.PrivateKey, testPassword)
 	if err != nil {
 		t.Fatal("failed to decrypt created account's private key: ", err)
 	}
@@ -197,13 +297,61 @@ func TestCreateAccount(t *testing.T) {
 	testCreateAccount(t, true)
 }
 
+func TestCreateKeystoreAccount(t *testing.T) {
+	defer cleanDB(t)
+	setTestUserCredentials(t)
+
+	testkey, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(testkey.PublicKey)
+	payload := &accountCreatePayload{EthAddr: addr.Hex(), Name: "Test account"}
+
+	// Key is not in the keystore.
+	res := sendPayload(t, http.MethodPost, accountsPath, payload)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("response: %d, wanted: %d",
+			res.StatusCode, http.StatusBadRequest)
+	}
+
+	testKeystore[addr] = testkey
+	defer delete(testKeystore, addr)
+
+	res = sendPayload(t, http.MethodPost, accountsPath, payload)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("response: %d, wanted: %d",
+			res.StatusCode, http.StatusCreated)
+	}
+
+	reply := &replyEntity{}
+	json.NewDecoder(res.Body).Decode(reply)
+	defer res.Body.Close()
+
+	created := &data.Account{}
+	data.FindInTestDB(t, testServer.db, created, "id", reply.ID)
+
+	pubB := crypto.FromECDSAPub(&testkey.PublicKey)
+	if created.PrivateKey != nil ||
+		created.PublicKey != data.FromBytes(pubB) ||
+		created.EthAddr != data.FromBytes(addr.Bytes()) {
+		t.Fatalf("wrong keystore account stored: %+v", created)
+	}
+
+	// Keys kept in the keystore can not be exported.
+	res = sendPayload(t, http.MethodGet,
+		accountsPath+created.ID+"/pkey", nil)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("response: %d, wanted: %d",
+			res.StatusCode, http.StatusBadRequest)
+	}
+}
+
 func TestExportAccountPrivateKey(t *testing.T) {
 	defer cleanDB(t)
 	setTestUserCredentials(t)
 
 	acc := data.NewTestAccount(testPassword)
 	expectedBytes := []byte(`{"hello": "world"}`)
-	acc.PrivateKey = data.FromBytes(expectedBytes)
+	encrypted := data.FromBytes(expectedBytes)
+	acc.PrivateKey = &encrypted
 	insertItems(t, acc)
 
 	res := sendPayload(t, http.MethodGet, accountsPath+acc.ID+"/pkey", nil)
@@ -216,6 +364,103 @@ func TestExportAccountPrivateKey(t *testing.T) {
 	if !bytes.Equal(body, expectedBytes) {
 		t.Fatalf("wrong pkey exported: expected %x got %x", expectedBytes, body)
 	}
+
+	// Test the export was recorded.
+	export := &data.KeyExport{}
+	data.FindInTestDB(t, testServer.db, export, "account", acc.ID)
+	if export.EthAddr != acc.EthAddr || export.RemoteAddr == "" {
+		t.Fatalf("wrong export record: %+v", export)
+	}
+}
+
+func TestUpdateAccount(t *testing.T) {
+	fixture := data.NewTestFixture(t, testServer.db)
+	defer fixture.Close()
+	defer setTestUserCredentials(t)()
+
+	minEthBalance := data.NewAmount(100)
+	maxDailySpend := data.NewAmount(50)
+
+	payload := &accountUpdatePayload{
+		ID:            fixture.Account.ID,
+		IsDefault:     fixture.Account.IsDefault,
+		InUse:         false,
+		Name:          "new-name",
+		MinEthBalance: &minEthBalance,
+		MaxDailySpend: &maxDailySpend,
+	}
+
+	// Channel of the offering is open.
+	res := sendPayload(t, http.MethodPut, accountsPath, payload)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("wanted: %d, got: %v", http.StatusBadRequest, res.Status)
+	}
+
+	fixture.Offering.OfferStatus = data.OfferRemove
+	data.SaveToTestDB(t, testServer.db, fixture.Offering)
+
+	res = sendPayload(t, http.MethodPut, accountsPath, payload)
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("got: ", res.Status)
+	}
+
+	acc := &data.Account{}
+	data.FindInTestDB(t, testServer.db, acc, "id", fixture.Account.ID)
+	if acc.InUse || acc.Name != payload.Name ||
+		acc.MinEthBalance == nil ||
+		acc.MinEthBalance.Cmp(minEthBalance) != 0 ||
+		acc.MaxDailySpend == nil ||
+		acc.MaxDailySpend.Cmp(maxDailySpend) != 0 ||
+		acc.PrivateKey == nil ||
+		*acc.PrivateKey != *fixture.Account.PrivateKey {
+		t.Fatalf("account is not updated properly: %+v", acc)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	defer cleanDB(t)
+	setTestUserCredentials(t)
+
+	acc := data.NewTestAccount(testPassword)
+	acc.PSCBalance = data.NewAmount(1)
+	ch := createTestChannel(t)
+	ch.Client = acc.EthAddr
+	job := data.NewTestJob(data.JobPreAccountReturnBalance,
+		data.JobUser, data.JobAccount)
+	job.RelatedID = acc.ID
+	// Balance checks do not prevent deletion.
+	checkJob := data.NewTestJob(data.JobAccountAddCheckBalance,
+		data.JobBalanceChecker, data.JobAccount)
+	checkJob.RelatedID = acc.ID
+	insertItems(t, acc, job, checkJob)
+	data.SaveToTestDB(t, testServer.db, ch)
+
+	path := accountsPath + acc.ID
+
+	for _, unblock := range []func(){
+		func() { acc.PSCBalance = data.Amount{} },
+		func() { ch.ChannelStatus = data.ChannelClosedCoop },
+		func() { job.Status = data.JobDone },
+	} {
+		res := sendPayload(t, http.MethodDelete, path, nil)
+		if res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("wanted: %d, got: %v",
+				http.StatusBadRequest, res.Status)
+		}
+
+		unblock()
+		data.SaveToTestDB(t, testServer.db, acc, ch, job)
+	}
+
+	res := sendPayload(t, http.MethodDelete, path, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("got: ", res.Status)
+	}
+
+	if err := testServer.db.FindByPrimaryKeyTo(&data.Account{},
+		acc.ID); err != sql.ErrNoRows {
+		t.Fatal("account is not deleted: ", err)
+	}
 }
 
 func TestGetAccounts(t *testing.T) {
@@ -238,3 +483,94 @@ func TestGetAccounts(t *testing.T) {
 	res = getResources(t, accountsPath, map[string]string{"id": acc1.ID})
 	testGetResources(t, res, 1)
 }
+
+func createTestHDAccount(t *testing.T, mnemonic string,
+	index uint32, name string) *data.Account {
+	payload := &accountCreatePayload{
+		Mnemonic: mnemonic,
+		HDIndex:  index,
+		InUse:    true,
+		Name:     name,
+	}
+
+	res := sendPayload(t, http.MethodPost, accountsPath, payload)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("response: %d, wanted: %d",
+			res.StatusCode, http.StatusCreated)
+	}
+
+	reply := &replyEntity{}
+	json.NewDecoder(res.Body).Decode(reply)
+	defer res.Body.Close()
+
+	created := &data.Account{}
+	data.FindInTestDB(t, testServer.db, created, "id", reply.ID)
+
+	if created.HDWallet == nil || created.HDIndex == nil ||
+		*created.HDIndex != index {
+		t.Fatal("wrong derivation metadata stored")
+	}
+
+	wallet, err := hdwallet.NewWallet(mnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := wallet.Derive(hdwallet.AccountPath(hdwallet.BasePath, index))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createdKey, err := data.TestToPrivateKey(*created.PrivateKey, testPassword)
+	if err != nil {
+		t.Fatal("failed to decrypt created account's private key: ", err)
+	}
+
+	if !equalECDSA(key, createdKey) {
+		t.Fatal("wrong private key stored")
+	}
+
+	return created
+}
+
+func TestCreateAccountFromMnemonic(t *testing.T) {
+	defer cleanDB(t)
+	setTestUserCredentials(t)
+
+	res := getResources(t, mnemonicPath, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("failed to get mnemonic: ", res.StatusCode)
+	}
+
+	reply := &mnemonicReply{}
+	json.NewDecoder(res.Body).Decode(reply)
+	defer res.Body.Close()
+
+	acc1 := createTestHDAccount(t, reply.Mnemonic, 0, "Test account 1")
+	acc2 := createTestHDAccount(t, reply.Mnemonic, 1, "Test account 2")
+
+	// Indexes of hardened keys don't fit into a signed 32-bit integer.
+	createTestHDAccount(t, reply.Mnemonic, 1<<31, "Test account 3")
+
+	if *acc1.HDWallet != *acc2.HDWallet {
+		t.Fatal("accounts of same mnemonic in different wallets")
+	}
+
+	wallet := &data.HDWallet{}
+	data.FindInTestDB(t, testServer.db, wallet, "id", *acc1.HDWallet)
+	if wallet.BasePath != hdwallet.BasePath.String() {
+		t.Fatal("wrong base path stored")
+	}
+
+	// Same index can not be derived twice.
+	res = sendPayload(t, http.MethodPost, accountsPath,
+		&accountCreatePayload{Mnemonic: reply.Mnemonic, Name: "Test"})
+	if res.StatusCode == http.StatusCreated {
+		t.Fatal("account derived twice")
+	}
+
+	res = sendPayload(t, http.MethodPost, accountsPath,
+		&accountCreatePayload{Mnemonic: "foo bar", Name: "Test"})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatal("account created from invalid mnemonic")
+	}
+}
@@ -0,0 +1,122 @@
+package uisrv
+
+import (
+	"net/http"
+
+	"github.com/privatix/dappctrl/data"
+)
+
+// Kinds of account balance alerts.
+const (
+	alertLowEthBalance = "lowEthBalance"
+	alertLowPTCBalance = "lowPtcBalance"
+	alertLowPSCBalance = "lowPscBalance"
+)
+
+// accountAlert is an alert about an account balance below its threshold.
+type accountAlert struct {
+	Account   string      `json:"account"`
+	Kind      string      `json:"kind"`
+	Balance   data.Amount `json:"balance"`
+	Threshold data.Amount `json:"threshold"`
+}
+
+// handleGetAlerts replies with balance alerts of all accounts.
+func (s *Server) handleGetAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	gasPrice, err := s.gasOracle.GasPrice()
+	if err != nil {
+		s.logger.Error("failed to get recommended gas price: %v", err)
+		s.replyUnexpectedErr(w)
+		return
+	}
+
+	accs, err := s.db.SelectAllFrom(data.AccountTable, "")
+	if err != nil {
+		s.logger.Error("failed to select accounts: %v", err)
+		s.replyUnexpectedErr(w)
+		return
+	}
+
+	alerts := []accountAlert{}
+	for _, v := range accs {
+		alerts = append(alerts,
+			s.balanceAlerts(v.(*data.Account), gasPrice)...)
+	}
+
+	s.reply(w, alerts)
+}
+
+// minEthBalance returns an eth balance alert threshold of an account. Unless
+// set for the account, it is enough eth to pay for a configured amount of gas
+// at a given price.
+func (s *Server) minEthBalance(acc *data.Account,
+	gasPrice uint64) data.Amount {
+	if acc.MinEthBalance != nil {
+		return *acc.MinEthBalance
+	}
+
+	return data.NewAmount(s.conf.MinEthGas).Mul(data.NewAmount(gasPrice))
+}
+
+func (s *Server) balanceAlerts(acc *data.Account,
+	gasPrice uint64) []accountAlert {
+	var alerts []accountAlert
+	check := func(kind string, balance, threshold data.Amount) {
+		if balance.Cmp(threshold) < 0 {
+			alerts = append(alerts, accountAlert{
+				Account:   acc.ID,
+				Kind:      kind,
+				Balance:   balance,
+				Threshold: threshold,
+			})
+		}
+	}
+
+	check(alertLowEthBalance, acc.EthBalance, s.minEthBalance(acc, gasPrice))
+
+	if acc.MinPTCBalance != nil {
+		check(alertLowPTCBalance, acc.PTCBalance, *acc.MinPTCBalance)
+	}
+
+	if acc.MinPSCBalance != nil {
+		check(alertLowPSCBalance, acc.PSCBalance, *acc.MinPSCBalance)
+	}
+
+	return alerts
+}
+
+// canAffordGas checks that an agent account has enough eth to pay for gas at
+// a given price. Zero price means a recommended one.
+func (s *Server) canAffordGas(w http.ResponseWriter, agent string,
+	gasPrice uint64) bool {
+	acc := &data.Account{}
+	if err := s.db.FindOneTo(acc, "eth_addr", agent); err != nil {
+		s.logger.Error("failed to find agent account: %v", err)
+		s.replyUnexpectedErr(w)
+		return false
+	}
+
+	var err error
+	if gasPrice == 0 {
+		if gasPrice, err = s.gasOracle.GasPrice(); err != nil {
+			s.logger.Error("failed to get recommended gas price: %v",
+				err)
+			s.replyUnexpectedErr(w)
+			return false
+		}
+	}
+
+	if acc.EthBalance.Cmp(s.minEthBalance(acc, gasPrice)) < 0 {
+		s.replyErr(w, http.StatusBadRequest, &serverError{
+			Message: "insufficient eth balance to pay for gas",
+		})
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,67 @@
+// +build !noagentuisrvtest
+
+package uisrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/privatix/dappctrl/data"
+)
+
+func TestGetAlerts(t *testing.T) {
+	defer cleanDB(t)
+	setTestUserCredentials(t)
+
+	// Threshold does not fit into int64.
+	var zero, minPTC = data.Amount{}, data.NewAmount(^uint64(0)).Add(
+		data.NewAmount(10))
+
+	// Default eth threshold is not met.
+	lowEth := data.NewTestAccount(testPassword)
+	// Custom thresholds, eth is met, ptc is not.
+	lowPTC := data.NewTestAccount(testPassword)
+	lowPTC.MinEthBalance = &zero
+	lowPTC.MinPTCBalance = &minPTC
+	lowPTC.PTCBalance = minPTC.Sub(data.NewAmount(1))
+	// No alerts.
+	ok := data.NewTestAccount(testPassword)
+	ok.MinEthBalance = &zero
+	ok.MinPTCBalance = &minPTC
+	ok.PTCBalance = minPTC
+	insertItems(t, lowEth, lowPTC, ok)
+
+	res := getResources(t, alertsPath, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("failed to get alerts: ", res.StatusCode)
+	}
+
+	var alerts []accountAlert
+	if err := json.NewDecoder(res.Body).Decode(&alerts); err != nil {
+		t.Fatal("failed to decode reply: ", err)
+	}
+
+	if len(alerts) != 2 {
+		t.Fatalf("wrong number of alerts: %+v", alerts)
+	}
+
+	for _, v := range alerts {
+		switch v.Account {
+		case lowEth.ID:
+			if v.Kind != alertLowEthBalance || v.Threshold.Cmp(
+				data.NewAmount(testServer.conf.MinEthGas*
+					testGasPrice)) != 0 {
+				t.Fatalf("wrong eth alert: %+v", v)
+			}
+		case lowPTC.ID:
+			if v.Kind != alertLowPTCBalance ||
+				v.Balance.Cmp(lowPTC.PTCBalance) != 0 ||
+				v.Threshold.Cmp(minPTC) != 0 {
+				t.Fatalf("wrong ptc alert: %+v", v)
+			}
+		default:
+			t.Fatalf("unexpected alert: %+v", v)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	reform "gopkg.in/reform.v1"
 
 	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/signer"
 	"github.com/privatix/dappctrl/util"
 )
 
@@ -99,11 +100,96 @@ func (s *Server) handleUpdatePassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !s.deleteTx(w, &data.Setting{Key: saltKey}, tx) ||
-		!s.deleteTx(w, &data.Setting{Key: passwordKey}, tx) {
+		!s.deleteTx(w, &data.Setting{Key: passwordKey}, tx) ||
+		!s.reencryptAccountKeys(w, payload.Current, payload.New, tx) ||
+		!s.updateSignerPassword(w, payload.Current, payload.New, tx) {
 		return
 	}
 
-	s.setPassword(w, payload.New, tx)
+	if !s.setPassword(w, payload.New, tx) {
+		s.restoreSignerPassword(payload.New, payload.Current)
+		return
+	}
+
+	s.pwdStorage.Set(payload.New)
+}
+
+// reencryptAccountKeys encrypts private keys of all accounts with a new
+// password. Transaction is rolled back if any of the keys fails. Keys kept
+// in a signer keystore are updated by updateSignerPassword.
+func (s *Server) reencryptAccountKeys(w http.ResponseWriter,
+	oldPwd, newPwd string, tx *reform.TX) bool {
+	accounts, err := tx.SelectAllFrom(data.AccountTable, "FOR UPDATE")
+	if err != nil {
+		tx.Rollback()
+		s.logger.Error("failed to select accounts: %v", err)
+		s.replyUnexpectedErr(w)
+		return false
+	}
+
+	for _, v := range accounts {
+		acc := v.(*data.Account)
+		if acc.PrivateKey == nil {
+			continue
+		}
+
+		key, err := s.decryptKeyFunc(*acc.PrivateKey, oldPwd)
+		if err != nil {
+			tx.Rollback()
+			s.logger.Error("failed to decrypt key of account %s: %v",
+				acc.ID, err)
+			s.replyUnexpectedErr(w)
+			return false
+		}
+
+		encrypted, err := s.encryptKeyFunc(key, newPwd)
+		if err != nil {
+			tx.Rollback()
+			s.logger.Error("failed to encrypt key of account %s: %v",
+				acc.ID, err)
+			s.replyUnexpectedErr(w)
+			return false
+		}
+		acc.PrivateKey = &encrypted
+
+		if !s.updateTx(w, acc, tx) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// updateSignerPassword encrypts keys kept by a signer outside of the database
+// with a new password. Transaction is rolled back if the signer fails.
+func (s *Server) updateSignerPassword(w http.ResponseWriter,
+	oldPwd, newPwd string, tx *reform.TX) bool {
+	updater, ok := s.signer.(signer.PasswordUpdater)
+	if !ok {
+		return true
+	}
+
+	if err := updater.UpdatePassword(oldPwd, newPwd); err != nil {
+		tx.Rollback()
+		s.logger.Error("failed to update signer password: %v", err)
+		s.replyUnexpectedErr(w)
+		return false
+	}
+
+	return true
+}
+
+// restoreSignerPassword reverts updateSignerPassword if the password change
+// is not committed.
+func (s *Server) restoreSignerPassword(newPwd, oldPwd string) {
+	updater, ok := s.signer.(signer.PasswordUpdater)
+	if !ok {
+		return
+	}
+
+	if err := updater.UpdatePassword(newPwd, oldPwd); err != nil {
+		s.logger.Error("failed to restore signer password: %v", err)
+	}
 }
 
 func (s *Server) parseNewPasswordPayload(w http.ResponseWriter,
@@ -187,6 +273,7 @@ func (s *Server) setPassword(w http.ResponseWriter, password string, tx *reform.
 
 	hashed, err := data.HashPassword(password, salt)
 	if err != nil {
+		tx.Rollback()
 		s.logger.Error("failed to hash password: %v", err)
 		s.replyUnexpectedErr(w)
 		return false
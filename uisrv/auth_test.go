@@ -4,6 +4,7 @@ package uisrv
 
 import (
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -73,6 +74,116 @@ func TestUpdatePassword(t *testing.T) {
 	testPasswordMatchesWithStored(t, updatedPwd)
 }
 
+func TestUpdatePasswordReencryptsKeys(t *testing.T) {
+	defer cleanDB(t)
+
+	password := insertTestPassword(t)
+	acc := data.NewTestAccount(password)
+	insertItems(t, acc)
+
+	updatedPwd := password + "-updated"
+
+	sendUpdatedPasswordAndTestStatus(t,
+		&newPasswordPayload{password, updatedPwd}, http.StatusOK)
+
+	data.ReloadFromTestDB(t, testServer.db, acc)
+	if _, err := testServer.decryptKeyFunc(
+		*acc.PrivateKey, updatedPwd); err != nil {
+		t.Fatal("key is not encrypted with new password: ", err)
+	}
+
+	if testServer.pwdStorage.Get() != updatedPwd {
+		t.Fatal("password storage is not updated")
+	}
+}
+
+func TestUpdatePasswordRollback(t *testing.T) {
+	defer cleanDB(t)
+
+	password := insertTestPassword(t)
+	acc := data.NewTestAccount(password)
+	// Key encrypted with another password cannot be reencrypted.
+	brokenAcc := data.NewTestAccount("another-password")
+	insertItems(t, acc, brokenAcc)
+
+	sendUpdatedPasswordAndTestStatus(t,
+		&newPasswordPayload{password, password + "-updated"},
+		http.StatusInternalServerError)
+
+	testPasswordMatchesWithStored(t, password)
+
+	data.ReloadFromTestDB(t, testServer.db, acc)
+	if _, err := testServer.decryptKeyFunc(
+		*acc.PrivateKey, password); err != nil {
+		t.Fatal("key update is not rolled back: ", err)
+	}
+}
+
+// testPasswordSigner records password updates of signer keys.
+type testPasswordSigner struct {
+	testSigner
+	pwd string
+	err error
+}
+
+func (s *testPasswordSigner) UpdatePassword(oldPwd, newPwd string) error {
+	if s.err != nil {
+		return s.err
+	}
+	if oldPwd != s.pwd {
+		return errors.New("wrong password")
+	}
+	s.pwd = newPwd
+	return nil
+}
+
+func setTestPasswordSigner(s *testPasswordSigner) func() {
+	old := testServer.signer
+	testServer.signer = s
+	return func() { testServer.signer = old }
+}
+
+func TestUpdatePasswordUpdatesSigner(t *testing.T) {
+	defer cleanDB(t)
+
+	password := insertTestPassword(t)
+	s := &testPasswordSigner{testSigner: testKeystore, pwd: password}
+	defer setTestPasswordSigner(s)()
+
+	updatedPwd := password + "-updated"
+
+	sendUpdatedPasswordAndTestStatus(t,
+		&newPasswordPayload{password, updatedPwd}, http.StatusOK)
+
+	if s.pwd != updatedPwd {
+		t.Fatal("signer password is not updated")
+	}
+}
+
+func TestUpdatePasswordSignerFailure(t *testing.T) {
+	defer cleanDB(t)
+
+	password := insertTestPassword(t)
+	acc := data.NewTestAccount(password)
+	insertItems(t, acc)
+
+	s := &testPasswordSigner{testSigner: testKeystore,
+		err: errors.New("some error")}
+	defer setTestPasswordSigner(s)()
+
+	sendUpdatedPasswordAndTestStatus(t,
+		&newPasswordPayload{password, password + "-updated"},
+		http.StatusInternalServerError)
+
+	testPasswordMatchesWithStored(t, password)
+
+	data.ReloadFromTestDB(t, testServer.db, acc)
+	if _, err := testServer.decryptKeyFunc(
+		*acc.PrivateKey, password); err != nil {
+		t.Fatal("key update is not rolled back: ", err)
+	}
+}
+
 func TestUpdatePasswordWrongCurrentPassword(t *testing.T) {
 	defer cleanDB(t)
 
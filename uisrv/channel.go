@@ -3,7 +3,11 @@ package uisrv
 import (
 	"net/http"
 
+	"gopkg.in/reform.v1"
+
+	"github.com/privatix/dappctrl/client/budget"
 	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/util"
 )
 
 var channelsGetParams = []queryParam{
@@ -11,23 +15,46 @@ var channelsGetParams = []queryParam{
 	{Name: "serviceStatus", Field: "service_status"},
 }
 
+// channelHandler handles a request for a channel sub-resource.
+type channelHandler func(s *Server, w http.ResponseWriter,
+	r *http.Request, id string)
+
+// channelSubPaths are handlers of channel sub-resources, such as
+// "/channels/<id>/events", by sub-path and request method.
+var channelSubPaths = map[string]map[string]channelHandler{
+	"status": {
+		http.MethodGet: (*Server).handleGetChannelStatus,
+		http.MethodPut: (*Server).handlePutChannelStatus,
+	},
+	"events": {
+		http.MethodGet: (*Server).handleGetChannelEvents,
+	},
+	"cheques": {
+		http.MethodGet: (*Server).handleGetChannelCheques,
+	},
+	"budget": {
+		http.MethodGet: (*Server).handleGetChannelBudget,
+		http.MethodPut: (*Server).handlePutChannelBudget,
+	},
+}
+
 // handleChannels calls appropriate handler by scanning incoming request.
 func (s *Server) handleChannels(w http.ResponseWriter, r *http.Request) {
-	if id := idFromStatusPath(channelsPath, r.URL.Path); id != "" {
-		if r.Method == "GET" {
-			s.handleGetChannelStatus(w, r, id)
-			return
-		}
-		if r.Method == "PUT" {
-			s.handlePutChannelStatus(w, r, id)
-			return
-		}
-	} else {
-		if r.Method == "GET" {
-			s.handleGetChannels(w, r)
+	for sub, handlers := range channelSubPaths {
+		if id := idFromSubPath(channelsPath, r.URL.Path, sub); id != "" {
+			if handler, ok := handlers[r.Method]; ok {
+				handler(s, w, r, id)
+				return
+			}
+			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
 	}
+
+	if r.Method == "GET" {
+		s.handleGetChannels(w, r)
+		return
+	}
 	w.WriteHeader(http.StatusMethodNotAllowed)
 }
 
@@ -63,10 +90,115 @@ func (s *Server) handleGetChannelStatus(w http.ResponseWriter, r *http.Request,
 	s.replyStatus(w, channel.ChannelStatus)
 }
 
+// handleGetChannelSub replies with records of a view which belong to
+// a channel in chronological order.
+func (s *Server) handleGetChannelSub(w http.ResponseWriter,
+	view reform.View, id string) {
+	if !util.IsUUID(id) {
+		s.replyNotFound(w)
+		return
+	}
+
+	if !s.findTo(w, &data.Channel{}, id) {
+		return
+	}
+
+	recs, err := s.db.SelectAllFrom(view,
+		"WHERE channel = $1 ORDER BY created_at", id)
+	if err != nil {
+		s.logger.Error("failed to select %s of channel: %v",
+			view.Name(), err)
+		s.replyUnexpectedErr(w)
+		return
+	}
+
+	if recs == nil {
+		recs = []reform.Struct{}
+	}
+
+	s.reply(w, recs)
+}
+
+// handleGetChannelEvents replies with status transitions of a channel in
+// chronological order.
+func (s *Server) handleGetChannelEvents(w http.ResponseWriter,
+	r *http.Request, id string) {
+	s.handleGetChannelSub(w, data.ChannelEventTable, id)
+}
+
+// handleGetChannelCheques replies with payment cheques of a client channel
+// in chronological order.
+func (s *Server) handleGetChannelCheques(w http.ResponseWriter,
+	r *http.Request, id string) {
+	s.handleGetChannelSub(w, data.ChequeTable, id)
+}
+
+// handleGetChannelBudget replies with a budget state of a client channel.
+func (s *Server) handleGetChannelBudget(w http.ResponseWriter,
+	r *http.Request, id string) {
+	if !util.IsUUID(id) {
+		s.replyNotFound(w)
+		return
+	}
+
+	ch := &data.Channel{}
+	if !s.findTo(w, ch, id) {
+		return
+	}
+
+	st, err := budget.NewState(s.db.Querier, ch)
+	if err != nil {
+		s.logger.Error("failed to get channel budget: %v", err)
+		s.replyUnexpectedErr(w)
+		return
+	}
+
+	s.reply(w, st)
+}
+
+// channelBudgetPayload is a channel budget update payload. Nil spending cap
+// means no cap.
+type channelBudgetPayload struct {
+	MaxSpend *data.Amount `json:"maxSpend"`
+}
+
+// handlePutChannelBudget sets a spending cap of a client channel.
+func (s *Server) handlePutChannelBudget(w http.ResponseWriter,
+	r *http.Request, id string) {
+	if !util.IsUUID(id) {
+		s.replyNotFound(w)
+		return
+	}
+
+	payload := &channelBudgetPayload{}
+	if !s.parsePayload(w, r, payload) {
+		return
+	}
+
+	tx, ok := s.begin(w)
+	if !ok {
+		return
+	}
+
+	ch := &data.Channel{}
+	if !s.findForUpdateTx(w, ch, id, tx) {
+		return
+	}
+
+	ch.MaxSpend = payload.MaxSpend
+
+	if !s.updateTx(w, ch, tx) || !s.commit(w, tx) {
+		return
+	}
+
+	s.replyEntityUpdated(w, ch.ID)
+}
+
 const (
 	channelTerminate = "terminate"
 	channelPause     = "pause"
 	channelResume    = "resume"
+	channelClose     = "close"
 )
 
 func (s *Server) handlePutChannelStatus(w http.ResponseWriter, r *http.Request, id string) {
@@ -81,6 +213,7 @@ func (s *Server) handlePutChannelStatus(w http.ResponseWriter, r *http.Request,
 		channelTerminate: data.JobAgentPreServiceTerminate,
 		channelPause:     data.JobAgentPreServiceSuspend,
 		channelResume:    data.JobAgentPreServiceUnsuspend,
+		channelClose:     data.JobClientPreCooperativeClose,
 	}
 
 	jobType, ok := jobTypes[payload.Action]
@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
+	"github.com/privatix/dappctrl/client/budget"
 	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/proc/state"
 	"github.com/privatix/dappctrl/util"
 )
 
@@ -121,4 +124,145 @@ func TestUpdateChannelStatus(t *testing.T) {
 	testJobCreated(channelTerminate, data.JobAgentPreServiceTerminate)
 	testJobCreated(channelPause, data.JobAgentPreServiceSuspend)
 	testJobCreated(channelResume, data.JobAgentPreServiceUnsuspend)
+	testJobCreated(channelClose, data.JobClientPreCooperativeClose)
+}
+
+func TestGetChannelEvents(t *testing.T) {
+	defer cleanDB(t)
+	setTestUserCredentials(t)
+
+	ch := createTestChannel(t)
+
+	tx, err := testServer.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Update(tx, ch, ch.ChannelStatus,
+		data.ServiceActive, data.JobUser, nil); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err := state.Update(tx, ch, ch.ChannelStatus,
+		data.ServiceSuspended, data.JobBillingChecker, nil); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	res := getResources(t, channelsPath+ch.ID+"/events", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("failed to get channel events: ", res.StatusCode)
+	}
+
+	var events []data.ChannelEvent
+	if err := json.NewDecoder(res.Body).Decode(&events); err != nil {
+		t.Fatal("failed to decode reply: ", err)
+	}
+
+	if len(events) != 2 ||
+		events[0].NewServiceStatus != data.ServiceActive ||
+		events[0].Cause != data.JobUser ||
+		events[1].OldServiceStatus == nil ||
+		*events[1].OldServiceStatus != data.ServiceActive ||
+		events[1].NewServiceStatus != data.ServiceSuspended ||
+		events[1].Cause != data.JobBillingChecker {
+		t.Fatalf("wrong channel events: %+v", events)
+	}
+
+	res = getResources(t, channelsPath+util.NewUUID()+"/events", nil)
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected not found, got: %d", res.StatusCode)
+	}
+}
+
+func TestGetChannelCheques(t *testing.T) {
+	defer cleanDB(t)
+	setTestUserCredentials(t)
+
+	ch := createTestChannel(t)
+
+	created := time.Now()
+	acknowledged := created.Add(time.Second)
+	insertItems(t, &data.Cheque{
+		ID:          util.NewUUID(),
+		Channel:     ch.ID,
+		Amount:      data.NewAmount(5),
+		Status:      data.ChequeSuperseded,
+		NextAttempt: created,
+		CreatedAt:   created,
+	}, &data.Cheque{
+		ID:             util.NewUUID(),
+		Channel:        ch.ID,
+		Amount:         data.NewAmount(7),
+		Status:         data.ChequeAcknowledged,
+		NextAttempt:    acknowledged,
+		CreatedAt:      acknowledged,
+		AcknowledgedAt: &acknowledged,
+	})
+
+	res := getResources(t, channelsPath+ch.ID+"/cheques", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("failed to get channel cheques: ", res.StatusCode)
+	}
+
+	var cheques []data.Cheque
+	if err := json.NewDecoder(res.Body).Decode(&cheques); err != nil {
+		t.Fatal("failed to decode reply: ", err)
+	}
+
+	if len(cheques) != 2 ||
+		cheques[0].Status != data.ChequeSuperseded ||
+		cheques[0].Amount.Cmp(data.NewAmount(5)) != 0 ||
+		cheques[1].Status != data.ChequeAcknowledged ||
+		cheques[1].Amount.Cmp(data.NewAmount(7)) != 0 {
+		t.Fatalf("wrong channel cheques: %+v", cheques)
+	}
+
+	res = getResources(t, channelsPath+util.NewUUID()+"/cheques", nil)
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected not found, got: %d", res.StatusCode)
+	}
+}
+
+func TestChannelBudget(t *testing.T) {
+	fixture := data.NewTestFixture(t, testServer.db)
+	defer fixture.Close()
+	defer setTestUserCredentials(t)()
+
+	fixture.Channel.Client = fixture.Account.EthAddr
+	data.SaveToTestDB(t, testServer.db, fixture.Channel)
+
+	maxSpend := data.NewAmount(7)
+	path := channelsPath + fixture.Channel.ID + "/budget"
+	res := sendPayload(t, http.MethodPut, path,
+		&channelBudgetPayload{MaxSpend: &maxSpend})
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("failed to set channel budget: ", res.StatusCode)
+	}
+
+	res = getResources(t, path, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("failed to get channel budget: ", res.StatusCode)
+	}
+
+	var st budget.State
+	if err := json.NewDecoder(res.Body).Decode(&st); err != nil {
+		t.Fatal("failed to decode reply: ", err)
+	}
+
+	if st.Account == nil || *st.Account != fixture.Account.ID ||
+		st.MaxChannelSpend == nil ||
+		st.MaxChannelSpend.Cmp(maxSpend) != 0 ||
+		st.MaxDailySpend != nil || !st.DailySpend.IsZero() {
+		t.Fatalf("wrong channel budget: %+v", st)
+	}
+
+	res = sendPayload(t, http.MethodPut,
+		channelsPath+util.NewUUID()+"/budget",
+		&channelBudgetPayload{MaxSpend: &maxSpend})
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected not found, got: %d", res.StatusCode)
+	}
 }
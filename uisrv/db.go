@@ -40,6 +40,22 @@ func (s *Server) begin(w http.ResponseWriter) (*reform.TX, bool) {
 	return tx, true
 }
 
+func (s *Server) findForUpdateTx(w http.ResponseWriter, rec reform.Record,
+	id string, tx *reform.TX) bool {
+	if err := tx.SelectOneTo(rec, "WHERE id = $1 FOR UPDATE",
+		id); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			s.replyNotFound(w)
+			return false
+		}
+		s.logger.Error("failed to find: %v", err)
+		s.replyUnexpectedErr(w)
+		return false
+	}
+	return true
+}
+
 func (s *Server) insertTx(w http.ResponseWriter, rec reform.Record, tx *reform.TX) bool {
 	if err := tx.Insert(rec); err != nil {
 		tx.Rollback()
@@ -50,6 +66,16 @@ func (s *Server) insertTx(w http.ResponseWriter, rec reform.Record, tx *reform.T
 	return true
 }
 
+func (s *Server) updateTx(w http.ResponseWriter, rec reform.Record, tx *reform.TX) bool {
+	if err := tx.Update(rec); err != nil {
+		tx.Rollback()
+		s.logger.Error("failed to update: %v", err)
+		s.replyUnexpectedErr(w)
+		return false
+	}
+	return true
+}
+
 func (s *Server) deleteTx(w http.ResponseWriter, rec reform.Record, tx *reform.TX) bool {
 	if err := tx.Delete(rec); err != nil {
 		tx.Rollback()
@@ -0,0 +1,27 @@
+package uisrv
+
+import (
+	"net/http"
+)
+
+// GasPriceReply is a recommended gas price reply.
+type GasPriceReply struct {
+	GasPrice uint64 `json:"gasPrice"`
+}
+
+// handleGetGasPrice replies with a recommended gas price in wei.
+func (s *Server) handleGetGasPrice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	price, err := s.gasOracle.GasPrice()
+	if err != nil {
+		s.logger.Error("failed to get recommended gas price: %v", err)
+		s.replyUnexpectedErr(w)
+		return
+	}
+
+	s.reply(w, &GasPriceReply{GasPrice: price})
+}
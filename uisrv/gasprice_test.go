@@ -0,0 +1,28 @@
+// +build !noagentuisrvtest
+
+package uisrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestGetGasPrice(t *testing.T) {
+	defer cleanDB(t)
+	setTestUserCredentials(t)
+
+	res := getResources(t, gasPricePath, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatal("failed to get gas price: ", res.StatusCode)
+	}
+
+	reply := &GasPriceReply{}
+	if err := json.NewDecoder(res.Body).Decode(reply); err != nil {
+		t.Fatal("failed to decode reply: ", err)
+	}
+
+	if reply.GasPrice != testGasPrice {
+		t.Fatalf("wrong gas price: %d", reply.GasPrice)
+	}
+}
@@ -20,6 +20,7 @@ type getConf struct {
 	Params       []queryParam
 	View         reform.View
 	FilteringSQL string
+	OrderingSQL  string // Expression to order records by.
 }
 
 func (s *Server) formatConditions(r *http.Request, conf *getConf) (conds []string, args []interface{}) {
@@ -74,6 +75,10 @@ func (s *Server) handleGetResources(w http.ResponseWriter,
 		tail = "WHERE " + strings.Join(conds, " AND ")
 	}
 
+	if conf.OrderingSQL != "" {
+		tail += " ORDER BY " + conf.OrderingSQL
+	}
+
 	records, err := s.db.SelectAllFrom(conf.View, tail, args...)
 	if err != nil {
 		s.logger.Warn("failed to select: %v", err)
@@ -12,14 +12,14 @@ import (
 	"github.com/privatix/dappctrl/util"
 )
 
-func getIncome(t *testing.T, entity, id string) uint64 {
+func getIncome(t *testing.T, entity, id string) data.Amount {
 	url := fmt.Sprintf("http://:%s@%s/%s?%s=%s", testPassword,
 		testServer.conf.Addr, incomePath, entity, id)
 	r, err := http.Get(url)
 	if err != nil {
 		t.Fatalf("failed to get income: %v. %s", err, util.Caller())
 	}
-	var income uint64
+	var income data.Amount
 	if err := json.NewDecoder(r.Body).Decode(&income); err != nil {
 		t.Fatalf("could not decode income: %v, %s", err, util.Caller())
 	}
@@ -34,42 +34,43 @@ func TestIncome(t *testing.T) {
 
 	ch1 := *fixture.Channel
 	ch1.ID = util.NewUUID()
-	ch1.ReceiptBalance = 10
+	ch1.ReceiptBalance = data.NewAmount(10)
 
 	ch2 := *fixture.Channel
 	ch2.ID = util.NewUUID()
-	ch2.ReceiptBalance = 20
+	// Income does not fit into int64.
+	ch2.ReceiptBalance = data.NewAmount(^uint64(0))
 
 	data.InsertToTestDB(t, testServer.db, &ch1, &ch2)
 	defer data.DeleteFromTestDB(t, testServer.db, &ch1, &ch2)
 
-	expectedIncome := fixture.Channel.ReceiptBalance
-	expectedIncome += ch1.ReceiptBalance + ch2.ReceiptBalance
+	expectedIncome := fixture.Channel.ReceiptBalance.Add(
+		ch1.ReceiptBalance).Add(ch2.ReceiptBalance)
 
-	var incomeReturned uint64
+	var incomeReturned data.Amount
 
-	fail := func(wanted uint64) {
+	fail := func(wanted data.Amount) {
 		t.Fatalf("wanted %v, got %v. %s", wanted, incomeReturned,
 			util.Caller())
 	}
 
 	// By offering id.
 	incomeReturned = getIncome(t, usagesByOfferingID, fixture.Offering.ID)
-	if expectedIncome != incomeReturned {
+	if expectedIncome.Cmp(incomeReturned) != 0 {
 		fail(expectedIncome)
 	}
 	incomeReturned = getIncome(t, usagesByOfferingID, util.NewUUID())
-	if expectedIncome == incomeReturned {
-		fail(0)
+	if expectedIncome.Cmp(incomeReturned) == 0 {
+		fail(data.Amount{})
 	}
 
 	// By product id.
 	incomeReturned = getIncome(t, usagesByProductID, fixture.Product.ID)
-	if expectedIncome != incomeReturned {
+	if expectedIncome.Cmp(incomeReturned) != 0 {
 		fail(expectedIncome)
 	}
 	incomeReturned = getIncome(t, usagesByProductID, util.NewUUID())
-	if expectedIncome == incomeReturned {
-		fail(0)
+	if expectedIncome.Cmp(incomeReturned) == 0 {
+		fail(data.Amount{})
 	}
 }
@@ -1,12 +1,13 @@
 package uisrv
 
 import (
-	"database/sql"
 	"encoding/json"
 	"net/http"
 	"strings"
 
 	validator "gopkg.in/go-playground/validator.v9"
+
+	"github.com/privatix/dappctrl/data"
 )
 
 var (
@@ -23,12 +24,17 @@ type serverError struct {
 
 // idFromStatusPath returns id from path of format {prefix}{id}/status.
 func idFromStatusPath(prefix, path string) string {
+	return idFromSubPath(prefix, path, "status")
+}
+
+// idFromSubPath returns an id from a path like "<prefix><id>/<sub>".
+func idFromSubPath(prefix, path, sub string) string {
 	parts := strings.Split(path, prefix)
 	if len(parts) != 2 {
 		return ""
 	}
 	parts = strings.Split(parts[1], "/")
-	if len(parts) != 2 || parts[1] != "status" {
+	if len(parts) != 2 || parts[1] != sub {
 		return ""
 	}
 	return parts[0]
@@ -113,14 +119,18 @@ func (s *Server) reply(w http.ResponseWriter, v interface{}) {
 
 func (s *Server) replyNumFromQuery(w http.ResponseWriter, query, arg string) {
 	row := s.db.QueryRow(query, arg)
-	var queryRet sql.NullInt64
+	// Sums are numeric and may not fit into int64, nulls mean zero.
+	var queryRet *data.Amount
 	if err := row.Scan(&queryRet); err != nil {
 		s.logger.Error("failed to get usage: %v", err)
 		s.replyUnexpectedErr(w)
 		return
 	}
+	if queryRet == nil {
+		queryRet = &data.Amount{}
+	}
 
-	retB, err := json.Marshal(&queryRet.Int64)
+	retB, err := json.Marshal(queryRet)
 	if err != nil {
 		s.logger.Error("failed to encode usage: %v", err)
 		s.replyUnexpectedErr(w)
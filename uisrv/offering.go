@@ -168,11 +168,16 @@ func (s *Server) handlePutOfferingStatus(
 		s.replyInvalidAction(w)
 		return
 	}
-	if !s.findTo(w, &data.Offering{}, id) {
+	offering := &data.Offering{}
+	if !s.findTo(w, offering, id) {
 		return
 	}
 	s.logger.Info("action ( %v )  request for offering with id: %v recieved.", req.Action, id)
 
+	if !s.canAffordGas(w, offering.Agent, req.GasPrice) {
+		return
+	}
+
 	dataJSON, err := json.Marshal(&data.JobPublishData{GasPrice: req.GasPrice})
 	if err != nil {
 		s.logger.Error("failed to marshal job data: %v", err)
@@ -7,7 +7,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
 	"testing"
 
 	"github.com/privatix/dappctrl/data"
@@ -43,11 +42,11 @@ func validOfferingPayload() data.Offering {
 		MinUnits:           uint64(50),
 		Product:            testProd.ID,
 		ServiceName:        "my-service",
-		SetupPrice:         32,
+		SetupPrice:         data.NewAmount(32),
 		Supply:             1,
 		Template:           testTpl.ID,
 		UnitName:           "Time",
-		UnitPrice:          76,
+		UnitPrice:          data.NewAmount(76),
 		UnitType:           data.UnitSeconds,
 	}
 }
@@ -276,9 +275,9 @@ func TestGetClientOffering(t *testing.T) {
 	// all non-local offerings
 	testGetClientOfferings(t, "", "", "", 2)
 
-	lowPrice := strconv.FormatUint(off1.UnitPrice-10, 10)
-	price := strconv.FormatUint(off1.UnitPrice, 10)
-	highPrice := strconv.FormatUint(off1.UnitPrice+10, 10)
+	lowPrice := off1.UnitPrice.Sub(data.NewAmount(10)).String()
+	price := off1.UnitPrice.String()
+	highPrice := off1.UnitPrice.Add(data.NewAmount(10)).String()
 
 	// price range
 	testGetClientOfferings(t, "", "", "", 2)           // inside range
@@ -328,6 +327,16 @@ func TestPutOfferingStatus(t *testing.T) {
 		t.Fatalf("wanted: %d, got: %v", http.StatusBadRequest, res.Status)
 	}
 
+	// Agent can not afford gas.
+	res = sendOfferingAction(t, fixture.Offering.ID, PublishOffering, testGasPrice)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("wanted: %d, got: %v", http.StatusBadRequest, res.Status)
+	}
+
+	fixture.Account.EthBalance = data.NewAmount(
+		testServer.conf.MinEthGas * testGasPrice)
+	data.SaveToTestDB(t, testServer.db, fixture.Account)
+
 	res = sendOfferingAction(t, fixture.Offering.ID, PublishOffering, testGasPrice)
 	if res.StatusCode != http.StatusOK {
 		t.Fatal("got: ", res.Status)
@@ -0,0 +1,27 @@
+package uisrv
+
+import (
+	"net/http"
+
+	"github.com/privatix/dappctrl/data"
+)
+
+// handleGetReceipts replies with balance proofs accepted from clients in
+// chronological order. Receipts can be filtered by channel and by time range,
+// "from" is inclusive and "to" is exclusive.
+func (s *Server) handleGetReceipts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.handleGetResources(w, r, &getConf{
+		Params: []queryParam{
+			{Name: "channel", Field: "channel"},
+			{Name: "from", Field: "received_at", Op: ">="},
+			{Name: "to", Field: "received_at", Op: "<"},
+		},
+		View:        data.ReceiptTable,
+		OrderingSQL: "received_at",
+	})
+}
@@ -0,0 +1,71 @@
+// +build !noagentuisrvtest
+
+package uisrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/privatix/dappctrl/data"
+	"github.com/privatix/dappctrl/util"
+)
+
+func newTestReceipt(ch string, balance uint64, at time.Time) *data.Receipt {
+	return &data.Receipt{
+		ID:         util.NewUUID(),
+		Channel:    ch,
+		Balance:    data.NewAmount(balance),
+		Signature:  data.FromBytes([]byte("fake-sig")),
+		ClientIP:   "127.0.0.1",
+		ReceivedAt: at,
+	}
+}
+
+func TestGetReceipts(t *testing.T) {
+	defer cleanDB(t)
+	setTestUserCredentials(t)
+
+	ch := createTestChannel(t)
+	other := createTestChannel(t)
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	insertItems(t,
+		newTestReceipt(ch.ID, 3, start.Add(2*time.Minute)),
+		newTestReceipt(ch.ID, 1, start),
+		newTestReceipt(ch.ID, 2, start.Add(time.Minute)),
+		newTestReceipt(other.ID, 5, start.Add(90*time.Second)))
+
+	testGet := func(params map[string]string, balances ...uint64) {
+		res := getResources(t, receiptsPath, params)
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("failed to get receipts: ", res.StatusCode)
+		}
+
+		var receipts []data.Receipt
+		if err := json.NewDecoder(res.Body).Decode(
+			&receipts); err != nil {
+			t.Fatal("failed to decode reply: ", err)
+		}
+
+		if len(receipts) != len(balances) {
+			t.Fatalf("wanted %d receipts, got: %+v",
+				len(balances), receipts)
+		}
+
+		for i, v := range balances {
+			if receipts[i].Balance.Cmp(data.NewAmount(v)) != 0 {
+				t.Fatalf("wrong receipts order: %+v", receipts)
+			}
+		}
+	}
+
+	testGet(nil, 1, 2, 5, 3)
+	testGet(map[string]string{"channel": ch.ID}, 1, 2, 3)
+	testGet(map[string]string{
+		"channel": ch.ID,
+		"from":    start.Add(time.Minute).UTC().Format(time.RFC3339),
+		"to":      start.Add(2 * time.Minute).UTC().Format(time.RFC3339),
+	}, 2)
+}
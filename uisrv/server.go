@@ -7,6 +7,7 @@ import (
 
 	"github.com/privatix/dappctrl/data"
 	"github.com/privatix/dappctrl/job"
+	"github.com/privatix/dappctrl/signer"
 	"github.com/privatix/dappctrl/util"
 )
 
@@ -25,16 +26,23 @@ type TLSConfig struct {
 type Config struct {
 	Addr           string
 	TLS            *TLSConfig
-	EthCallTimeout uint // In seconds.
+	EthCallTimeout uint   // In seconds.
+	MinEthGas      uint64 // Gas to afford by default, for eth alerts.
 }
 
 // NewConfig creates a default server configuration.
 func NewConfig() *Config {
 	return &Config{
 		EthCallTimeout: 5,
+		MinEthGas:      200000,
 	}
 }
 
+// GasPriceOracle recommends gas prices for transactions.
+type GasPriceOracle interface {
+	GasPrice() (uint64, error)
+}
+
 // Server is agent api server.
 type Server struct {
 	conf           *Config
@@ -42,6 +50,8 @@ type Server struct {
 	db             *reform.DB
 	queue          *job.Queue
 	pwdStorage     data.PWDGetSetter
+	gasOracle      GasPriceOracle
+	signer         signer.Signer
 	encryptKeyFunc data.EncryptedKeyFunc
 	decryptKeyFunc data.ToPrivateKeyFunc
 }
@@ -51,32 +61,40 @@ func NewServer(conf *Config,
 	logger *util.Logger,
 	db *reform.DB,
 	queue *job.Queue,
-	pwdStorage data.PWDGetSetter) *Server {
+	pwdStorage data.PWDGetSetter,
+	gasOracle GasPriceOracle,
+	signer signer.Signer) *Server {
 	return &Server{
 		conf,
 		logger,
 		db,
 		queue,
 		pwdStorage,
+		gasOracle,
+		signer,
 		data.EncryptedKey,
 		data.ToPrivateKey}
 }
 
 const (
 	accountsPath        = "/accounts/"
+	alertsPath          = "/alerts"
 	authPath            = "/auth"
 	channelsPath        = "/channels/"
 	clientChannelsPath  = "/client/channels/"
 	clientOfferingsPath = "/client/offerings"
 	clientProductsPath  = "/client/products"
 	endpointsPath       = "/endpoints"
+	gasPricePath        = "/gasPrice"
 	incomePath          = "/income"
+	mnemonicPath        = "/mnemonic"
 	offeringsPath       = "/offerings/"
 	productsPath        = "/products"
+	receiptsPath        = "/receipts"
 	sessionsPath        = "/sessions"
 	settingsPath        = "/settings"
 	templatePath        = "/templates"
-	transactionsPath    = "/transactions"
+	transactionsPath    = "/transactions/"
 	usagePath           = "/usage"
 )
 
@@ -84,6 +102,7 @@ const (
 func (s *Server) ListenAndServe() error {
 	mux := http.NewServeMux()
 	mux.HandleFunc(accountsPath, basicAuthMiddleware(s, s.handleAccounts))
+	mux.HandleFunc(alertsPath, basicAuthMiddleware(s, s.handleGetAlerts))
 	mux.HandleFunc(authPath, s.handleAuth)
 	mux.HandleFunc(channelsPath, basicAuthMiddleware(s, s.handleChannels))
 	mux.HandleFunc(clientChannelsPath,
@@ -93,9 +112,12 @@ func (s *Server) ListenAndServe() error {
 	mux.HandleFunc(clientProductsPath,
 		basicAuthMiddleware(s, s.handleGetClientProducts))
 	mux.HandleFunc(endpointsPath, basicAuthMiddleware(s, s.handleGetEndpoints))
+	mux.HandleFunc(gasPricePath, basicAuthMiddleware(s, s.handleGetGasPrice))
 	mux.HandleFunc(incomePath, basicAuthMiddleware(s, s.handleGetIncome))
+	mux.HandleFunc(mnemonicPath, basicAuthMiddleware(s, s.handleGetMnemonic))
 	mux.HandleFunc(offeringsPath, basicAuthMiddleware(s, s.handleOfferings))
 	mux.HandleFunc(productsPath, basicAuthMiddleware(s, s.handleProducts))
+	mux.HandleFunc(receiptsPath, basicAuthMiddleware(s, s.handleGetReceipts))
 	mux.HandleFunc(sessionsPath, basicAuthMiddleware(s, s.handleGetSessions))
 	mux.HandleFunc(settingsPath, basicAuthMiddleware(s, s.handleSettings))
 	mux.HandleFunc(templatePath, basicAuthMiddleware(s, s.handleTempaltes))
@@ -4,7 +4,9 @@ package uisrv
 
 import (
 	"bytes"
+	"crypto/ecdsa"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -12,6 +14,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"gopkg.in/reform.v1"
@@ -25,10 +28,30 @@ import (
 var (
 	testServer         *Server
 	testEthereumClient *ethclient.Client
+	testKeystore       = testSigner{}
 
 	testPassword = "test-password"
 )
 
+const testGasPrice = 20000000000
+
+type testGasOracle struct{}
+
+func (o testGasOracle) GasPrice() (uint64, error) {
+	return testGasPrice, nil
+}
+
+// testSigner signs with keys which are not stored in the database.
+type testSigner map[common.Address]*ecdsa.PrivateKey
+
+func (s testSigner) SignHash(addr common.Address, hash []byte) ([]byte, error) {
+	key, ok := s[addr]
+	if !ok {
+		return nil, errors.New("unknown account")
+	}
+	return crypto.Sign(hash, key)
+}
+
 type testConfig struct {
 	ServerStartupDelay uint // In milliseconds.
 }
@@ -52,7 +75,8 @@ func TestMain(m *testing.M) {
 	queue := job.NewQueue(conf.Job, logger, db, nil)
 
 	pwdStorage := new(data.PWDStorage)
-	testServer = NewServer(conf.AgentServer, logger, db, queue, pwdStorage)
+	testServer = NewServer(conf.AgentServer, logger, db, queue, pwdStorage,
+		testGasOracle{}, testKeystore)
 	testServer.encryptKeyFunc = data.TestEncryptedKey
 	testServer.decryptKeyFunc = data.TestToPrivateKey
 	go testServer.ListenAndServe()
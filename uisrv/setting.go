@@ -30,12 +30,25 @@ func (s *Server) handleGetSettings(w http.ResponseWriter, r *http.Request) {
 
 type settingPayload []data.Setting
 
+// readOnlySettings are settings which are updated from the blockchain only.
+var readOnlySettings = map[string]bool{
+	data.SettingNetworkFee: true,
+}
+
 // handlePutSettings updates settings.
 func (s *Server) handlePutSettings(w http.ResponseWriter, r *http.Request) {
 	var payload settingPayload
 	if !s.parsePayload(w, r, &payload) {
 		return
 	}
+	for _, setting := range payload {
+		if readOnlySettings[setting.Key] {
+			s.replyErr(w, http.StatusBadRequest, &serverError{
+				Message: "setting " + setting.Key + " is read-only",
+			})
+			return
+		}
+	}
 	tx, err := s.db.Begin()
 	if err != nil {
 		s.logger.Error("failed to update settings: %v", err)
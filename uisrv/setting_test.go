@@ -77,3 +77,27 @@ func TestUpdateSettingsSuccess(t *testing.T) {
 		t.Fatal("settings not updated")
 	}
 }
+
+func TestUpdateReadOnlySetting(t *testing.T) {
+	defer cleanDB(t)
+	setTestUserCredentials(t)
+
+	setting := data.Setting{
+		Key:   data.SettingNetworkFee,
+		Value: "1",
+		Name:  "network fee",
+	}
+	insertItems(t, &setting)
+
+	updated := setting
+	updated.Value = "2"
+	res := putSetting(t, settingPayload{updated})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatal("read-only setting updated: ", res.StatusCode)
+	}
+
+	data.ReloadFromTestDB(t, testServer.db, &setting)
+	if setting.Value != "1" {
+		t.Fatal("read-only setting changed: ", setting.Value)
+	}
+}
@@ -1,17 +1,104 @@
 package uisrv
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/privatix/dappctrl/data"
 )
 
+// handleTransactions calls appropriate handler by scanning incoming request.
 func (s *Server) handleTransactions(w http.ResponseWriter, r *http.Request) {
+	if id := idFromStatusPath(transactionsPath, r.URL.Path); id != "" {
+		if r.Method == http.MethodPut {
+			s.handlePutTransactionStatus(w, r, id)
+			return
+		}
+	} else {
+		if r.Method == http.MethodGet {
+			s.handleGetTransactions(w, r)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusMethodNotAllowed)
+}
+
+// handleGetTransactions replies with all transactions.
+func (s *Server) handleGetTransactions(w http.ResponseWriter, r *http.Request) {
 	s.handleGetResources(w, r, &getConf{
 		Params: []queryParam{
 			{Name: "relatedType", Field: "related_type", Op: "="},
 			{Name: "relatedID", Field: "related_id", Op: "="},
+			{Name: "status", Field: "status", Op: "="},
 		},
 		View: data.EthTxTable,
 	})
 }
+
+// Actions that replace pending transactions.
+const (
+	speedUpTransaction = "speedup"
+	cancelTransaction  = "cancel"
+)
+
+// TransactionPutPayload is a transaction action payload. Zero gas price
+// means the minimal price accepted for a replacement.
+type TransactionPutPayload struct {
+	Action   string `json:"action"`
+	GasPrice uint64 `json:"gasPrice"`
+}
+
+func (s *Server) handlePutTransactionStatus(
+	w http.ResponseWriter, r *http.Request, id string) {
+	payload := &TransactionPutPayload{}
+	if !s.parsePayload(w, r, payload) {
+		return
+	}
+
+	s.logger.Info("action ( %v )  request for transaction with id: %v recieved.", payload.Action, id)
+
+	jobTypes := map[string]string{
+		speedUpTransaction: data.JobSpeedUpTransaction,
+		cancelTransaction:  data.JobCancelTransaction,
+	}
+
+	jobType, ok := jobTypes[payload.Action]
+	if !ok {
+		s.replyInvalidAction(w)
+		return
+	}
+
+	tx := &data.EthTx{}
+	if !s.findTo(w, tx, id) {
+		return
+	}
+
+	if tx.Status != data.TxSent {
+		s.replyErr(w, http.StatusBadRequest, &serverError{
+			Message: "transaction is not pending",
+		})
+		return
+	}
+
+	dataJSON, err := json.Marshal(
+		&data.JobReplaceTxData{GasPrice: payload.GasPrice})
+	if err != nil {
+		s.logger.Error("failed to marshal job data: %v", err)
+		s.replyUnexpectedErr(w)
+		return
+	}
+
+	if err := s.queue.Add(&data.Job{
+		Type:        jobType,
+		RelatedType: data.JobTransaction,
+		RelatedID:   id,
+		CreatedBy:   data.JobUser,
+		Data:        dataJSON,
+	}); err != nil {
+		s.logger.Error("failed to add job %s: %v", jobType, err)
+		s.replyUnexpectedErr(w)
+		return
+	}
+
+	s.replyOK(w, "transaction replacement scheduled")
+}
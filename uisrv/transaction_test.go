@@ -1,6 +1,9 @@
 package uisrv
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
 	"testing"
 
 	"github.com/privatix/dappctrl/data"
@@ -38,4 +41,63 @@ func TestGetTransactions(t *testing.T) {
 	testGetTransactions(t, 0, data.JobAccount, "")
 	testGetTransactions(t, 0, "", util.NewUUID())
 	testGetTransactions(t, 1, data.JobChannel, testRelID)
+
+	res := getResources(t, transactionsPath,
+		map[string]string{"status": data.TxSent})
+	testGetResources(t, res, 1)
+	res = getResources(t, transactionsPath,
+		map[string]string{"status": data.TxMined})
+	testGetResources(t, res, 0)
+}
+
+func sendTransactionAction(t *testing.T, id, action string,
+	gasPrice uint64) *http.Response {
+	path := fmt.Sprint(transactionsPath, id, "/status")
+	payload := &TransactionPutPayload{Action: action, GasPrice: gasPrice}
+	return sendPayload(t, http.MethodPut, path, payload)
+}
+
+func TestPutTransactionStatus(t *testing.T) {
+	defer setTestUserCredentials(t)()
+
+	tx := data.NewTestEthTx(data.JobAccount, util.NewUUID())
+	data.InsertToTestDB(t, testServer.db, tx)
+	defer data.DeleteFromTestDB(t, testServer.db, tx)
+
+	res := sendTransactionAction(t, tx.ID, "wrong-action", 0)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("wanted: %d, got: %v", http.StatusBadRequest, res.Status)
+	}
+
+	res = sendTransactionAction(t, util.NewUUID(), cancelTransaction, 0)
+	if res.StatusCode != http.StatusNotFound {
+		t.Fatalf("wanted: %d, got: %v", http.StatusNotFound, res.Status)
+	}
+
+	testJobCreated := func(action, jobType string, gasPrice uint64) {
+		res := sendTransactionAction(t, tx.ID, action, gasPrice)
+		if res.StatusCode != http.StatusOK {
+			t.Fatal("got: ", res.Status)
+		}
+		job := &data.Job{}
+		data.FindInTestDB(t, testServer.db, job, "type", jobType)
+		defer data.DeleteFromTestDB(t, testServer.db, job)
+
+		jdata := &data.JobReplaceTxData{}
+		json.Unmarshal(job.Data, jdata)
+		if job.RelatedID != tx.ID || jdata.GasPrice != gasPrice {
+			t.Fatal("job does not contain expected data")
+		}
+	}
+
+	testJobCreated(speedUpTransaction, data.JobSpeedUpTransaction, 10)
+	testJobCreated(cancelTransaction, data.JobCancelTransaction, 0)
+
+	tx.Status = data.TxMined
+	data.SaveToTestDB(t, testServer.db, tx)
+
+	res = sendTransactionAction(t, tx.ID, speedUpTransaction, 10)
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("wanted: %d, got: %v", http.StatusBadRequest, res.Status)
+	}
 }